@@ -0,0 +1,122 @@
+// Command polkasim sends Polka webhooks to a local Chirpy server, signed
+// with the same secrets the server reads, so subscription flows can be
+// exercised without a Polka account.
+//
+//	go run ./cmd/polkasim -user <user id> -scenario lifecycle
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/billing"
+	"github.com/Walther-Knight/chirpy/internal/subscription"
+	"github.com/joho/godotenv"
+)
+
+var scenarios = map[string][]string{
+	"upgrade":        {subscription.EventUpgraded},
+	"renew":          {subscription.EventRenewed},
+	"cancel":         {subscription.EventCancelled},
+	"payment-failed": {subscription.EventPaymentFailed},
+	"downgrade":      {subscription.EventDowngraded},
+	"lifecycle": {
+		subscription.EventUpgraded,
+		subscription.EventRenewed,
+		subscription.EventPaymentFailed,
+		subscription.EventRenewed,
+		subscription.EventCancelled,
+		subscription.EventDowngraded,
+	},
+}
+
+func main() {
+	godotenv.Load()
+	target := flag.String("url", "http://localhost:8080/api/polka/webhooks", "webhook endpoint")
+	userID := flag.String("user", "", "user id the events are for")
+	scenario := flag.String("scenario", "upgrade", "upgrade, renew, cancel, payment-failed, downgrade, lifecycle or duplicate")
+	period := flag.Duration("period", 30*24*time.Hour, "billing period used for current_period_end")
+	delay := flag.Duration("delay", 0, "pause between events")
+	flag.Parse()
+
+	if *userID == "" {
+		log.Fatal("-user is required")
+	}
+	polka := &billing.Polka{APIKey: os.Getenv("POLKA_SECRET")}
+	for _, secret := range strings.Split(os.Getenv("POLKA_WEBHOOK_SECRETS"), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			polka.WebhookSecrets = append(polka.WebhookSecrets, secret)
+		}
+	}
+	if polka.APIKey == "" && len(polka.WebhookSecrets) == 0 {
+		log.Fatal("set POLKA_WEBHOOK_SECRETS or POLKA_SECRET")
+	}
+
+	//duplicate sends the same upgrade twice, the second should be acknowledged without effect
+	events := scenarios[*scenario]
+	repeat := 1
+	if *scenario == "duplicate" {
+		events = []string{subscription.EventUpgraded}
+		repeat = 2
+	}
+	if events == nil {
+		log.Fatalf("unknown scenario %q", *scenario)
+	}
+
+	for i, eventType := range events {
+		if i > 0 {
+			time.Sleep(*delay)
+		}
+		periodEnd := time.Now().Add(*period).UTC()
+		payload := billing.PolkaPayload{
+			ID:    newEventID(),
+			Event: eventType,
+			Data: billing.PolkaData{
+				UserID:           *userID,
+				Plan:             subscription.PlanRed,
+				CurrentPeriodEnd: &periodEnd,
+			},
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for n := 0; n < repeat; n++ {
+			status, err := send(polka, *target, body)
+			if err != nil {
+				log.Fatalf("%s: %v", eventType, err)
+			}
+			fmt.Printf("%s %s -> %s\n", payload.ID, eventType, status)
+		}
+	}
+}
+
+func send(polka *billing.Polka, target string, body []byte) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	polka.SignRequest(req, body)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	return res.Status, nil
+}
+
+func newEventID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "evt_" + hex.EncodeToString(b)
+}
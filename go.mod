@@ -12,3 +12,9 @@ require github.com/joho/godotenv v1.5.1
 require golang.org/x/crypto v0.38.0
 
 require github.com/golang-jwt/jwt/v5 v5.2.2
+
+require golang.org/x/sys v0.33.0 // indirect
+
+require github.com/DATA-DOG/go-sqlmock v1.5.2
+
+require github.com/coder/websocket v1.8.13
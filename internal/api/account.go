@@ -0,0 +1,436 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/export"
+	"github.com/Walther-Knight/chirpy/internal/jobs"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/Walther-Knight/chirpy/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	// accounts with more chirps than this get their export built in the background
+	syncExportChirpLimit = 1000
+	dataExportTTL        = 7 * 24 * time.Hour
+	// a pending export older than this counts as failed, its job has given up
+	dataExportTimeout = time.Hour
+	// three attempts of the export job fit within dataExportTimeout
+	dataExportAttemptTimeout = 15 * time.Minute
+	// login attempts included in an export, newest first
+	exportLoginAttemptLimit = 1000
+)
+
+func GetCurrentUser(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	userInfo, err := api.Db.GetUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	ResJson := userResponse(userInfo)
+	attachSubscription(r.Context(), api, &ResJson)
+	attachEntitlements(r.Context(), api, &ResJson)
+	writeSuccessResponse(w, http.StatusOK, ResJson)
+}
+
+// DeleteAccount schedules the caller's account for deletion after the grace
+// period. All sessions are revoked; logging in again and calling
+// RestoreAccount cancels the deletion.
+func DeleteAccount(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	type reqParams struct {
+		Password string `json:"password"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	params := reqParams{}
+	errDecode := decodeJSONBody(r, &params)
+
+	if errDecode != nil {
+		log.Printf("Error decoding parameters: %s", errDecode)
+		writeErrorResponse(w, http.StatusBadRequest, "error decoding JSON")
+		return
+	}
+
+	userInfo, err := api.Db.GetUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	if wait := loginRetryAfter(api, r, userInfo.Email); wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
+	err = api.Hasher.Check(userInfo.HashedPassword, params.Password)
+	if err != nil {
+		recordLoginFailure(api, r, userInfo.Email)
+		writeErrorCode(w, http.StatusForbidden, "invalid_current_password", "current password is incorrect")
+		return
+	}
+
+	now := time.Now()
+	deleteAt := now.Add(api.DeletionGracePeriod)
+	rows, err := api.Db.ScheduleUserDeletion(r.Context(), database.ScheduleUserDeletionParams{
+		DeletionScheduledAt: sql.NullTime{
+			Time:  deleteAt,
+			Valid: true,
+		},
+		UpdatedAt: now,
+		ID:        userID,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	if rows == 0 {
+		writeErrorCode(w, http.StatusConflict, "deletion_already_scheduled", "account deletion is already scheduled")
+		return
+	}
+
+	err = revokeUserSessions(r.Context(), api, userID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	log.Printf("Deletion of user %v scheduled for %v", userID, deleteAt)
+	userInfo.DeletionScheduledAt = sql.NullTime{Time: deleteAt, Valid: true}
+	writeSuccessResponse(w, http.StatusAccepted, userResponse(userInfo))
+}
+
+func RestoreAccount(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := api.Db.CancelUserDeletion(r.Context(), database.CancelUserDeletionParams{
+		UpdatedAt: time.Now(),
+		ID:        userID,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	if rows == 0 {
+		writeErrorCode(w, http.StatusConflict, "deletion_not_scheduled", "account deletion is not scheduled")
+		return
+	}
+
+	userInfo, err := api.Db.GetUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	log.Printf("Deletion of user %v cancelled", userID)
+	writeSuccessResponse(w, http.StatusOK, userResponse(userInfo))
+}
+
+// ExportAccount returns the caller's data as a zip archive. Large accounts
+// get 202 and a Location to poll while the archive is built.
+func ExportAccount(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := api.Db.CountChirpsByAuthor(r.Context(), userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	if count <= syncExportChirpLimit {
+		archive, err := buildExportArchive(r.Context(), api, userID)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			log.Printf("Error building export for user %v: %v", userID, err)
+			writeErrorResponse(w, http.StatusInternalServerError, "export failed")
+			return
+		}
+		writeExportArchive(w, archive, time.Now())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	now := time.Now()
+	var res database.DataExport
+	err = inTx(r.Context(), api, func(q *database.Queries) error {
+		var err error
+		res, err = q.CreateDataExport(r.Context(), database.CreateDataExportParams{
+			ID:        uuid.New(),
+			UserID:    userID,
+			CreatedAt: now,
+			ExpiresAt: now.Add(dataExportTTL),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = jobs.Enqueue(r.Context(), q, jobBuildDataExport, dataExportJob{ExportID: res.ID, UserID: userID}, jobs.Options{MaxAttempts: 3})
+		return err
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	w.Header().Set("Location", "/api/users/me/exports/"+res.ID.String())
+	writeSuccessResponse(w, http.StatusAccepted, dataExportResponse(res, now))
+}
+
+func GetDataExport(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	exportID, err := uuid.Parse(r.PathValue("exportID"))
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "error: export ID does not exist")
+		return
+	}
+
+	res, err := api.Db.GetDataExport(r.Context(), database.GetDataExportParams{
+		ID:     exportID,
+		UserID: userID,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(w, http.StatusNotFound, "error: export ID does not exist")
+			return
+		}
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	status := dataExportResponse(res, time.Now())
+	switch status.Status {
+	case "ready":
+		writeExportArchive(w, res.Archive, res.CompletedAt.Time)
+	case "pending":
+		writeSuccessResponse(w, http.StatusAccepted, status)
+	default:
+		writeSuccessResponse(w, http.StatusOK, status)
+	}
+}
+
+func dataExportResponse(e database.DataExport, now time.Time) models.DataExport {
+	res := models.DataExport{
+		ID:        e.ID,
+		Status:    e.Status,
+		CreatedAt: e.CreatedAt,
+		ExpiresAt: e.ExpiresAt,
+	}
+	if e.Status == "pending" && now.Sub(e.CreatedAt) > dataExportTimeout {
+		res.Status = "failed"
+	}
+	if e.CompletedAt.Valid {
+		res.CompletedAt = &e.CompletedAt.Time
+	}
+	return res
+}
+
+func writeExportArchive(w http.ResponseWriter, archive []byte, generatedAt time.Time) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, generatedAt.UTC().Format("20060102")))
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+type dataExportJob struct {
+	ExportID uuid.UUID `json:"export_id"`
+	UserID   uuid.UUID `json:"user_id"`
+}
+
+// buildDataExport builds an archive outside the request. Failures are
+// retried, the last one is stored so the client stops polling.
+func buildDataExport(ctx context.Context, api *middleware.ApiConfig, job jobs.Job, p dataExportJob) error {
+	status := "ready"
+	archive, errBuild := buildExportArchive(ctx, api, p.UserID)
+	if errBuild != nil {
+		if !job.LastAttempt() {
+			return errBuild
+		}
+		log.Printf("Error building export %v: %v", p.ExportID, errBuild)
+		status = "failed"
+		archive = nil
+	}
+	err := api.Db.CompleteDataExport(ctx, database.CompleteDataExportParams{
+		Status:  status,
+		Archive: archive,
+		CompletedAt: sql.NullTime{
+			Time:  time.Now(),
+			Valid: true,
+		},
+		ID: p.ExportID,
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Export %v for user %v finished: %s", p.ExportID, p.UserID, status)
+	return errBuild
+}
+
+func buildExportArchive(ctx context.Context, api *middleware.ApiConfig, userID uuid.UUID) ([]byte, error) {
+	data, err := collectExportData(ctx, api, userID)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = export.WriteArchive(&buf, data)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func optionalTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func collectExportData(ctx context.Context, api *middleware.ApiConfig, userID uuid.UUID) (export.Data, error) {
+	userInfo, err := api.Db.GetUser(ctx, userID)
+	if err != nil {
+		return export.Data{}, err
+	}
+	data := export.Data{
+		GeneratedAt: time.Now(),
+		Profile: export.Profile{
+			ID:                  userInfo.ID,
+			Email:               userInfo.Email,
+			PendingEmail:        userInfo.PendingEmail.String,
+			EmailVerified:       userInfo.EmailVerified,
+			IsChirpyRed:         userInfo.IsChirpyRed,
+			TOTPEnabled:         userInfo.TotpEnabled,
+			Role:                userInfo.Role,
+			CreatedAt:           userInfo.CreatedAt,
+			UpdatedAt:           userInfo.UpdatedAt,
+			DeletionScheduledAt: optionalTime(userInfo.DeletionScheduledAt),
+		},
+		Chirps:               []export.Chirp{},
+		Sessions:             []export.Session{},
+		PersonalAccessTokens: []export.PersonalAccessToken{},
+		Identities:           []export.Identity{},
+		LoginAttempts:        []export.LoginAttempt{},
+	}
+
+	chirps, err := api.Db.GetAllChirpsByAuthor(ctx, userID)
+	if err != nil {
+		return export.Data{}, err
+	}
+	for _, c := range chirps {
+		data.Chirps = append(data.Chirps, export.Chirp{ID: c.ID, Body: c.Body, CreatedAt: c.CreatedAt, UpdatedAt: c.UpdatedAt})
+	}
+
+	sessions, err := api.Db.ListUserRefreshTokens(ctx, userID)
+	if err != nil {
+		return export.Data{}, err
+	}
+	for _, s := range sessions {
+		data.Sessions = append(data.Sessions, export.Session{
+			CreatedAt: s.CreatedAt,
+			ExpiresAt: s.ExpiresAt,
+			RevokedAt: optionalTime(s.RevokedAt),
+			ClientID:  s.ClientID.String,
+		})
+	}
+
+	tokens, err := api.Db.ListAllPersonalAccessTokens(ctx, userID)
+	if err != nil {
+		return export.Data{}, err
+	}
+	for _, t := range tokens {
+		data.PersonalAccessTokens = append(data.PersonalAccessTokens, export.PersonalAccessToken{
+			Name:       t.Name,
+			Scopes:     auth.SplitScopes(t.Scopes),
+			CreatedAt:  t.CreatedAt,
+			ExpiresAt:  optionalTime(t.ExpiresAt),
+			LastUsedAt: optionalTime(t.LastUsedAt),
+			RevokedAt:  optionalTime(t.RevokedAt),
+		})
+	}
+
+	identities, err := api.Db.ListUserIdentities(ctx, userID)
+	if err != nil {
+		return export.Data{}, err
+	}
+	for _, i := range identities {
+		data.Identities = append(data.Identities, export.Identity{Issuer: i.Issuer, Subject: i.Subject, Email: i.Email, CreatedAt: i.CreatedAt})
+	}
+
+	attempts, err := api.Db.ListLoginAttemptsByEmail(ctx, database.ListLoginAttemptsByEmailParams{
+		Email: userInfo.Email,
+		Limit: exportLoginAttemptLimit,
+	})
+	if err != nil {
+		return export.Data{}, err
+	}
+	for _, a := range attempts {
+		data.LoginAttempts = append(data.LoginAttempts, export.LoginAttempt{
+			IPAddress: a.IpAddress,
+			Success:   a.Success,
+			Reason:    a.Reason,
+			CreatedAt: a.CreatedAt,
+		})
+	}
+	return data, nil
+}
+
+// purgeAccounts deletes accounts whose grace period has ended and expired
+// export archives.
+func purgeAccounts(ctx context.Context, api *middleware.ApiConfig) error {
+	now := time.Now()
+	due := sql.NullTime{Time: now, Valid: true}
+	//login attempts only reference the user with ON DELETE SET NULL, remove them first
+	err := api.Db.PurgeDeletedUsersLoginAttempts(ctx, due)
+	if err != nil {
+		return err
+	}
+	rows, err := api.Db.PurgeDeletedUsers(ctx, due)
+	if err != nil {
+		return err
+	}
+	if rows > 0 {
+		log.Printf("Deleted %d accounts after their grace period", rows)
+	}
+	return api.Db.DeleteExpiredDataExports(ctx, now)
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/google/uuid"
+)
+
+// adminTargetUser parses {userID} and refuses to let an admin act on their
+// own account, so the last admin cannot lock or demote themselves.
+func adminTargetUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	adminID, ok := requestUserID(w, r)
+	if !ok {
+		return uuid.Nil, false
+	}
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "error: user ID does not exist")
+		return uuid.Nil, false
+	}
+	if userID == adminID {
+		writeErrorCode(w, http.StatusBadRequest, "self_action", "admins cannot change their own role or lock state")
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func SetUserRole(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	type reqParams struct {
+		Role string `json:"role"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	params := reqParams{}
+	errDecode := decodeJSONBody(r, &params)
+
+	if errDecode != nil {
+		log.Printf("Error decoding parameters: %s", errDecode)
+		writeErrorResponse(w, http.StatusBadRequest, "error decoding JSON")
+		return
+	}
+	if params.Role != auth.RoleUser && params.Role != auth.RoleAdmin {
+		writeErrorCode(w, http.StatusBadRequest, "invalid_role", "role must be user or admin")
+		return
+	}
+
+	rows, err := api.Db.SetUserRole(r.Context(), database.SetUserRoleParams{
+		Role:      params.Role,
+		UpdatedAt: time.Now(),
+		ID:        userID,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	if rows == 0 {
+		writeErrorResponse(w, http.StatusNotFound, "error: user ID does not exist")
+		return
+	}
+
+	log.Printf("Role of user %v set to %s", userID, params.Role)
+	writeSuccessResponse(w, http.StatusNoContent, "")
+}
+
+// LockUser blocks logins and ends every session of the user, including
+// personal access tokens, until UnlockUser is called.
+func LockUser(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	rows, err := api.Db.LockUser(r.Context(), database.LockUserParams{
+		LockedAt: sql.NullTime{
+			Time:  now,
+			Valid: true,
+		},
+		UpdatedAt: now,
+		ID:        userID,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	if rows == 0 {
+		writeErrorResponse(w, http.StatusNotFound, "error: user does not exist or is already locked")
+		return
+	}
+
+	err = revokeUserSessions(r.Context(), api, userID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	log.Printf("User %v locked", userID)
+	writeSuccessResponse(w, http.StatusNoContent, "")
+}
+
+func UnlockUser(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := api.Db.UnlockUser(r.Context(), database.UnlockUserParams{
+		UpdatedAt: time.Now(),
+		ID:        userID,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	if rows == 0 {
+		writeErrorResponse(w, http.StatusNotFound, "error: user does not exist or is not locked")
+		return
+	}
+
+	log.Printf("User %v unlocked", userID)
+	writeSuccessResponse(w, http.StatusNoContent, "")
+}
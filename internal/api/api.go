@@ -1,8 +1,10 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"sort"
@@ -11,8 +13,11 @@ import (
 
 	"github.com/Walther-Knight/chirpy/internal/auth"
 	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/entitlements"
 	"github.com/Walther-Knight/chirpy/internal/middleware"
 	"github.com/Walther-Knight/chirpy/internal/models"
+	"github.com/Walther-Knight/chirpy/internal/outbox"
+	"github.com/Walther-Knight/chirpy/internal/webhooks"
 	"github.com/google/uuid"
 )
 
@@ -44,6 +49,37 @@ func writeErrorResponse(w http.ResponseWriter, status int, message string) {
 	}
 }
 
+func writeErrorCode(w http.ResponseWriter, status int, code, message string) {
+	errorJSON := models.ErrorBody{
+		Error: message,
+		Code:  code,
+	}
+
+	w.WriteHeader(status)
+	err := marshalJSON(w, errorJSON)
+	if err != nil {
+		log.Printf("Error marshalling JSON: %s", err)
+		w.Write([]byte(`{"error: Something went wrong converting JSON"}`))
+		return
+	}
+}
+
+// checkPasswordPolicy writes a 400 with the policy error code and returns
+// false when the password is rejected.
+func checkPasswordPolicy(api *middleware.ApiConfig, w http.ResponseWriter, password, email string) bool {
+	err := api.PasswordPolicy.Validate(password, email)
+	if err == nil {
+		return true
+	}
+	var policyErr *auth.PolicyError
+	if errors.As(err, &policyErr) {
+		writeErrorCode(w, http.StatusBadRequest, policyErr.Code, policyErr.Message)
+		return false
+	}
+	writeErrorResponse(w, http.StatusInternalServerError, "error validating password")
+	return false
+}
+
 func writeSuccessResponse(w http.ResponseWriter, status int, data any) {
 	w.WriteHeader(status)
 	err := marshalJSON(w, data)
@@ -54,6 +90,69 @@ func writeSuccessResponse(w http.ResponseWriter, status int, data any) {
 	}
 }
 
+func userResponse(u database.User) models.User {
+	return models.User{
+		ID:                  u.ID,
+		CreatedAt:           u.CreatedAt,
+		UpdatedAt:           u.UpdatedAt,
+		Email:               u.Email,
+		IsChirpyRed:         u.IsChirpyRed,
+		EmailVerified:       u.EmailVerified,
+		TOTPEnabled:         u.TotpEnabled,
+		PendingEmail:        u.PendingEmail.String,
+		Role:                u.Role,
+		DeletionScheduledAt: optionalTime(u.DeletionScheduledAt),
+	}
+}
+
+// requestUserID returns the caller set by middleware.Require. Every route
+// using it must be wrapped in Require, so a missing principal is a wiring bug.
+func requestUserID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	principal, ok := auth.PrincipalFrom(r.Context())
+	if !ok {
+		log.Printf("No principal in context for %s %s", r.Method, r.URL.Path)
+		writeErrorResponse(w, http.StatusUnauthorized, "invalid token")
+		return uuid.Nil, false
+	}
+	return principal.UserID, true
+}
+
+// revokeUserSessions revokes every refresh token and personal access token of
+// the user and bumps the token version, which invalidates all access tokens
+// issued so far.
+func revokeUserSessions(ctx context.Context, api *middleware.ApiConfig, userID uuid.UUID) error {
+	now := time.Now()
+	revokedAt := sql.NullTime{
+		Time:  now,
+		Valid: true,
+	}
+	err := api.Db.RevokeAllRefreshTokens(ctx, database.RevokeAllRefreshTokensParams{
+		RevokedAt: revokedAt,
+		UserID:    userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = api.Db.RevokeAllPersonalAccessTokens(ctx, database.RevokeAllPersonalAccessTokensParams{
+		RevokedAt: revokedAt,
+		UserID:    userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	version, err := api.Db.IncrementTokenVersion(ctx, database.IncrementTokenVersionParams{
+		UpdatedAt: now,
+		ID:        userID,
+	})
+	if err != nil {
+		return err
+	}
+	api.TokenVersions.Set(userID, version)
+	return nil
+}
+
 // removed bool lesson 5:6 and filtered bool var and filtered return
 func profanityFilter(s string) string {
 	splitString := strings.Split(s, " ")
@@ -81,21 +180,28 @@ func Health(w http.ResponseWriter, r *http.Request) {
 
 func NewChirp(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
 	type validateBody struct {
-		Body string `json:"body"`
+		Body      string     `json:"body"`
+		PublishAt *time.Time `json:"publish_at"`
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 
-	userToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		writeErrorResponse(w, http.StatusUnauthorized, "unauthorized user, no token")
+	UserId, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
-	UserId, err := auth.ValidateJWT(userToken, api.Token)
-	if err != nil {
-		writeErrorResponse(w, http.StatusUnauthorized, "unauthorized user, invalid token")
-		return
+	if api.RequireVerifiedEmail {
+		verified, err := api.Db.GetUserEmailVerified(r.Context(), UserId)
+		if err != nil {
+			log.Printf("Error on database: %v", err)
+			writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+			return
+		}
+		if !verified {
+			writeErrorCode(w, http.StatusForbidden, "email_unverified", "verify your email address before posting chirps")
+			return
+		}
 	}
 
 	params := validateBody{}
@@ -107,22 +213,39 @@ func NewChirp(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if len(params.Body) > 140 {
-		writeErrorResponse(w, http.StatusBadRequest, "Chirp is too long")
-		return
-	}
-
-	if params.Body == "" {
-		writeErrorResponse(w, http.StatusBadRequest, "Chirp must contain characters")
+	if !validateChirpBody(api, w, r, UserId, params.Body) {
 		return
 	}
 
-	res, err := api.Db.CreateChirp(r.Context(), database.CreateChirpParams{
-		ID:        uuid.New(),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-		Body:      profanityFilter(params.Body),
-		UserID:    UserId,
+	now := time.Now()
+	publishAt := now
+	if params.PublishAt != nil && params.PublishAt.After(now) {
+		if !requireEntitlement(api, w, r, UserId, entitlements.FeatureScheduledChirps) {
+			return
+		}
+		if params.PublishAt.After(now.Add(maxScheduleAhead)) {
+			writeErrorResponse(w, http.StatusBadRequest, "publish_at must be within 30 days")
+			return
+		}
+		publishAt = *params.PublishAt
+	}
+
+	var res database.Chirp
+	err := inTx(r.Context(), api, func(q *database.Queries) error {
+		var err error
+		res, err = q.CreateChirp(r.Context(), database.CreateChirpParams{
+			ID:        uuid.New(),
+			CreatedAt: now,
+			UpdatedAt: now,
+			Body:      profanityFilter(params.Body),
+			UserID:    UserId,
+			PublishAt: publishAt,
+		})
+		if err != nil {
+			return err
+		}
+		//a scheduled chirp is announced when it is published
+		return outbox.Record(r.Context(), q, UserId, webhooks.EventChirpCreated, chirpResponse(res), res.PublishAt)
 	})
 	if err != nil {
 		log.Printf("Error on database: %v", err)
@@ -130,15 +253,7 @@ func NewChirp(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	ResJson := models.Chirp{
-		ID:        res.ID.String(),
-		CreatedAt: res.CreatedAt,
-		UpdatedAt: res.UpdatedAt,
-		Body:      res.Body,
-		UserID:    res.UserID.String(),
-	}
-
-	writeSuccessResponse(w, http.StatusCreated, ResJson)
+	writeSuccessResponse(w, http.StatusCreated, chirpResponse(res))
 }
 
 func GetAllChirps(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
@@ -149,7 +264,7 @@ func GetAllChirps(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Requ
 	var Res []database.Chirp
 	var err error
 	if s == "" {
-		Res, err = api.Db.GetAllChirps(r.Context())
+		Res, err = api.Db.GetAllChirps(r.Context(), time.Now())
 		if err != nil {
 			log.Printf("Error on database: %v", err)
 			writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
@@ -163,7 +278,10 @@ func GetAllChirps(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Requ
 			return
 		}
 
-		Res, err = api.Db.GetAllChirpsByAuthor(r.Context(), userId)
+		Res, err = api.Db.GetPublishedChirpsByAuthor(r.Context(), database.GetPublishedChirpsByAuthorParams{
+			UserID:    userId,
+			PublishAt: time.Now(),
+		})
 		if err != nil {
 			log.Printf("Error on database: %v", err)
 			writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
@@ -173,21 +291,14 @@ func GetAllChirps(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Requ
 
 	ResJson := []models.Chirp{}
 	for _, chirp := range Res {
-		chirpModel := models.Chirp{
-			ID:        chirp.ID.String(),
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID.String(),
-		}
-		ResJson = append(ResJson, chirpModel)
+		ResJson = append(ResJson, chirpResponse(chirp))
 	}
 
-	// SQL Query returns chirps in ASC order by created_at by default
+	// SQL Query returns chirps in ASC order by publish_at by default
 	// In memory sorting is only required for DESC sort parameter
 	s = r.URL.Query().Get("sort")
 	if s == "desc" {
-		sort.Slice(ResJson, func(i, j int) bool { return ResJson[i].CreatedAt.After(ResJson[j].CreatedAt) })
+		sort.Slice(ResJson, func(i, j int) bool { return ResJson[i].PublishedAt.After(ResJson[j].PublishedAt) })
 	}
 
 	writeSuccessResponse(w, http.StatusOK, ResJson)
@@ -215,16 +326,13 @@ func GetChirp(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request)
 		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
 		return
 	}
-
-	ResJson := models.Chirp{
-		ID:        res.ID.String(),
-		CreatedAt: res.CreatedAt,
-		UpdatedAt: res.UpdatedAt,
-		Body:      res.Body,
-		UserID:    res.UserID.String(),
+	//scheduled chirps stay hidden until published, authors list them with ListScheduledChirps
+	if res.PublishAt.After(time.Now()) {
+		writeErrorResponse(w, http.StatusNotFound, "error: Chirp ID does not exist")
+		return
 	}
 
-	writeSuccessResponse(w, http.StatusOK, ResJson)
+	writeSuccessResponse(w, http.StatusOK, chirpResponse(res))
 }
 
 func validateEmail(s string) bool {
@@ -266,7 +374,11 @@ func NewUser(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	pwd, errHash := auth.HashPassword(params.Password)
+	if !checkPasswordPolicy(api, w, params.Password, params.Email) {
+		return
+	}
+
+	pwd, errHash := api.Hasher.Hash(params.Password)
 	if errHash != nil {
 		writeErrorResponse(w, http.StatusInternalServerError, "error hashing password")
 		return
@@ -285,23 +397,24 @@ func NewUser(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	ResJson := models.User{
-		ID:          res.ID,
-		CreatedAt:   res.CreatedAt,
-		UpdatedAt:   res.UpdatedAt,
-		Email:       res.Email,
-		IsChirpyRed: res.IsChirpyRed.Bool,
+	err = inTx(r.Context(), api, func(q *database.Queries) error {
+		return sendEmailVerification(r.Context(), api, q, res.ID, res.Email)
+	})
+	if err != nil {
+		//account exists already, the user can request a new verification email
+		log.Printf("Error creating verification token for user %v: %v", res.ID, err)
 	}
 
 	log.Printf("User: %s created with ID %v", res.Email, res.ID)
-	writeSuccessResponse(w, http.StatusCreated, ResJson)
+	writeSuccessResponse(w, http.StatusCreated, userResponse(res))
 
 }
 
 func UserLogin(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
 	type reqParams struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Password      string `json:"password"`
+		Email         string `json:"email"`
+		CookieSession bool   `json:"cookie_session"`
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -314,63 +427,173 @@ func UserLogin(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if wait := loginRetryAfter(api, r, params.Email); wait > 0 {
+		recordLoginAttempt(api, r, params.Email, uuid.Nil, false, "throttled")
+		writeTooManyAttempts(w, wait)
+		return
+	}
+
 	userInfo, err := api.Db.GetUserPassword(r.Context(), params.Email)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			recordLoginFailure(api, r, params.Email)
+			recordLoginAttempt(api, r, params.Email, uuid.Nil, false, "unknown_email")
+			writeErrorResponse(w, http.StatusUnauthorized, "incorrect email or password")
+			return
+		}
 		log.Printf("Error on database: %v", err)
 		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
 	}
-	err = auth.CheckPasswordHash(userInfo.HashedPassword, params.Password)
+	err = api.Hasher.Check(userInfo.HashedPassword, params.Password)
 	if err != nil {
+		recordLoginFailure(api, r, params.Email)
+		recordLoginAttempt(api, r, params.Email, userInfo.ID, false, "bad_password")
 		writeErrorResponse(w, http.StatusUnauthorized, "incorrect email or password")
 		return
 	}
 
-	ExpiresIn := 1 * time.Hour
-	newToken, err := auth.MakeJWT(userInfo.ID, api.Token, ExpiresIn)
+	//only callers who know the password learn that the account is locked
+	if userInfo.LockedAt.Valid {
+		recordLoginAttempt(api, r, params.Email, userInfo.ID, false, "account_locked")
+		writeErrorCode(w, http.StatusForbidden, "account_locked", "account is locked, contact an administrator")
+		return
+	}
+
+	//stored hash uses outdated algorithm or parameters, upgrade it while we have the plaintext
+	if api.Hasher.NeedsRehash(userInfo.HashedPassword) {
+		rehashUserPassword(api, r, userInfo.ID, params.Password)
+	}
+
+	//second factor required, the access/refresh pair is issued by LoginMFA
+	if userInfo.TotpEnabled {
+		recordLoginAttempt(api, r, params.Email, userInfo.ID, true, "mfa_required")
+		writeMFAChallenge(api, w, userInfo)
+		return
+	}
+
+	//cleared only once a session is issued, the password alone must not reset
+	//the backoff on guessing the second factor
+	resetLoginFailures(api, r, params.Email)
+	recordLoginAttempt(api, r, params.Email, userInfo.ID, true, "password")
+	issueSession(api, w, r, userInfo, params.CookieSession)
+}
+
+// issueSession creates an access token and refresh token for a fully
+// authenticated user and writes the login response. The tokens are returned
+// in the response body, or in HttpOnly cookies when the client asked for a
+// cookie session.
+func issueSession(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request, userInfo database.User, cookieSession bool) {
+	newToken, newRefreshToken, ok := createSession(api, w, r, userInfo)
+	if !ok {
+		return
+	}
+
+	ResJson := userResponse(userInfo)
+	attachSubscription(r.Context(), api, &ResJson)
+	attachEntitlements(r.Context(), api, &ResJson)
+	if cookieSession {
+		err := api.SetSessionCookies(w, newToken, sessionAccessTTL, newRefreshToken, sessionRefreshTTL)
+		if err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "csrf token creation failed")
+			return
+		}
+		writeSuccessResponse(w, http.StatusOK, ResJson)
+		return
+	}
+
+	ResJson.Token = newToken
+	ResJson.RefreshToken = newRefreshToken
+	writeSuccessResponse(w, http.StatusOK, ResJson)
+}
+
+const (
+	sessionAccessTTL  = 1 * time.Hour
+	sessionRefreshTTL = 1440 * time.Hour
+)
+
+// makeAccessToken restricts the sessions of an account scheduled for deletion
+// to viewing, restoring and exporting it. Refreshing after a restore lifts the
+// restriction.
+func makeAccessToken(api *middleware.ApiConfig, userID uuid.UUID, tokenVersion int32, pendingDeletion bool, expiresIn time.Duration) (string, error) {
+	if pendingDeletion {
+		return auth.MakePendingDeletionJWT(userID, tokenVersion, api.Token, expiresIn)
+	}
+	return auth.MakeJWT(userID, tokenVersion, api.Token, expiresIn)
+}
+
+// createSession creates the access token and stores the refresh token of a
+// new session. Errors are written to w.
+func createSession(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request, userInfo database.User) (string, string, bool) {
+	newToken, err := makeAccessToken(api, userInfo.ID, userInfo.TokenVersion, userInfo.DeletionScheduledAt.Valid, sessionAccessTTL)
 	if err != nil {
 		writeErrorResponse(w, http.StatusInternalServerError, "jwt token creation failed")
-		return
+		return "", "", false
 	}
 
 	newRefreshToken, err := auth.MakeRefreshToken()
 	if err != nil {
 		writeErrorResponse(w, http.StatusInternalServerError, "refresh token creation failed")
-		return
+		return "", "", false
 	}
-	//update database with token. No err handling on ParseDuration because I'm confident that won't error
-	duration, err2 := time.ParseDuration("1440h")
-	log.Println(err2)
 	err = api.Db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
 		Token:     newRefreshToken,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 		UserID:    userInfo.ID,
-		ExpiresAt: time.Now().Add(duration),
+		ExpiresAt: time.Now().Add(sessionRefreshTTL),
 	})
 
 	if err != nil {
 		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return "", "", false
+	}
+	return newToken, newRefreshToken, true
+}
+
+func rehashUserPassword(api *middleware.ApiConfig, r *http.Request, userID uuid.UUID, password string) {
+	newHash, err := api.Hasher.Hash(password)
+	if err != nil {
+		log.Printf("Error rehashing password for user %v: %v", userID, err)
 		return
 	}
+	err = api.Db.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		HashedPassword: newHash,
+		UpdatedAt:      time.Now(),
+		ID:             userID,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		return
+	}
+	log.Printf("Password hash for user %v upgraded", userID)
+}
 
-	ResJson := models.User{
-		ID:           userInfo.ID,
-		CreatedAt:    userInfo.CreatedAt,
-		UpdatedAt:    userInfo.UpdatedAt,
-		Email:        userInfo.Email,
-		IsChirpyRed:  userInfo.IsChirpyRed.Bool,
-		Token:        newToken,
-		RefreshToken: newRefreshToken,
+// refreshTokenFromRequest reads the refresh token from the Authorization
+// header, or from its cookie in cookie session mode.
+func refreshTokenFromRequest(w http.ResponseWriter, r *http.Request) (string, bool, bool) {
+	tokenString, fromCookie, err := middleware.SessionCookie(r, middleware.RefreshCookie)
+	if err != nil {
+		writeErrorCode(w, http.StatusForbidden, "csrf_failed", "missing or invalid "+middleware.CSRFHeader+" header")
+		return "", false, false
 	}
-	writeSuccessResponse(w, http.StatusOK, ResJson)
+	if fromCookie {
+		return tokenString, true, true
+	}
+
+	tokenString, err = auth.GetBearerToken(r.Header)
+	if err != nil {
+		writeErrorResponse(w, http.StatusUnauthorized, "unauthorized user, no token")
+		return "", false, false
+	}
+	return tokenString, false, true
 }
 
 func UpdateAccessToken(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	tokenString, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		writeErrorResponse(w, http.StatusUnauthorized, "unauthorized user, no token")
+	tokenString, fromCookie, ok := refreshTokenFromRequest(w, r)
+	if !ok {
 		return
 	}
 
@@ -386,6 +609,12 @@ func UpdateAccessToken(api *middleware.ApiConfig, w http.ResponseWriter, r *http
 		return
 	}
 
+	//OAuth client tokens are refreshed through /api/oauth/token and keep their scopes
+	if tokenDetails.ClientID.Valid {
+		writeErrorResponse(w, http.StatusUnauthorized, "unauthorized user, token belongs to an OAuth client")
+		return
+	}
+
 	if tokenDetails.RevokedAt.Valid {
 		writeErrorResponse(w, http.StatusUnauthorized, "unauthorized user, token revoked")
 		return
@@ -396,12 +625,24 @@ func UpdateAccessToken(api *middleware.ApiConfig, w http.ResponseWriter, r *http
 		return
 	}
 
+	tokenVersion, err := api.TokenVersions.Get(r.Context(), tokenDetails.UserID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
 	expiresIn := 1 * time.Hour
-	newAccessToken, err := auth.MakeJWT(tokenDetails.UserID, api.Token, expiresIn)
+	newAccessToken, err := makeAccessToken(api, tokenDetails.UserID, tokenVersion, tokenDetails.DeletionScheduledAt.Valid, expiresIn)
 	if err != nil {
 		writeErrorResponse(w, http.StatusInternalServerError, "access token creation failed")
 		return
 	}
+	if fromCookie {
+		api.SetAccessCookie(w, newAccessToken, expiresIn)
+		writeSuccessResponse(w, http.StatusNoContent, "")
+		return
+	}
 	ResJson := models.Token{
 		Token: newAccessToken,
 	}
@@ -411,13 +652,12 @@ func UpdateAccessToken(api *middleware.ApiConfig, w http.ResponseWriter, r *http
 func RevokeRefreshToken(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	tokenString, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		writeErrorResponse(w, http.StatusUnauthorized, "no token found or incorrect token string")
+	tokenString, fromCookie, ok := refreshTokenFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	err = api.Db.UpdateRefreshToken(r.Context(), database.UpdateRefreshTokenParams{
+	err := api.Db.UpdateRefreshToken(r.Context(), database.UpdateRefreshTokenParams{
 		RevokedAt: sql.NullTime{
 			Time:  time.Now(),
 			Valid: true,
@@ -437,17 +677,52 @@ func RevokeRefreshToken(api *middleware.ApiConfig, w http.ResponseWriter, r *htt
 		return
 	}
 	log.Printf("Token for user '%v' revoked", userID.UserID)
+	if fromCookie {
+		api.ClearSessionCookies(w)
+	}
+	writeSuccessResponse(w, http.StatusNoContent, "")
+}
+
+func RevokeAllSessions(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	err := revokeUserSessions(r.Context(), api, userID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	//the cookies of this browser belong to one of the revoked sessions
+	if _, fromCookie, _ := middleware.SessionCookie(r, middleware.AccessCookie); fromCookie {
+		api.ClearSessionCookies(w)
+	}
+
+	log.Printf("All sessions for user '%v' revoked", userID)
 	writeSuccessResponse(w, http.StatusNoContent, "")
 }
 
+// UpdateUser changes the email, the password or both. Either change needs the
+// current password, so a stolen access token alone can't take over the account.
 func UpdateUser(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
 	type reqParams struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Password        string `json:"password"`
+		Email           string `json:"email"`
+		CurrentPassword string `json:"current_password"`
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
 	params := reqParams{}
 	errDecode := decodeJSONBody(r, &params)
 
@@ -457,148 +732,145 @@ func UpdateUser(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if params.Password == "" || params.Email == "" {
-		writeErrorResponse(w, http.StatusBadRequest, "invalid request both password and email must be updated")
+	if params.Password == "" && params.Email == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "invalid request, email or password must be updated")
 		return
 	}
 
-	newHash, err := auth.HashPassword(params.Password)
-	if err != nil {
-		writeErrorResponse(w, http.StatusInternalServerError, "error hashing password")
+	if params.Email != "" && !validateEmail(params.Email) {
+		writeErrorResponse(w, http.StatusBadRequest, "invalid email submitted")
 		return
 	}
 
-	res, err := api.Db.UpdateUserPasswordEmail(r.Context(), database.UpdateUserPasswordEmailParams{
-		HashedPassword: newHash,
-		Email:          params.Email,
-		UpdatedAt:      time.Now(),
-	})
-
+	userInfo, err := api.Db.GetUser(r.Context(), userID)
 	if err != nil {
 		log.Printf("Error on database: %v", err)
 		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
 		return
 	}
 
-	tokenString, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		writeErrorResponse(w, http.StatusUnauthorized, "missing token")
-		return
+	emailChanged := params.Email != "" && params.Email != userInfo.Email
+	email := userInfo.Email
+	if emailChanged {
+		email = params.Email
 	}
-
-	_, err = auth.ValidateJWT(tokenString, api.Token)
-	if err != nil {
-		writeErrorResponse(w, http.StatusUnauthorized, "invalid token")
+	if params.Password != "" && !checkPasswordPolicy(api, w, params.Password, email) {
 		return
 	}
-
-	resJson := models.User{
-		ID:          res.ID,
-		CreatedAt:   res.CreatedAt,
-		UpdatedAt:   res.UpdatedAt,
-		Email:       res.Email,
-		IsChirpyRed: res.IsChirpyRed.Bool,
-	}
-
-	writeSuccessResponse(w, http.StatusOK, resJson)
-}
-
-func DeleteChirp(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	tokenString, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		writeErrorResponse(w, http.StatusUnauthorized, "missing token")
+	if params.Password == "" && !emailChanged {
+		writeSuccessResponse(w, http.StatusOK, userResponse(userInfo))
 		return
 	}
 
-	userID, err := auth.ValidateJWT(tokenString, api.Token)
-	if err != nil {
-		writeErrorResponse(w, http.StatusUnauthorized, "invalid token")
+	//the current password can be guessed here too, so share the login throttle
+	if wait := loginRetryAfter(api, r, userInfo.Email); wait > 0 {
+		writeTooManyAttempts(w, wait)
 		return
 	}
-
-	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	err = api.Hasher.Check(userInfo.HashedPassword, params.CurrentPassword)
 	if err != nil {
-		log.Printf("Error on database: %v", err)
-		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		recordLoginFailure(api, r, userInfo.Email)
+		writeErrorCode(w, http.StatusForbidden, "invalid_current_password", "current password is incorrect")
 		return
 	}
 
-	chirpDetails, err := api.Db.GetChirp(r.Context(), chirpID)
-	if err != nil {
-		if err == sql.ErrNoRows {
+	if emailChanged {
+		_, err = api.Db.GetUserPassword(r.Context(), params.Email)
+		if err == nil {
+			writeErrorCode(w, http.StatusConflict, "email_taken", "email address is already in use")
+			return
+		}
+		if err != sql.ErrNoRows {
 			log.Printf("Error on database: %v", err)
-			writeErrorResponse(w, http.StatusNotFound, "error: Chirp ID does not exist")
+			writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
 			return
 		}
-		log.Printf("Error on database: %v", err)
-		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
-		return
 	}
 
-	if chirpDetails.UserID != userID {
-		writeErrorResponse(w, http.StatusForbidden, "user not authorized to delete chirp")
-		return
-	}
+	if params.Password != "" {
+		newHash, err := api.Hasher.Hash(params.Password)
+		if err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "error hashing password")
+			return
+		}
 
-	err = api.Db.DeleteChirp(r.Context(), chirpID)
-	if err != nil {
-		log.Printf("Error on database: %v", err)
-		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
-		return
-	}
+		err = api.Db.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			HashedPassword: newHash,
+			UpdatedAt:      time.Now(),
+			ID:             userID,
+		})
+		if err != nil {
+			log.Printf("Error on database: %v", err)
+			writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+			return
+		}
 
-	writeSuccessResponse(w, http.StatusNoContent, "")
+		//password changed, so tokens issued with the old password stop working
+		err = revokeUserSessions(r.Context(), api, userID)
+		if err != nil {
+			log.Printf("Error on database: %v", err)
+			writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+			return
+		}
+		log.Printf("Password changed for user %v", userID)
+	}
+
+	//the current email stays active until the new address is verified
+	if emailChanged {
+		now := time.Now()
+		userInfo.PendingEmail = sql.NullString{String: params.Email, Valid: true}
+		err = inTx(r.Context(), api, func(q *database.Queries) error {
+			//tokens mailed for an earlier request must not confirm it any more
+			err := q.InvalidateEmailVerificationTokens(r.Context(), database.InvalidateEmailVerificationTokensParams{
+				UsedAt: sql.NullTime{
+					Time:  now,
+					Valid: true,
+				},
+				UserID: userID,
+			})
+			if err != nil {
+				return err
+			}
+			err = q.SetUserPendingEmail(r.Context(), database.SetUserPendingEmailParams{
+				PendingEmail: userInfo.PendingEmail,
+				UpdatedAt:    now,
+				ID:           userID,
+			})
+			if err != nil {
+				return err
+			}
+			return sendEmailVerification(r.Context(), api, q, userID, params.Email)
+		})
+		if err != nil {
+			log.Printf("Error on database: %v", err)
+			writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+			return
+		}
+	}
 
+	writeSuccessResponse(w, http.StatusOK, userResponse(userInfo))
 }
 
-func UpdateChirpyRed(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
-	type reqParams struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserID string `json:"user_id"`
-		} `json:"data"`
-	}
-
+func DeleteChirp(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	reqKey, err := auth.GetAPIKey(r.Header)
-	if err != nil {
-		writeErrorResponse(w, http.StatusUnauthorized, "missing ApiKey")
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
-	if reqKey != api.PolkaSecret {
-		writeErrorResponse(w, http.StatusUnauthorized, "invalid ApiKey")
-		return
-	}
-
-	params := reqParams{}
-	errDecode := decodeJSONBody(r, &params)
-
-	if errDecode != nil {
-		log.Printf("Error decoding parameters: %s", errDecode)
-		writeErrorResponse(w, http.StatusBadRequest, "error decoding JSON")
-		return
-	}
-
-	if params.Event != "user.upgraded" {
-		writeErrorResponse(w, http.StatusNoContent, "")
-		return
-	}
-
-	userID, err := uuid.Parse(params.Data.UserID)
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
 		log.Printf("Error on database: %v", err)
 		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
 		return
 	}
-	validUser, err := api.Db.GetUserFromID(r.Context(), userID)
+
+	chirpDetails, err := api.Db.GetChirp(r.Context(), chirpID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Printf("Error on database: %v", err)
-			writeErrorResponse(w, http.StatusNotFound, "error: User ID does not exist")
+			writeErrorResponse(w, http.StatusNotFound, "error: Chirp ID does not exist")
 			return
 		}
 		log.Printf("Error on database: %v", err)
@@ -606,13 +878,29 @@ func UpdateChirpyRed(api *middleware.ApiConfig, w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err = api.Db.UpdateChirpyRed(r.Context(), validUser.ID)
+	if chirpDetails.UserID != userID {
+		writeErrorResponse(w, http.StatusForbidden, "user not authorized to delete chirp")
+		return
+	}
+
+	err = inTx(r.Context(), api, func(q *database.Queries) error {
+		err := q.DeleteChirp(r.Context(), chirpID)
+		if err != nil {
+			return err
+		}
+		//a scheduled chirp deleted before it is published is never announced
+		err = outbox.DiscardPending(r.Context(), q, webhooks.EventChirpCreated, chirpID)
+		if err != nil {
+			return err
+		}
+		return outbox.Record(r.Context(), q, userID, webhooks.EventChirpDeleted, chirpResponse(chirpDetails), time.Now())
+	})
 	if err != nil {
 		log.Printf("Error on database: %v", err)
 		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
 		return
 	}
 
-	log.Printf("User %s upgraded to Chirpy Red.", userID)
 	writeSuccessResponse(w, http.StatusNoContent, "")
+
 }
@@ -0,0 +1,398 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/limiter"
+	"github.com/Walther-Knight/chirpy/internal/mailer"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/google/uuid"
+)
+
+// testMailer hands sent messages to the test.
+type testMailer chan mailer.Message
+
+func (m testMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m <- msg
+	return nil
+}
+
+// newTestAPI returns a config whose database is a sqlmock. Expectations not
+// met by the end of the test fail it.
+func newTestAPI(t *testing.T) (*middleware.ApiConfig, sqlmock.Sqlmock, testMailer) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	hasher, err := auth.NewHasher(auth.HashConfig{Algorithm: auth.AlgorithmBcrypt, BcryptCost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	throttle := func(free int32) *limiter.Limiter {
+		return &limiter.Limiter{Store: limiter.NewMemoryStore(), FreeAttempts: free, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	}
+	mail := make(testMailer, 10)
+	return &middleware.ApiConfig{
+		Db:             database.New(db),
+		Pool:           db,
+		Hasher:         hasher,
+		Mailer:         mail,
+		BaseURL:        "http://localhost:8080",
+		PasswordPolicy: auth.DefaultPasswordPolicy,
+		EmailVerifyTTL: 24 * time.Hour,
+		AccountLimiter: throttle(5),
+		IPLimiter:      throttle(20),
+	}, mock, mail
+}
+
+// withUser authenticates r as a session of userID.
+func withUser(r *http.Request, userID uuid.UUID) *http.Request {
+	principal := &auth.Principal{UserID: userID, Roles: auth.RolesFor(auth.RoleUser), Method: auth.MethodSession}
+	return r.WithContext(auth.WithPrincipal(r.Context(), principal))
+}
+
+var userColumns = []string{"id", "created_at", "updated_at", "email", "hashed_password", "is_chirpy_red", "token_version",
+	"email_verified", "pending_email", "totp_secret", "totp_enabled", "totp_last_step", "role", "locked_at", "deletion_scheduled_at"}
+
+// userRows returns u as the result of a query selecting users.*.
+func userRows(u database.User) *sqlmock.Rows {
+	return sqlmock.NewRows(userColumns).AddRow(u.ID.String(), u.CreatedAt, u.UpdatedAt, u.Email, u.HashedPassword, u.IsChirpyRed,
+		u.TokenVersion, u.EmailVerified, value(u.PendingEmail), value(u.TotpSecret), u.TotpEnabled, u.TotpLastStep, u.Role,
+		value(u.LockedAt), value(u.DeletionScheduledAt))
+}
+
+// queuedMail returns the message of a mail.send job from its captured payload.
+func queuedMail(t *testing.T, payload *capture) mailJob {
+	t.Helper()
+	raw, _ := payload.value.([]byte)
+	msg := mailJob{}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		t.Fatalf("mail job payload %s: %v", raw, err)
+	}
+	return msg
+}
+
+// value converts a nullable column to what the driver would return for it.
+func value(v driver.Valuer) driver.Value {
+	x, _ := v.Value()
+	return x
+}
+
+// capture is a sqlmock argument that matches anything and keeps the value.
+type capture struct {
+	value driver.Value
+}
+
+func (c *capture) Match(v driver.Value) bool {
+	c.value = v
+	return true
+}
+
+func TestRevokeUserSessionsRevokesPersonalAccessTokens(t *testing.T) {
+	api, mock, _ := newTestAPI(t)
+	api.TokenVersions = auth.NewVersionCache(time.Minute, func(ctx context.Context, userID uuid.UUID) (int32, error) {
+		return 0, nil
+	})
+	userID := uuid.New()
+
+	mock.ExpectExec("UPDATE refresh_tokens").WithArgs(sqlmock.AnyArg(), userID).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE personal_access_tokens").WithArgs(sqlmock.AnyArg(), userID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("UPDATE users").WillReturnRows(sqlmock.NewRows([]string{"token_version"}).AddRow(int32(4)))
+
+	if err := revokeUserSessions(context.Background(), api, userID); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := api.TokenVersions.Get(context.Background(), userID); version != 4 {
+		t.Errorf("cached token version = %d, want 4", version)
+	}
+}
+
+func TestRevokeAllSessionsClearsSessionCookies(t *testing.T) {
+	tests := []struct {
+		name        string
+		cookie      bool
+		wantCleared bool
+	}{
+		{"cookie session", true, true},
+		{"bearer token", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, mock, _ := newTestAPI(t)
+			api.TokenVersions = auth.NewVersionCache(time.Minute, func(ctx context.Context, userID uuid.UUID) (int32, error) {
+				return 0, nil
+			})
+			userID := uuid.New()
+			mock.ExpectExec("UPDATE refresh_tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE personal_access_tokens").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery("UPDATE users").WillReturnRows(sqlmock.NewRows([]string{"token_version"}).AddRow(int32(1)))
+
+			r := withUser(httptest.NewRequest(http.MethodPost, "/api/revoke/all", nil), userID)
+			if tt.cookie {
+				r.AddCookie(&http.Cookie{Name: middleware.AccessCookie, Value: "access"})
+				r.AddCookie(&http.Cookie{Name: middleware.CSRFCookie, Value: "csrf"})
+				r.Header.Set(middleware.CSRFHeader, "csrf")
+			} else {
+				r.Header.Set("Authorization", "Bearer access")
+			}
+			w := httptest.NewRecorder()
+			RevokeAllSessions(api, w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if cleared := len(w.Result().Cookies()) == 3; cleared != tt.wantCleared {
+				t.Errorf("Set-Cookie = %v, want cleared %v", w.Result().Cookies(), tt.wantCleared)
+			}
+		})
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	userID := uuid.New()
+	const current = "current-password"
+
+	tests := []struct {
+		name   string
+		body   string
+		expect func(mock sqlmock.Sqlmock)
+		status int
+		code   string
+		// failures counted against the account's login throttle
+		failures int32
+	}{
+		{
+			name: "password only",
+			body: `{"password":"new-password-123","current_password":"current-password"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE users").WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), userID).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE refresh_tokens").WithArgs(sqlmock.AnyArg(), userID).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE personal_access_tokens").WithArgs(sqlmock.AnyArg(), userID).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("UPDATE users").WillReturnRows(sqlmock.NewRows([]string{"token_version"}).AddRow(int32(1)))
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "email only",
+			body: `{"email":"new@example.com","current_password":"current-password"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("FROM users").WithArgs("new@example.com").WillReturnError(sql.ErrNoRows)
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE email_verification_tokens").WithArgs(sqlmock.AnyArg(), userID).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("UPDATE users").WithArgs("new@example.com", sqlmock.AnyArg(), userID).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO email_verification_tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO jobs").WithArgs(sqlmock.AnyArg(), jobSendMail, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:     "missing current password",
+			body:     `{"password":"new-password-123"}`,
+			status:   http.StatusForbidden,
+			code:     "invalid_current_password",
+			failures: 1,
+		},
+		{
+			name:     "wrong current password",
+			body:     `{"email":"new@example.com","current_password":"guess"}`,
+			status:   http.StatusForbidden,
+			code:     "invalid_current_password",
+			failures: 1,
+		},
+		{
+			name: "email taken",
+			body: `{"email":"taken@example.com","current_password":"current-password"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("FROM users").WithArgs("taken@example.com").
+					WillReturnRows(userRows(database.User{ID: uuid.New(), Email: "taken@example.com", Role: auth.RoleUser}))
+			},
+			status: http.StatusConflict,
+			code:   "email_taken",
+		},
+		{
+			//the row is picked by the caller's token, an id in the body is ignored.
+			//The expectations above only accept the caller's id, any other fails the test
+			name: "id in the body",
+			body: `{"id":"` + uuid.NewString() + `","password":"new-password-123","current_password":"current-password"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE users").WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), userID).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE refresh_tokens").WithArgs(sqlmock.AnyArg(), userID).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE personal_access_tokens").WithArgs(sqlmock.AnyArg(), userID).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("UPDATE users").WithArgs(sqlmock.AnyArg(), userID).WillReturnRows(sqlmock.NewRows([]string{"token_version"}).AddRow(int32(1)))
+			},
+			status: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, mock, _ := newTestAPI(t)
+			api.TokenVersions = auth.NewVersionCache(time.Minute, func(ctx context.Context, userID uuid.UUID) (int32, error) {
+				return 0, nil
+			})
+			hash, err := api.Hasher.Hash(current)
+			if err != nil {
+				t.Fatal(err)
+			}
+			user := database.User{ID: userID, Email: "old@example.com", HashedPassword: hash, EmailVerified: true, Role: auth.RoleUser}
+			mock.ExpectQuery("FROM users").WithArgs(userID).WillReturnRows(userRows(user))
+			if tt.expect != nil {
+				tt.expect(mock)
+			}
+
+			r := withUser(httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(tt.body)), userID)
+			w := httptest.NewRecorder()
+			UpdateUser(api, w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.code != "" && !strings.Contains(w.Body.String(), `"code":"`+tt.code+`"`) {
+				t.Errorf("body = %s, want code %s", w.Body, tt.code)
+			}
+			record, _ := api.AccountLimiter.Store.Get(context.Background(), accountThrottleKey(user.Email))
+			if record.Failures != tt.failures {
+				t.Errorf("login throttle counted %d failures, want %d", record.Failures, tt.failures)
+			}
+		})
+	}
+}
+
+func TestForgotPasswordThrottle(t *testing.T) {
+	api, mock, _ := newTestAPI(t)
+	const email = "nobody@example.com"
+	forgot := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ForgotPassword(api, w, httptest.NewRequest(http.MethodPost, "/api/password/forgot", strings.NewReader(`{"email":"`+email+`"}`)))
+		return w
+	}
+
+	for i := range api.AccountLimiter.FreeAttempts {
+		mock.ExpectQuery("FROM users").WithArgs(email).WillReturnError(sql.ErrNoRows)
+		if w := forgot(); w.Code != http.StatusNoContent {
+			t.Fatalf("request %d: status = %d: %s", i+1, w.Code, w.Body)
+		}
+	}
+	w := forgot()
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("status = %d, Retry-After %q, want 429 with a wait", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	//reset requests must not lock the owner out of logging in
+	r := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	if wait := loginRetryAfter(api, r, email); wait != 0 {
+		t.Errorf("login wait = %v, want none", wait)
+	}
+}
+
+func TestForgotPasswordQueuesMailWithToken(t *testing.T) {
+	api, mock, _ := newTestAPI(t)
+	now := time.Now()
+	user := database.User{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Email: "known@example.com", EmailVerified: true, Role: "user"}
+
+	mock.ExpectQuery("FROM users").WithArgs(user.Email).WillReturnRows(userRows(user))
+	hash, payload := &capture{}, &capture{}
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO password_reset_tokens").
+		WithArgs(hash, user.ID, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO jobs").
+		WithArgs(sqlmock.AnyArg(), jobSendMail, payload, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	ForgotPassword(api, w, httptest.NewRequest(http.MethodPost, "/api/password/forgot", strings.NewReader(`{"email":"known@example.com"}`)))
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	msg := queuedMail(t, payload)
+	if msg.To != user.Email {
+		t.Errorf("mail sent to %q", msg.To)
+	}
+	lines := strings.Split(msg.Body, "\n")
+	if len(lines) < 5 || auth.HashToken(lines[4]) != hash.value {
+		t.Errorf("queued mail does not carry the stored token:\n%s", msg.Body)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		trust     bool
+		forwarded []string
+		want      string
+	}{
+		{"remote address", false, nil, "192.0.2.1"},
+		{"forwarded header ignored", false, []string{"203.0.113.9"}, "192.0.2.1"},
+		{"entry added by the proxy", true, []string{"203.0.113.9"}, "203.0.113.9"},
+		{"client supplied entries", true, []string{"198.51.100.7, 203.0.113.9"}, "203.0.113.9"},
+		{"header repeated", true, []string{"198.51.100.7", "203.0.113.9"}, "203.0.113.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, _, _ := newTestAPI(t)
+			api.TrustProxyHeaders = tt.trust
+			r := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+			r.RemoteAddr = "192.0.2.1:4242"
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := clientIP(api, r); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserLoginMFAChallengeKeepsFailures(t *testing.T) {
+	api, mock, _ := newTestAPI(t)
+	api.Token = "secret"
+	hash, err := api.Hasher.Hash("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	user := database.User{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Email: "mfa@example.com", HashedPassword: hash,
+		EmailVerified: true, TotpSecret: sql.NullString{String: "JBSWY3DPEHPK3PXP", Valid: true}, TotpEnabled: true, Role: "user"}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"email":"mfa@example.com","password":"correct horse battery"}`))
+	recordLoginFailure(api, r, user.Email)
+	mock.ExpectQuery("FROM users").WithArgs(user.Email).WillReturnRows(userRows(user))
+	mock.ExpectExec("INSERT INTO login_attempts").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := httptest.NewRecorder()
+	UserLogin(api, w, r)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "mfa_token") {
+		t.Fatalf("status = %d: %s, want an mfa challenge", w.Code, w.Body)
+	}
+	rec, _ := api.AccountLimiter.Store.Get(context.Background(), accountThrottleKey(user.Email))
+	if rec.Failures != 1 {
+		t.Errorf("account failures = %d, want 1 until the second factor is accepted", rec.Failures)
+	}
+}
@@ -0,0 +1,357 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/billing"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/Walther-Knight/chirpy/internal/models"
+	"github.com/Walther-Knight/chirpy/internal/subscription"
+	"github.com/google/uuid"
+)
+
+const maxWebhookBodyBytes = 1 << 20
+
+// webhookRetryWindow is how long a delivery without an event id counts as a
+// retry of an earlier one with the same body.
+const webhookRetryWindow = 10 * time.Minute
+
+var (
+	errWebhookIgnored      = errors.New("event type is not handled")
+	errWebhookHandled      = errors.New("event was already handled")
+	errBillingUserNotFound = errors.New("user does not exist")
+)
+
+// BillingWebhook stores every delivery from a payment provider before
+// processing it. Providers retry until they get a 2xx, so a delivery that was
+// already processed is acknowledged without applying it twice.
+func BillingWebhook(api *middleware.ApiConfig, provider billing.Provider, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
+	if err != nil {
+		log.Printf("Error reading webhook body: %v", err)
+		writeErrorResponse(w, http.StatusBadRequest, "error reading body")
+		return
+	}
+
+	err = provider.VerifyWebhook(r.Header, body)
+	if err != nil {
+		log.Printf("Rejected %s webhook: %v", provider.Name(), err)
+		writeErrorCode(w, http.StatusUnauthorized, "invalid_signature", "webhook could not be authenticated")
+		return
+	}
+
+	params, err := provider.ParseEvent(body)
+	//an unknown user is stored like any other failure so it can be replayed
+	if err != nil && !errors.Is(err, billing.ErrUnknownUser) {
+		log.Printf("Error decoding parameters: %s", err)
+		writeErrorResponse(w, http.StatusBadRequest, "error decoding JSON")
+		return
+	}
+
+	receivedAt := time.Now()
+	if params.ID == "" {
+		//without an id a retry is only recognised by its body, and only for a
+		//short while so a later upgrade or renewal with the same body still applies
+		previous, err := api.Db.GetRecentWebhookEventByPayload(r.Context(), database.GetRecentWebhookEventByPayloadParams{
+			Provider:   provider.Name(),
+			Payload:    body,
+			ReceivedAt: receivedAt.Add(-webhookRetryWindow),
+		})
+		if err == nil {
+			params.ID = previous.EventID
+		} else if err == sql.ErrNoRows {
+			sum := sha256.Sum256(body)
+			params.ID = fmt.Sprintf("sha256:%x:%d", sum, receivedAt.UnixNano())
+		} else {
+			log.Printf("Error on database: %v", err)
+			writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+			return
+		}
+	}
+
+	event, err := api.Db.CreateWebhookEvent(r.Context(), database.CreateWebhookEventParams{
+		ID:         uuid.New(),
+		Provider:   provider.Name(),
+		EventID:    params.ID,
+		EventType:  params.Type,
+		Payload:    body,
+		ReceivedAt: receivedAt,
+	})
+	if err == sql.ErrNoRows {
+		event, err = api.Db.GetWebhookEventByEventID(r.Context(), database.GetWebhookEventByEventIDParams{
+			Provider: provider.Name(),
+			EventID:  params.ID,
+		})
+		if err == nil && (event.Status == "processed" || event.Status == "ignored") {
+			log.Printf("Duplicate webhook event %s ignored", params.ID)
+			writeSuccessResponse(w, http.StatusNoContent, "")
+			return
+		}
+	}
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	err = processWebhookEvent(r.Context(), api, event.ID, "received", "failed")
+	if errors.Is(err, errWebhookHandled) {
+		log.Printf("Duplicate webhook event %s ignored", params.ID)
+		writeSuccessResponse(w, http.StatusNoContent, "")
+		return
+	}
+	if err != nil {
+		if errors.Is(err, errBillingUserNotFound) {
+			writeErrorResponse(w, http.StatusNotFound, "error: User ID does not exist")
+			return
+		}
+		if errors.Is(err, subscription.ErrNoSubscription) {
+			writeErrorResponse(w, http.StatusNotFound, "error: user has no subscription")
+			return
+		}
+		log.Printf("Error processing webhook event %s: %v", params.ID, err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	writeSuccessResponse(w, http.StatusNoContent, "")
+}
+
+// processWebhookEvent applies a stored event and records the outcome on it.
+// The event is locked in the transaction that changes the subscription and is
+// only applied while its status is one of claimable, so concurrent retries and
+// replays apply it at most once.
+func processWebhookEvent(ctx context.Context, api *middleware.ApiConfig, id uuid.UUID, claimable ...string) error {
+	err := inTx(ctx, api, func(q *database.Queries) error {
+		event, err := q.GetWebhookEventForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(claimable, event.Status) {
+			return errWebhookHandled
+		}
+
+		status := "processed"
+		err = applyBillingEvent(ctx, api, q, event)
+		if errors.Is(err, errWebhookIgnored) {
+			status = "ignored"
+		} else if err != nil {
+			return err
+		}
+		return q.FinishWebhookEvent(ctx, database.FinishWebhookEventParams{
+			Status: status,
+			ProcessedAt: sql.NullTime{
+				Time:  time.Now(),
+				Valid: true,
+			},
+			ID: id,
+		})
+	})
+	if err == nil || errors.Is(err, errWebhookHandled) {
+		return err
+	}
+
+	//the change was rolled back, the failure is not recorded if a concurrent
+	//delivery has processed the event meanwhile
+	errFinish := api.Db.FinishWebhookEvent(ctx, database.FinishWebhookEventParams{
+		Status: "failed",
+		Error:  sql.NullString{String: err.Error(), Valid: true},
+		ProcessedAt: sql.NullTime{
+			Time:  time.Now(),
+			Valid: true,
+		},
+		ID: id,
+	})
+	if errFinish != nil {
+		log.Printf("Error recording failure of webhook event %v: %v", id, errFinish)
+	}
+	return err
+}
+
+func applyBillingEvent(ctx context.Context, api *middleware.ApiConfig, q *database.Queries, stored database.WebhookEvent) error {
+	provider, ok := api.Billing[stored.Provider]
+	if !ok {
+		return fmt.Errorf("billing provider %q is not configured", stored.Provider)
+	}
+	params, err := provider.ParseEvent(stored.Payload)
+	if errors.Is(err, billing.ErrUnknownUser) {
+		return errBillingUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = q.GetUserFromID(ctx, params.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errBillingUserNotFound
+		}
+		return err
+	}
+
+	event := subscription.Event{
+		Type:      params.Type,
+		Plan:      params.Plan,
+		PeriodEnd: params.PeriodEnd,
+	}
+	next, err := applySubscriptionEvent(ctx, api, q, params.UserID, event)
+	if errors.Is(err, subscription.ErrUnknownEvent) {
+		return errWebhookIgnored
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Subscription of user %s is %s until %v after %s", params.UserID, next.Status, next.CurrentPeriodEnd, event.Type)
+	return nil
+}
+
+// StartCheckout sends the user to the payment provider to subscribe.
+func StartCheckout(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	type reqParams struct {
+		Plan string `json:"plan"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	params := reqParams{}
+	errDecode := decodeJSONBody(r, &params)
+
+	if errDecode != nil {
+		log.Printf("Error decoding parameters: %s", errDecode)
+		writeErrorResponse(w, http.StatusBadRequest, "error decoding JSON")
+		return
+	}
+	if params.Plan == "" {
+		params.Plan = subscription.PlanRed
+	}
+
+	provider, ok := api.Billing[api.CheckoutProvider]
+	if !ok {
+		writeErrorCode(w, http.StatusServiceUnavailable, "checkout_unavailable", "payments are not configured")
+		return
+	}
+	checkoutURL, err := provider.StartCheckout(r.Context(), userID, params.Plan, api.BaseURL+"/app/")
+	if err != nil {
+		if errors.Is(err, billing.ErrCheckoutUnavailable) {
+			writeErrorCode(w, http.StatusServiceUnavailable, "checkout_unavailable", "payments are not configured")
+			return
+		}
+		log.Printf("Error starting %s checkout: %v", provider.Name(), err)
+		writeErrorResponse(w, http.StatusBadGateway, "payment provider error")
+		return
+	}
+
+	log.Printf("Checkout for plan %s started for user %v", params.Plan, userID)
+	writeSuccessResponse(w, http.StatusOK, models.Checkout{CheckoutURL: checkoutURL})
+}
+
+func webhookEventResponse(e database.WebhookEvent) models.WebhookEvent {
+	res := models.WebhookEvent{
+		ID:         e.ID,
+		Provider:   e.Provider,
+		EventID:    e.EventID,
+		EventType:  e.EventType,
+		Payload:    e.Payload,
+		Status:     e.Status,
+		Error:      e.Error.String,
+		Attempts:   e.Attempts,
+		ReceivedAt: e.ReceivedAt,
+	}
+	if e.ProcessedAt.Valid {
+		res.ProcessedAt = &e.ProcessedAt.Time
+	}
+	return res
+}
+
+func ListWebhookEvents(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit := int32(100)
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 500 {
+		limit = int32(n)
+	}
+
+	var res []database.WebhookEvent
+	var err error
+	if status := r.URL.Query().Get("status"); status != "" {
+		res, err = api.Db.ListWebhookEventsByStatus(r.Context(), database.ListWebhookEventsByStatusParams{
+			Status: status,
+			Limit:  limit,
+		})
+	} else {
+		res, err = api.Db.ListWebhookEvents(r.Context(), limit)
+	}
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	ResJson := []models.WebhookEvent{}
+	for _, event := range res {
+		ResJson = append(ResJson, webhookEventResponse(event))
+	}
+	writeSuccessResponse(w, http.StatusOK, ResJson)
+}
+
+// ReplayWebhookEvent processes a failed event again, typically one that
+// failed because the user did not exist yet or the database was down. Events
+// that were processed or ignored are never applied a second time.
+func ReplayWebhookEvent(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "error: webhook event does not exist")
+		return
+	}
+
+	event, err := api.Db.GetWebhookEvent(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(w, http.StatusNotFound, "error: webhook event does not exist")
+			return
+		}
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	if event.Status != "failed" {
+		writeErrorCode(w, http.StatusConflict, "webhook_event_not_failed", "only failed webhook events can be replayed")
+		return
+	}
+
+	err = processWebhookEvent(r.Context(), api, event.ID, "failed")
+	if err != nil {
+		//the failure is recorded on the event and returned below, a
+		//concurrent replay's outcome likewise
+		log.Printf("Replay of webhook event %v failed: %v", id, err)
+	}
+
+	event, err = api.Db.GetWebhookEvent(r.Context(), id)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	log.Printf("Webhook event %v replayed: %s", id, event.Status)
+	writeSuccessResponse(w, http.StatusOK, webhookEventResponse(event))
+}
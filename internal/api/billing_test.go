@@ -0,0 +1,251 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Walther-Knight/chirpy/internal/billing"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/google/uuid"
+)
+
+var webhookEventColumns = []string{"id", "provider", "event_id", "event_type", "payload", "status", "error", "attempts", "received_at", "processed_at"}
+
+// webhookEventRows returns e as the result of a query selecting webhook_events.*.
+func webhookEventRows(e database.WebhookEvent) *sqlmock.Rows {
+	return sqlmock.NewRows(webhookEventColumns).AddRow(e.ID.String(), e.Provider, e.EventID, e.EventType, []byte(e.Payload),
+		e.Status, value(e.Error), e.Attempts, e.ReceivedAt, value(e.ProcessedAt))
+}
+
+func newBillingTestAPI(t *testing.T) (*middleware.ApiConfig, sqlmock.Sqlmock) {
+	t.Helper()
+	api, mock, _ := newTestAPI(t)
+	api.Billing = map[string]billing.Provider{"polka": &billing.Polka{APIKey: "secret"}}
+	api.SubscriptionPeriod = 30 * 24 * time.Hour
+	return api, mock
+}
+
+// expectClaim expects event to be locked for processing.
+func expectClaim(mock sqlmock.Sqlmock, event database.WebhookEvent) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhook_events\nWHERE id = $1\nFOR UPDATE")).WithArgs(event.ID).WillReturnRows(webhookEventRows(event))
+}
+
+// expectUpgrade expects a claimed user.upgraded event for a user without a
+// subscription to be applied and recorded as processed.
+func expectUpgrade(mock sqlmock.Sqlmock, userID uuid.UUID) {
+	mock.ExpectQuery("FROM users").WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "is_chirpy_red"}).AddRow(userID.String(), "red@example.com", false))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM subscriptions\nWHERE user_id = $1\nFOR UPDATE")).WithArgs(userID).WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec("INSERT INTO subscriptions").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE webhook_events").WithArgs("processed", nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func polkaWebhook(body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/polka/webhooks", strings.NewReader(body))
+	r.Header.Set("Authorization", "ApiKey secret")
+	return r
+}
+
+func TestBillingWebhook(t *testing.T) {
+	userID := uuid.New()
+	withID := `{"id":"evt_1","event":"user.upgraded","data":{"user_id":"` + userID.String() + `"}}`
+	withoutID := `{"event":"user.upgraded","data":{"user_id":"` + userID.String() + `"}}`
+	stored := func(eventID, body, status string) database.WebhookEvent {
+		return database.WebhookEvent{ID: uuid.New(), Provider: "polka", EventID: eventID, EventType: "user.upgraded",
+			Payload: []byte(body), Status: status, ReceivedAt: time.Now().Add(-time.Minute)}
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name: "new event is stored and applied",
+			body: withID,
+			expect: func(mock sqlmock.Sqlmock) {
+				event := stored("evt_1", withID, "received")
+				mock.ExpectQuery("INSERT INTO webhook_events").
+					WithArgs(sqlmock.AnyArg(), "polka", "evt_1", "user.upgraded", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(webhookEventRows(event))
+				expectClaim(mock, event)
+				expectUpgrade(mock, userID)
+			},
+		},
+		{
+			name: "retry of a processed event",
+			body: withID,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("INSERT INTO webhook_events").WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery("FROM webhook_events").WithArgs("polka", "evt_1").
+					WillReturnRows(webhookEventRows(stored("evt_1", withID, "processed")))
+			},
+		},
+		{
+			name: "retry of a failed event is applied again",
+			body: withID,
+			expect: func(mock sqlmock.Sqlmock) {
+				event := stored("evt_1", withID, "failed")
+				mock.ExpectQuery("INSERT INTO webhook_events").WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery("FROM webhook_events").WithArgs("polka", "evt_1").WillReturnRows(webhookEventRows(event))
+				expectClaim(mock, event)
+				expectUpgrade(mock, userID)
+			},
+		},
+		{
+			//the concurrent delivery holding the lock has processed it meanwhile
+			name: "concurrent retry of an event in progress",
+			body: withID,
+			expect: func(mock sqlmock.Sqlmock) {
+				event := stored("evt_1", withID, "received")
+				mock.ExpectQuery("INSERT INTO webhook_events").WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery("FROM webhook_events").WithArgs("polka", "evt_1").WillReturnRows(webhookEventRows(event))
+				event.Status = "processed"
+				expectClaim(mock, event)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "same body without an id within the retry window",
+			body: withoutID,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("FROM webhook_events").WithArgs("polka", []byte(withoutID), sqlmock.AnyArg()).
+					WillReturnRows(webhookEventRows(stored("sha256:abc:1", withoutID, "processed")))
+				mock.ExpectQuery("INSERT INTO webhook_events").
+					WithArgs(sqlmock.AnyArg(), "polka", "sha256:abc:1", "user.upgraded", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery("FROM webhook_events").WithArgs("polka", "sha256:abc:1").
+					WillReturnRows(webhookEventRows(stored("sha256:abc:1", withoutID, "processed")))
+			},
+		},
+		{
+			//a later upgrade or renewal has the same body as the first one
+			name: "same body without an id after the retry window",
+			body: withoutID,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("FROM webhook_events").WithArgs("polka", []byte(withoutID), sqlmock.AnyArg()).
+					WillReturnError(sql.ErrNoRows)
+				event := stored("sha256:abc:2", withoutID, "received")
+				mock.ExpectQuery("INSERT INTO webhook_events").
+					WithArgs(sqlmock.AnyArg(), "polka", sqlmock.AnyArg(), "user.upgraded", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(webhookEventRows(event))
+				expectClaim(mock, event)
+				expectUpgrade(mock, userID)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, mock := newBillingTestAPI(t)
+			tt.expect(mock)
+
+			w := httptest.NewRecorder()
+			BillingWebhook(api, api.Billing["polka"], w, polkaWebhook(tt.body))
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestBillingWebhookRetryWindow(t *testing.T) {
+	api, mock := newBillingTestAPI(t)
+	body := `{"event":"user.upgraded","data":{"user_id":"` + uuid.NewString() + `"}}`
+	since, eventID := &capture{}, &capture{}
+	mock.ExpectQuery("FROM webhook_events").WithArgs("polka", []byte(body), since).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("INSERT INTO webhook_events").
+		WithArgs(sqlmock.AnyArg(), "polka", eventID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnError(sql.ErrConnDone)
+
+	before := time.Now()
+	BillingWebhook(api, api.Billing["polka"], httptest.NewRecorder(), polkaWebhook(body))
+
+	if at, ok := since.value.(time.Time); !ok || at.After(before.Add(-webhookRetryWindow+time.Second)) || at.Before(before.Add(-webhookRetryWindow)) {
+		t.Errorf("looked for retries since %v, want %v before now", since.value, webhookRetryWindow)
+	}
+	if id, _ := eventID.value.(string); !strings.HasPrefix(id, "sha256:") {
+		t.Errorf("stored event id %q, want one derived from the body", id)
+	}
+}
+
+func TestReplayWebhookEvent(t *testing.T) {
+	api, mock := newBillingTestAPI(t)
+	userID := uuid.New()
+	event := database.WebhookEvent{ID: uuid.New(), Provider: "polka", EventID: "evt_1", EventType: "user.upgraded",
+		Payload: []byte(`{"id":"evt_1","event":"user.upgraded","data":{"user_id":"` + userID.String() + `"}}`),
+		Status:  "failed", Error: sql.NullString{String: errBillingUserNotFound.Error(), Valid: true}, Attempts: 1, ReceivedAt: time.Now()}
+
+	mock.ExpectQuery("FROM webhook_events").WithArgs(event.ID).WillReturnRows(webhookEventRows(event))
+	expectClaim(mock, event)
+	expectUpgrade(mock, userID)
+	replayed := event
+	replayed.Status, replayed.Error, replayed.Attempts = "processed", sql.NullString{}, 2
+	mock.ExpectQuery("FROM webhook_events").WithArgs(event.ID).WillReturnRows(webhookEventRows(replayed))
+
+	r := httptest.NewRequest(http.MethodPost, "/admin/webhooks/"+event.ID.String()+"/replay", nil)
+	r.SetPathValue("id", event.ID.String())
+	w := httptest.NewRecorder()
+	ReplayWebhookEvent(api, w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), `"status":"processed"`) {
+		t.Errorf("body = %s, want the processed event", w.Body)
+	}
+}
+
+func TestReplayWebhookEventRefusesHandledEvents(t *testing.T) {
+	for _, status := range []string{"processed", "ignored", "received"} {
+		t.Run(status, func(t *testing.T) {
+			api, mock := newBillingTestAPI(t)
+			event := database.WebhookEvent{ID: uuid.New(), Provider: "polka", EventID: "evt_1", EventType: "user.upgraded",
+				Payload: []byte(`{"id":"evt_1","event":"user.upgraded","data":{"user_id":"` + uuid.NewString() + `"}}`),
+				Status:  status, Attempts: 1, ReceivedAt: time.Now()}
+			mock.ExpectQuery("FROM webhook_events").WithArgs(event.ID).WillReturnRows(webhookEventRows(event))
+
+			r := httptest.NewRequest(http.MethodPost, "/admin/webhooks/"+event.ID.String()+"/replay", nil)
+			r.SetPathValue("id", event.ID.String())
+			w := httptest.NewRecorder()
+			ReplayWebhookEvent(api, w, r)
+
+			if w.Code != http.StatusConflict {
+				t.Errorf("status = %d: %s, want 409", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestProcessWebhookEventRecordsFailure(t *testing.T) {
+	api, mock := newBillingTestAPI(t)
+	userID := uuid.New()
+	event := database.WebhookEvent{ID: uuid.New(), Provider: "polka", EventID: "evt_1", EventType: "user.upgraded",
+		Payload: []byte(`{"id":"evt_1","event":"user.upgraded","data":{"user_id":"` + userID.String() + `"}}`),
+		Status:  "received", ReceivedAt: time.Now()}
+
+	expectClaim(mock, event)
+	mock.ExpectQuery("FROM users").WithArgs(userID).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	mock.ExpectExec(regexp.QuoteMeta("WHERE id = $4 AND status IN ('received', 'failed')")).
+		WithArgs("failed", errBillingUserNotFound.Error(), sqlmock.AnyArg(), event.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := processWebhookEvent(context.Background(), api, event.ID, "received", "failed")
+	if !errors.Is(err, errBillingUserNotFound) {
+		t.Errorf("processWebhookEvent() = %v, want %v", err, errBillingUserNotFound)
+	}
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/entitlements"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/Walther-Knight/chirpy/internal/models"
+	"github.com/Walther-Knight/chirpy/internal/outbox"
+	"github.com/Walther-Knight/chirpy/internal/webhooks"
+	"github.com/google/uuid"
+)
+
+const (
+	chirpMaxLength = 140
+	// with the long_chirps entitlement
+	longChirpMaxLength = 500
+	// with the edit_chirps entitlement a chirp can be edited this long after it is published
+	chirpEditWindow  = 15 * time.Minute
+	maxScheduleAhead = 30 * 24 * time.Hour
+)
+
+func chirpResponse(c database.Chirp) models.Chirp {
+	return models.Chirp{
+		ID:          c.ID.String(),
+		CreatedAt:   c.CreatedAt,
+		UpdatedAt:   c.UpdatedAt,
+		PublishedAt: c.PublishAt,
+		Body:        c.Body,
+		UserID:      c.UserID.String(),
+	}
+}
+
+// requireEntitlement writes 403 entitlement_required unless userID has feature.
+func requireEntitlement(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request, userID uuid.UUID, feature string) bool {
+	ok, err := api.Entitlements.Has(r.Context(), userID, feature)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return false
+	}
+	if !ok {
+		writeErrorCode(w, http.StatusForbidden, "entitlement_required", fmt.Sprintf("your plan does not include %s, upgrade to Chirpy Red", feature))
+		return false
+	}
+	return true
+}
+
+// validateChirpBody enforces the length limit of the author's plan.
+func validateChirpBody(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request, userID uuid.UUID, body string) bool {
+	if body == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "Chirp must contain characters")
+		return false
+	}
+	if len(body) <= chirpMaxLength {
+		return true
+	}
+
+	long, err := api.Entitlements.Has(r.Context(), userID, entitlements.FeatureLongChirps)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return false
+	}
+	if !long || len(body) > longChirpMaxLength {
+		writeErrorResponse(w, http.StatusBadRequest, "Chirp is too long")
+		return false
+	}
+	return true
+}
+
+func UpdateChirp(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	type reqParams struct {
+		Body string `json:"body"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "error: Chirp ID does not exist")
+		return
+	}
+
+	chirpDetails, err := api.Db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(w, http.StatusNotFound, "error: Chirp ID does not exist")
+			return
+		}
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	if chirpDetails.UserID != userID {
+		writeErrorResponse(w, http.StatusForbidden, "user not authorized to edit chirp")
+		return
+	}
+
+	if !requireEntitlement(api, w, r, userID, entitlements.FeatureEditChirps) {
+		return
+	}
+	//scheduled chirps can be edited until the window after publishing closes
+	if time.Now().After(chirpDetails.PublishAt.Add(chirpEditWindow)) {
+		writeErrorCode(w, http.StatusForbidden, "edit_window_closed", fmt.Sprintf("chirps can only be edited within %v of publishing", chirpEditWindow))
+		return
+	}
+
+	params := reqParams{}
+	errDecode := decodeJSONBody(r, &params)
+
+	if errDecode != nil {
+		log.Printf("Error decoding parameters: %s", errDecode)
+		writeErrorResponse(w, http.StatusBadRequest, "error decoding JSON")
+		return
+	}
+
+	if !validateChirpBody(api, w, r, userID, params.Body) {
+		return
+	}
+
+	var res database.Chirp
+	err = inTx(r.Context(), api, func(q *database.Queries) error {
+		res, err = q.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+			Body:      profanityFilter(params.Body),
+			UpdatedAt: time.Now(),
+			ID:        chirpID,
+		})
+		if err != nil {
+			return err
+		}
+		//a scheduled chirp is announced with the body it has when published
+		return outbox.ReplacePending(r.Context(), q, webhooks.EventChirpCreated, chirpID, chirpResponse(res))
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	writeSuccessResponse(w, http.StatusOK, chirpResponse(res))
+}
+
+func ListScheduledChirps(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := api.Db.ListScheduledChirps(r.Context(), database.ListScheduledChirpsParams{
+		UserID:    userID,
+		PublishAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	ResJson := []models.Chirp{}
+	for _, chirp := range res {
+		ResJson = append(ResJson, chirpResponse(chirp))
+	}
+	writeSuccessResponse(w, http.StatusOK, ResJson)
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/entitlements"
+	"github.com/Walther-Knight/chirpy/internal/subscription"
+	"github.com/Walther-Knight/chirpy/internal/webhooks"
+	"github.com/google/uuid"
+)
+
+var chirpColumns = []string{"id", "created_at", "updated_at", "body", "user_id", "publish_at"}
+
+// chirpRows returns c as the result of a query selecting chirps.*.
+func chirpRows(c database.Chirp) *sqlmock.Rows {
+	return sqlmock.NewRows(chirpColumns).AddRow(c.ID.String(), c.CreatedAt, c.UpdatedAt, c.Body, c.UserID.String(), c.PublishAt)
+}
+
+// scheduledChirp returns a chirp of userID published in an hour.
+func scheduledChirp(userID uuid.UUID) database.Chirp {
+	now := time.Now()
+	return database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "see you soon", UserID: userID, PublishAt: now.Add(time.Hour)}
+}
+
+func TestDeleteChirpDiscardsPendingCreatedEvent(t *testing.T) {
+	api, mock, _ := newTestAPI(t)
+	chirp := scheduledChirp(uuid.New())
+
+	mock.ExpectQuery("FROM chirps").WithArgs(chirp.ID).WillReturnRows(chirpRows(chirp))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM chirps").WithArgs(chirp.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM outbox_events").WithArgs(webhooks.EventChirpCreated, chirp.ID.String()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").
+		WithArgs(sqlmock.AnyArg(), chirp.UserID, webhooks.EventChirpDeleted, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	r := withUser(httptest.NewRequest(http.MethodDelete, "/api/chirps/"+chirp.ID.String(), nil), chirp.UserID)
+	r.SetPathValue("chirpID", chirp.ID.String())
+	w := httptest.NewRecorder()
+	DeleteChirp(api, w, r)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestUpdateChirpReplacesPendingCreatedEvent(t *testing.T) {
+	api, mock, _ := newTestAPI(t)
+	api.Entitlements = entitlements.NewChecker(entitlements.DefaultPlans, func(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+		return database.Subscription{UserID: userID, Plan: subscription.PlanRed, Status: subscription.StatusActive, CurrentPeriodEnd: time.Now().Add(time.Hour)}, nil
+	})
+	chirp := scheduledChirp(uuid.New())
+	edited := chirp
+	edited.Body = "see you later"
+
+	payload := &capture{}
+	mock.ExpectQuery("FROM chirps").WithArgs(chirp.ID).WillReturnRows(chirpRows(chirp))
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE chirps").WithArgs(edited.Body, sqlmock.AnyArg(), chirp.ID).WillReturnRows(chirpRows(edited))
+	mock.ExpectExec("UPDATE outbox_events").WithArgs(payload, webhooks.EventChirpCreated, chirp.ID.String()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	r := withUser(httptest.NewRequest(http.MethodPut, "/api/chirps/"+chirp.ID.String(), strings.NewReader(`{"body":"see you later"}`)), chirp.UserID)
+	r.SetPathValue("chirpID", chirp.ID.String())
+	w := httptest.NewRecorder()
+	UpdateChirp(api, w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	data := struct {
+		ID   uuid.UUID `json:"id"`
+		Body string    `json:"body"`
+	}{}
+	raw, _ := payload.value.([]byte)
+	if err := json.Unmarshal(raw, &data); err != nil || data.ID != chirp.ID || data.Body != edited.Body {
+		t.Errorf("pending chirp.created payload = %s, want the edited chirp", raw)
+	}
+}
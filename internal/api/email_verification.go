@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/mailer"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// sendEmailVerification stores a hashed verification token for email and
+// mails the plaintext token to that address.
+func sendEmailVerification(ctx context.Context, api *middleware.ApiConfig, q *database.Queries, userID uuid.UUID, email string) error {
+	verifyToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	err = q.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(verifyToken),
+		UserID:    userID,
+		Email:     email,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(api.EmailVerifyTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendMail(ctx, q, mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Confirm this address for your Chirpy account by sending this token to POST %s/api/email/verify:\n\n%s\n\n"+
+			"The token expires in %v.",
+			api.BaseURL, verifyToken, api.EmailVerifyTTL),
+	})
+}
+
+func VerifyEmail(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	type reqParams struct {
+		Token string `json:"token"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	params := reqParams{}
+	errDecode := decodeJSONBody(r, &params)
+
+	if errDecode != nil {
+		log.Printf("Error decoding parameters: %s", errDecode)
+		writeErrorResponse(w, http.StatusBadRequest, "error decoding JSON")
+		return
+	}
+
+	now := time.Now()
+	tokenDetails, err := api.Db.ConsumeEmailVerificationToken(r.Context(), database.ConsumeEmailVerificationTokenParams{
+		UsedAt: sql.NullTime{
+			Time:  now,
+			Valid: true,
+		},
+		TokenHash: auth.HashToken(params.Token),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorCode(w, http.StatusBadRequest, "invalid_verification_token", "verification token is invalid or expired")
+			return
+		}
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	res, err := api.Db.ConfirmUserEmail(r.Context(), database.ConfirmUserEmailParams{
+		Email:     tokenDetails.Email,
+		UpdatedAt: now,
+		ID:        tokenDetails.UserID,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			//the user requested a different address after this token was sent
+			writeErrorCode(w, http.StatusBadRequest, "invalid_verification_token", "verification token is no longer valid for this account")
+			return
+		}
+		if isUniqueViolation(err) {
+			writeErrorCode(w, http.StatusConflict, "email_taken", "email address is already in use")
+			return
+		}
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	log.Printf("Email %s verified for user %v", res.Email, res.ID)
+	writeSuccessResponse(w, http.StatusOK, userResponse(res))
+}
+
+func ResendEmailVerification(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	userInfo, err := api.Db.GetUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	email := userInfo.PendingEmail.String
+	if !userInfo.PendingEmail.Valid {
+		if userInfo.EmailVerified {
+			writeErrorCode(w, http.StatusConflict, "email_already_verified", "email address is already verified")
+			return
+		}
+		email = userInfo.Email
+	}
+
+	err = inTx(r.Context(), api, func(q *database.Queries) error {
+		return sendEmailVerification(r.Context(), api, q, userID, email)
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	writeSuccessResponse(w, http.StatusNoContent, "")
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestSendEmailVerificationStoresHashedToken(t *testing.T) {
+	api, mock, _ := newTestAPI(t)
+	userID := uuid.New()
+
+	hash, createdAt, expiresAt, payload := &capture{}, &capture{}, &capture{}, &capture{}
+	mock.ExpectExec("INSERT INTO email_verification_tokens").
+		WithArgs(hash, userID, "new@example.com", createdAt, expiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO jobs").
+		WithArgs(sqlmock.AnyArg(), jobSendMail, payload, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := sendEmailVerification(context.Background(), api, api.Db, userID, "new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := queuedMail(t, payload)
+	if msg.To != "new@example.com" {
+		t.Errorf("mail sent to %q", msg.To)
+	}
+	lines := strings.Split(msg.Body, "\n")
+	token := lines[2]
+	if hash.value != auth.HashToken(token) {
+		t.Errorf("stored %v, want the hash of the mailed token %q", hash.value, token)
+	}
+	if ttl := expiresAt.value.(time.Time).Sub(createdAt.value.(time.Time)); ttl.Round(time.Second) != api.EmailVerifyTTL {
+		t.Errorf("token valid for %v, want %v", ttl, api.EmailVerifyTTL)
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	userID := uuid.New()
+	confirmed := database.User{ID: userID, Email: "new@example.com", EmailVerified: true, Role: auth.RoleUser}
+
+	tests := []struct {
+		name   string
+		expect func(mock sqlmock.Sqlmock)
+		status int
+		code   string
+	}{
+		{
+			name: "valid token",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("UPDATE email_verification_tokens").
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "email"}).AddRow(userID.String(), "new@example.com"))
+				mock.ExpectQuery("UPDATE users").
+					WithArgs("new@example.com", sqlmock.AnyArg(), userID).
+					WillReturnRows(userRows(confirmed))
+			},
+			status: http.StatusOK,
+		},
+		{
+			//the query only consumes tokens that are unused and not expired
+			name: "expired or used token",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("UPDATE email_verification_tokens").WillReturnError(sql.ErrNoRows)
+			},
+			status: http.StatusBadRequest,
+			code:   "invalid_verification_token",
+		},
+		{
+			name: "email changed again since the token was sent",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("UPDATE email_verification_tokens").
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "email"}).AddRow(userID.String(), "old@example.com"))
+				mock.ExpectQuery("UPDATE users").WillReturnError(sql.ErrNoRows)
+			},
+			status: http.StatusBadRequest,
+			code:   "invalid_verification_token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, mock, _ := newTestAPI(t)
+			tt.expect(mock)
+
+			r := httptest.NewRequest(http.MethodPost, "/api/email/verify", strings.NewReader(`{"token":"abc"}`))
+			w := httptest.NewRecorder()
+			VerifyEmail(api, w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.code != "" && !strings.Contains(w.Body.String(), `"code":"`+tt.code+`"`) {
+				t.Errorf("body = %s, want code %s", w.Body, tt.code)
+			}
+		})
+	}
+}
+
+func TestVerifyEmailConsumesTokenByHash(t *testing.T) {
+	api, mock, _ := newTestAPI(t)
+	usedAt := &capture{}
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE token_hash = $2 AND used_at IS NULL AND expires_at > $1")).
+		WithArgs(usedAt, auth.HashToken("abc")).
+		WillReturnError(sql.ErrNoRows)
+
+	before := time.Now()
+	r := httptest.NewRequest(http.MethodPost, "/api/email/verify", strings.NewReader(`{"token":"abc"}`))
+	VerifyEmail(api, httptest.NewRecorder(), r)
+
+	if at, ok := usedAt.value.(time.Time); !ok || at.Before(before) {
+		t.Errorf("token checked against %v, want the current time", usedAt.value)
+	}
+}
+
+func TestUpdateUserEmailInvalidatesVerificationTokens(t *testing.T) {
+	api, mock, _ := newTestAPI(t)
+	hash, _ := api.Hasher.Hash("current-password")
+	user := database.User{ID: uuid.New(), Email: "old@example.com", HashedPassword: hash, Role: auth.RoleUser}
+
+	mock.ExpectQuery("FROM users").WithArgs(user.ID).WillReturnRows(userRows(user))
+	mock.ExpectQuery("FROM users").WithArgs("new@example.com").WillReturnError(sql.ErrNoRows)
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE email_verification_tokens").
+		WithArgs(sqlmock.AnyArg(), user.ID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE users").
+		WithArgs("new@example.com", sqlmock.AnyArg(), user.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO email_verification_tokens").
+		WithArgs(sqlmock.AnyArg(), user.ID, "new@example.com", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	payload := &capture{}
+	mock.ExpectExec("INSERT INTO jobs").
+		WithArgs(sqlmock.AnyArg(), jobSendMail, payload, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	body := `{"email":"new@example.com","current_password":"current-password"}`
+	r := withUser(httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(body)), user.ID)
+	w := httptest.NewRecorder()
+	UpdateUser(api, w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	res := struct {
+		Email        string `json:"email"`
+		PendingEmail string `json:"pending_email"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if res.Email != "old@example.com" || res.PendingEmail != "new@example.com" {
+		t.Errorf("response = %+v", res)
+	}
+	if msg := queuedMail(t, payload); msg.To != "new@example.com" {
+		t.Errorf("verification sent to %q", msg.To)
+	}
+}
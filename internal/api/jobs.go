@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/jobs"
+	"github.com/Walther-Knight/chirpy/internal/mailer"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/Walther-Knight/chirpy/internal/models"
+	"github.com/google/uuid"
+)
+
+// Job kinds.
+const (
+	jobBuildDataExport     = "exports.build"
+	jobPurgeAccounts       = "accounts.purge"
+	jobExpireSubscriptions = "subscriptions.expire"
+	jobCleanupJobs         = "jobs.cleanup"
+	jobSendMail            = "mail.send"
+)
+
+// finishedJobRetention is how long succeeded jobs are kept. Dead jobs are
+// kept until an admin requeues them.
+const finishedJobRetention = 7 * 24 * time.Hour
+
+// RunJobs registers every job kind and works the queue. It never returns.
+func RunJobs(api *middleware.ApiConfig) {
+	w := api.Jobs
+	jobs.Register(w, jobBuildDataExport, jobs.KindOptions{Concurrency: 2, Timeout: dataExportAttemptTimeout}, func(ctx context.Context, job jobs.Job, p dataExportJob) error {
+		return buildDataExport(ctx, api, job, p)
+	})
+	jobs.Register(w, jobSendMail, jobs.KindOptions{Concurrency: 4, Timeout: time.Minute}, func(ctx context.Context, job jobs.Job, p mailJob) error {
+		return api.Mailer.Send(ctx, mailer.Message(p))
+	})
+	jobs.Register(w, jobPurgeAccounts, jobs.KindOptions{Concurrency: 1}, func(ctx context.Context, job jobs.Job, p struct{}) error {
+		return purgeAccounts(ctx, api)
+	})
+	jobs.Register(w, jobExpireSubscriptions, jobs.KindOptions{Concurrency: 1}, func(ctx context.Context, job jobs.Job, p struct{}) error {
+		return expireSubscriptions(ctx, api)
+	})
+	jobs.Register(w, jobCleanupJobs, jobs.KindOptions{Concurrency: 1}, func(ctx context.Context, job jobs.Job, p struct{}) error {
+		rows, err := api.Db.DeleteFinishedJobs(ctx, sql.NullTime{Time: time.Now().Add(-finishedJobRetention), Valid: true})
+		if err == nil && rows > 0 {
+			log.Printf("Deleted %d finished jobs", rows)
+		}
+		return err
+	})
+	w.Schedule(jobPurgeAccounts, time.Hour)
+	w.Schedule(jobExpireSubscriptions, time.Minute)
+	w.Schedule(jobCleanupJobs, 24*time.Hour)
+
+	w.Run(context.Background())
+}
+
+func jobResponse(j database.Job) models.Job {
+	payload := j.Payload
+	if j.Kind == jobSendMail {
+		//messages carry reset and verification tokens
+		payload = json.RawMessage(`{}`)
+	}
+	return models.Job{
+		ID:          j.ID,
+		Kind:        j.Kind,
+		Payload:     payload,
+		Status:      j.Status,
+		Attempts:    j.Attempts,
+		MaxAttempts: j.MaxAttempts,
+		RunAt:       j.RunAt,
+		LastError:   j.LastError.String,
+		CreatedAt:   j.CreatedAt,
+		UpdatedAt:   j.UpdatedAt,
+		FinishedAt:  optionalTime(j.FinishedAt),
+	}
+}
+
+func ListJobs(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit := int32(100)
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 500 {
+		limit = int32(n)
+	}
+
+	res, err := api.Db.ListJobs(r.Context(), database.ListJobsParams{
+		Status: r.URL.Query().Get("status"),
+		Kind:   r.URL.Query().Get("kind"),
+		Limit:  limit,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	ResJson := []models.Job{}
+	for _, job := range res {
+		ResJson = append(ResJson, jobResponse(job))
+	}
+	writeSuccessResponse(w, http.StatusOK, ResJson)
+}
+
+// RetryJob runs a dead or waiting job now, with its attempts reset.
+func RetryJob(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	jobID, err := uuid.Parse(r.PathValue("jobID"))
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "error: job ID does not exist")
+		return
+	}
+
+	res, err := api.Db.RequeueJob(r.Context(), database.RequeueJobParams{
+		RunAt: time.Now(),
+		ID:    jobID,
+	})
+	if err == sql.ErrNoRows {
+		current, errGet := api.Db.GetJob(r.Context(), jobID)
+		if errGet == sql.ErrNoRows {
+			writeErrorResponse(w, http.StatusNotFound, "error: job ID does not exist")
+			return
+		}
+		if errGet == nil {
+			writeErrorCode(w, http.StatusConflict, "job_not_retryable", "a "+current.Status+" job cannot be retried")
+			return
+		}
+		err = errGet
+	}
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	log.Printf("Job %s %v requeued", res.Kind, res.ID)
+	writeSuccessResponse(w, http.StatusOK, jobResponse(res))
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/google/uuid"
+)
+
+func clientIP(api *middleware.ApiConfig, r *http.Request) string {
+	if api.TrustProxyHeaders {
+		//the client controls every entry but the last, which the trusted proxy appends
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			last := forwarded[len(forwarded)-1]
+			return strings.TrimSpace(last[strings.LastIndex(last, ",")+1:])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginRetryAfter returns how long the caller must wait before trying to log
+// in to email again, considering both the account and the client IP.
+func loginRetryAfter(api *middleware.ApiConfig, r *http.Request, email string) time.Duration {
+	return throttleRetryAfter(api, r, accountThrottleKey(email), ipThrottleKey(clientIP(api, r)))
+}
+
+// recordLoginFailure counts a failed attempt against the account and the IP.
+// Reaching the lockout does not revoke existing sessions, otherwise anyone
+// could log a victim out by guessing wrong passwords.
+func recordLoginFailure(api *middleware.ApiConfig, r *http.Request, email string) {
+	throttleFail(api, r, accountThrottleKey(email), ipThrottleKey(clientIP(api, r)))
+}
+
+func resetLoginFailures(api *middleware.ApiConfig, r *http.Request, email string) {
+	err := api.AccountLimiter.Reset(r.Context(), accountThrottleKey(email))
+	if err != nil {
+		log.Printf("Error resetting login throttle: %v", err)
+	}
+}
+
+func throttleRetryAfter(api *middleware.ApiConfig, r *http.Request, accountKey, ipKey string) time.Duration {
+	now := time.Now()
+	accountWait, err := api.AccountLimiter.RetryAfter(r.Context(), accountKey, now)
+	if err != nil {
+		log.Printf("Error reading login throttle: %v", err)
+	}
+	ipWait, err := api.IPLimiter.RetryAfter(r.Context(), ipKey, now)
+	if err != nil {
+		log.Printf("Error reading login throttle: %v", err)
+	}
+	return max(accountWait, ipWait)
+}
+
+func throttleFail(api *middleware.ApiConfig, r *http.Request, accountKey, ipKey string) {
+	now := time.Now()
+	_, err := api.AccountLimiter.Fail(r.Context(), accountKey, now)
+	if err != nil {
+		log.Printf("Error recording login failure: %v", err)
+	}
+	_, err = api.IPLimiter.Fail(r.Context(), ipKey, now)
+	if err != nil {
+		log.Printf("Error recording login failure: %v", err)
+	}
+}
+
+func writeTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	writeTooManyRequests(w, wait, "too many failed login attempts, try again later")
+}
+
+func writeTooManyRequests(w http.ResponseWriter, wait time.Duration, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeErrorCode(w, http.StatusTooManyRequests, "too_many_attempts", message)
+}
+
+// recordLoginAttempt keeps an audit trail for GET /admin/login-attempts.
+func recordLoginAttempt(api *middleware.ApiConfig, r *http.Request, email string, userID uuid.UUID, success bool, reason string) {
+	err := api.Db.CreateLoginAttempt(r.Context(), database.CreateLoginAttemptParams{
+		ID:        uuid.New(),
+		Email:     strings.ToLower(strings.TrimSpace(email)),
+		UserID:    uuid.NullUUID{UUID: userID, Valid: userID != uuid.Nil},
+		IpAddress: clientIP(api, r),
+		Success:   success,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error recording login attempt: %v", err)
+	}
+}
+
+func ListLoginAttempts(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	type attackedAccount struct {
+		Email         string    `json:"email"`
+		Failures      int64     `json:"failures"`
+		DistinctIPs   int64     `json:"distinct_ips"`
+		LastAttemptAt time.Time `json:"last_attempt_at"`
+	}
+	type loginAttempt struct {
+		ID        uuid.UUID  `json:"id"`
+		Email     string     `json:"email"`
+		UserID    *uuid.UUID `json:"user_id"`
+		IPAddress string     `json:"ip_address"`
+		Success   bool       `json:"success"`
+		Reason    string     `json:"reason"`
+		CreatedAt time.Time  `json:"created_at"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	email := r.URL.Query().Get("email")
+	if email != "" {
+		res, err := api.Db.ListLoginAttemptsByEmail(r.Context(), database.ListLoginAttemptsByEmailParams{
+			Email: strings.ToLower(email),
+			Limit: 100,
+		})
+		if err != nil {
+			log.Printf("Error on database: %v", err)
+			writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+			return
+		}
+		ResJson := []loginAttempt{}
+		for _, attempt := range res {
+			item := loginAttempt{
+				ID:        attempt.ID,
+				Email:     attempt.Email,
+				IPAddress: attempt.IpAddress,
+				Success:   attempt.Success,
+				Reason:    attempt.Reason,
+				CreatedAt: attempt.CreatedAt,
+			}
+			if attempt.UserID.Valid {
+				item.UserID = &attempt.UserID.UUID
+			}
+			ResJson = append(ResJson, item)
+		}
+		writeSuccessResponse(w, http.StatusOK, ResJson)
+		return
+	}
+
+	since := 24 * time.Hour
+	if hours, err := strconv.Atoi(r.URL.Query().Get("hours")); err == nil && hours > 0 {
+		since = time.Duration(hours) * time.Hour
+	}
+	res, err := api.Db.ListAttackedAccounts(r.Context(), database.ListAttackedAccountsParams{
+		CreatedAt: time.Now().Add(-since),
+		Limit:     100,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	ResJson := []attackedAccount{}
+	for _, account := range res {
+		ResJson = append(ResJson, attackedAccount{
+			Email:         account.Email,
+			Failures:      account.Failures,
+			DistinctIPs:   account.DistinctIps,
+			LastAttemptAt: account.LastAttemptAt,
+		})
+	}
+	writeSuccessResponse(w, http.StatusOK, ResJson)
+}
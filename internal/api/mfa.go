@@ -0,0 +1,318 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/Walther-Knight/chirpy/internal/models"
+)
+
+const (
+	mfaTokenTTL       = 5 * time.Minute
+	recoveryCodeCount = 10
+	totpIssuer        = "Chirpy"
+)
+
+func writeMFAChallenge(api *middleware.ApiConfig, w http.ResponseWriter, userInfo database.User) {
+	mfaToken, err := auth.MakeMFAToken(userInfo.ID, userInfo.TokenVersion, api.Token, mfaTokenTTL)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "mfa token creation failed")
+		return
+	}
+	writeSuccessResponse(w, http.StatusOK, models.MFAChallenge{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+	})
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery
+// code. Both are consumed atomically so they cannot be replayed.
+func verifySecondFactor(api *middleware.ApiConfig, r *http.Request, userInfo database.User, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		rows, err := api.Db.UseRecoveryCode(r.Context(), database.UseRecoveryCodeParams{
+			UsedAt: sql.NullTime{
+				Time:  time.Now(),
+				Valid: true,
+			},
+			UserID:   userInfo.ID,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)),
+		})
+		if err != nil {
+			return false, err
+		}
+		if rows == 1 {
+			log.Printf("Recovery code used for user %v", userInfo.ID)
+		}
+		return rows == 1, nil
+	}
+
+	step, ok := auth.ValidateTOTP(userInfo.TotpSecret.String, code, time.Now(), userInfo.TotpLastStep)
+	if !ok {
+		return false, nil
+	}
+	rows, err := api.Db.UpdateTOTPLastStep(r.Context(), database.UpdateTOTPLastStepParams{
+		TotpLastStep: step,
+		ID:           userInfo.ID,
+	})
+	if err != nil {
+		return false, err
+	}
+	//zero rows means a concurrent request already used this code
+	return rows == 1, nil
+}
+
+func LoginMFA(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	type reqParams struct {
+		MFAToken      string `json:"mfa_token"`
+		Code          string `json:"code"`
+		RecoveryCode  string `json:"recovery_code"`
+		CookieSession bool   `json:"cookie_session"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	params := reqParams{}
+	errDecode := decodeJSONBody(r, &params)
+
+	if errDecode != nil {
+		log.Printf("Error decoding parameters: %s", errDecode)
+		writeErrorResponse(w, http.StatusBadRequest, "error decoding JSON")
+		return
+	}
+
+	claims, err := auth.ValidateMFAToken(params.MFAToken, api.Token)
+	if err != nil {
+		writeErrorResponse(w, http.StatusUnauthorized, "invalid or expired mfa token")
+		return
+	}
+
+	userInfo, err := api.Db.GetUser(r.Context(), claims.UserID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	//sessions revoked since the password step, e.g. by a password reset
+	if userInfo.TokenVersion != claims.TokenVersion || !userInfo.TotpEnabled {
+		writeErrorResponse(w, http.StatusUnauthorized, "invalid or expired mfa token")
+		return
+	}
+
+	//codes are only 6 digits, so the second step shares the login throttle
+	if wait := loginRetryAfter(api, r, userInfo.Email); wait > 0 {
+		recordLoginAttempt(api, r, userInfo.Email, userInfo.ID, false, "throttled")
+		writeTooManyAttempts(w, wait)
+		return
+	}
+
+	ok, err := verifySecondFactor(api, r, userInfo, params.Code, params.RecoveryCode)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	if !ok {
+		recordLoginFailure(api, r, userInfo.Email)
+		recordLoginAttempt(api, r, userInfo.Email, userInfo.ID, false, "bad_mfa_code")
+		writeErrorCode(w, http.StatusUnauthorized, "invalid_mfa_code", "invalid authentication code")
+		return
+	}
+
+	resetLoginFailures(api, r, userInfo.Email)
+	recordLoginAttempt(api, r, userInfo.Email, userInfo.ID, true, "mfa")
+	issueSession(api, w, r, userInfo, params.CookieSession)
+}
+
+func EnrollTOTP(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	userInfo, err := api.Db.GetUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	if userInfo.TotpEnabled {
+		writeErrorCode(w, http.StatusConflict, "totp_already_enabled", "two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "totp secret creation failed")
+		return
+	}
+
+	//not enabled until ConfirmTOTP proves the authenticator app has the secret
+	err = api.Db.SetTOTPSecret(r.Context(), database.SetTOTPSecretParams{
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+		UpdatedAt:  time.Now(),
+		ID:         userID,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	writeSuccessResponse(w, http.StatusOK, models.TOTPEnrollment{
+		Secret:     secret,
+		OtpauthURI: auth.TOTPURI(totpIssuer, userInfo.Email, secret),
+	})
+}
+
+func ConfirmTOTP(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	type reqParams struct {
+		Code string `json:"code"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	params := reqParams{}
+	errDecode := decodeJSONBody(r, &params)
+
+	if errDecode != nil {
+		log.Printf("Error decoding parameters: %s", errDecode)
+		writeErrorResponse(w, http.StatusBadRequest, "error decoding JSON")
+		return
+	}
+
+	userInfo, err := api.Db.GetUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	if userInfo.TotpEnabled {
+		writeErrorCode(w, http.StatusConflict, "totp_already_enabled", "two-factor authentication is already enabled")
+		return
+	}
+	if !userInfo.TotpSecret.Valid {
+		writeErrorCode(w, http.StatusBadRequest, "totp_not_enrolled", "start enrollment before confirming")
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(userInfo.TotpSecret.String, params.Code, time.Now(), 0)
+	if !ok {
+		writeErrorCode(w, http.StatusBadRequest, "invalid_mfa_code", "invalid authentication code")
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "recovery code creation failed")
+		return
+	}
+
+	err = api.Db.DeleteRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	for _, code := range codes {
+		err = api.Db.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			UserID:    userID,
+			CodeHash:  auth.HashToken(code),
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			log.Printf("Error on database: %v", err)
+			writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+			return
+		}
+	}
+
+	err = api.Db.EnableTOTP(r.Context(), database.EnableTOTPParams{
+		TotpLastStep: step,
+		UpdatedAt:    time.Now(),
+		ID:           userID,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	log.Printf("Two-factor authentication enabled for user %v", userID)
+	//plaintext codes are shown exactly once
+	writeSuccessResponse(w, http.StatusOK, models.RecoveryCodes{RecoveryCodes: codes})
+}
+
+func DisableTOTP(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	type reqParams struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	params := reqParams{}
+	errDecode := decodeJSONBody(r, &params)
+
+	if errDecode != nil {
+		log.Printf("Error decoding parameters: %s", errDecode)
+		writeErrorResponse(w, http.StatusBadRequest, "error decoding JSON")
+		return
+	}
+
+	userInfo, err := api.Db.GetUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	if !userInfo.TotpEnabled {
+		writeErrorCode(w, http.StatusConflict, "totp_not_enabled", "two-factor authentication is not enabled")
+		return
+	}
+
+	verified, err := verifySecondFactor(api, r, userInfo, params.Code, params.RecoveryCode)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	if !verified {
+		writeErrorCode(w, http.StatusUnauthorized, "invalid_mfa_code", "invalid authentication code")
+		return
+	}
+
+	err = api.Db.DisableTOTP(r.Context(), database.DisableTOTPParams{
+		UpdatedAt: time.Now(),
+		ID:        userID,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	err = api.Db.DeleteRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	log.Printf("Two-factor authentication disabled for user %v", userID)
+	writeSuccessResponse(w, http.StatusNoContent, "")
+}
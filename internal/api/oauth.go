@@ -0,0 +1,492 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/Walther-Knight/chirpy/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	oauthCodeTTL         = 10 * time.Minute
+	oauthAccessTokenTTL  = time.Hour
+	oauthRefreshTokenTTL = 1440 * time.Hour
+)
+
+func oauthClientResponse(c database.OauthClient) models.OAuthClient {
+	return models.OAuthClient{
+		ClientID:     c.ID,
+		Name:         c.Name,
+		RedirectURIs: strings.Fields(c.RedirectUris),
+		Scopes:       auth.SplitScopes(c.Scopes),
+		Confidential: c.SecretHash.Valid,
+		CreatedAt:    c.CreatedAt,
+	}
+}
+
+// writeOAuthError uses the RFC 6749 error format, which OAuth client
+// libraries expect instead of our usual error body.
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.WriteHeader(status)
+	err := marshalJSON(w, models.OAuthError{
+		Error:            code,
+		ErrorDescription: description,
+	})
+	if err != nil {
+		log.Printf("Error marshalling JSON: %s", err)
+	}
+}
+
+func CreateOAuthClient(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	type reqParams struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Confidential bool     `json:"confidential"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	params := reqParams{}
+	errDecode := decodeJSONBody(r, &params)
+
+	if errDecode != nil {
+		log.Printf("Error decoding parameters: %s", errDecode)
+		writeErrorResponse(w, http.StatusBadRequest, "error decoding JSON")
+		return
+	}
+
+	if params.Name == "" || len(params.Name) > 100 {
+		writeErrorResponse(w, http.StatusBadRequest, "client name must be 1 to 100 characters")
+		return
+	}
+	if len(params.RedirectURIs) == 0 {
+		writeErrorCode(w, http.StatusBadRequest, "invalid_redirect_uri", "at least one redirect URI is required")
+		return
+	}
+	for _, uri := range params.RedirectURIs {
+		if err := auth.ValidateRedirectURI(uri); err != nil {
+			writeErrorCode(w, http.StatusBadRequest, "invalid_redirect_uri", err.Error())
+			return
+		}
+	}
+	scopes, err := auth.ParseScopes(params.Scopes)
+	if err != nil {
+		writeErrorCode(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		return
+	}
+
+	//public clients (SPAs, mobile apps) can't keep a secret and rely on PKCE alone
+	clientSecret := ""
+	secretHash := sql.NullString{}
+	if params.Confidential {
+		clientSecret, err = auth.MakeRefreshToken()
+		if err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "client secret creation failed")
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(clientSecret), Valid: true}
+	}
+
+	res, err := api.Db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		ID:           uuid.New().String(),
+		OwnerID:      userID,
+		Name:         params.Name,
+		SecretHash:   secretHash,
+		RedirectUris: strings.Join(params.RedirectURIs, " "),
+		Scopes:       auth.JoinScopes(scopes),
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	ResJson := oauthClientResponse(res)
+	//the plaintext secret is only ever returned here
+	ResJson.ClientSecret = clientSecret
+	log.Printf("OAuth client %v registered by user %v", res.ID, userID)
+	writeSuccessResponse(w, http.StatusCreated, ResJson)
+}
+
+func ListOAuthClients(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := api.Db.ListOAuthClients(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	ResJson := []models.OAuthClient{}
+	for _, client := range res {
+		ResJson = append(ResJson, oauthClientResponse(client))
+	}
+	writeSuccessResponse(w, http.StatusOK, ResJson)
+}
+
+// DeleteOAuthClient also removes the client's refresh tokens. Access tokens
+// already issued stop working because Authenticate checks their client exists.
+func DeleteOAuthClient(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := api.Db.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:      r.PathValue("clientID"),
+		OwnerID: userID,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	if rows == 0 {
+		writeErrorResponse(w, http.StatusNotFound, "error: client ID does not exist")
+		return
+	}
+
+	log.Printf("OAuth client %v deleted", r.PathValue("clientID"))
+	writeSuccessResponse(w, http.StatusNoContent, "")
+}
+
+type authorizeParams struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
+}
+
+// validateAuthorizeRequest checks an authorization request and returns the
+// client and the granted scopes. Errors are written as JSON instead of being
+// redirected, so an unregistered redirect URI is never followed.
+func validateAuthorizeRequest(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request, params authorizeParams) (database.OauthClient, []string, bool) {
+	client, err := api.Db.GetOAuthClient(r.Context(), params.ClientID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorCode(w, http.StatusBadRequest, "invalid_client", "unknown client_id")
+			return client, nil, false
+		}
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return client, nil, false
+	}
+	//exact match only, prefix matching enables open redirects
+	if !slices.Contains(strings.Fields(client.RedirectUris), params.RedirectURI) {
+		writeErrorCode(w, http.StatusBadRequest, "invalid_redirect_uri", "redirect_uri is not registered for this client")
+		return client, nil, false
+	}
+	if params.ResponseType != "code" {
+		writeErrorCode(w, http.StatusBadRequest, "unsupported_response_type", "only response_type code is supported")
+		return client, nil, false
+	}
+	if params.CodeChallenge == "" || params.CodeChallengeMethod != "S256" {
+		writeErrorCode(w, http.StatusBadRequest, "invalid_request", "PKCE with code_challenge_method S256 is required")
+		return client, nil, false
+	}
+
+	allowed := auth.SplitScopes(client.Scopes)
+	if params.Scope == "" {
+		return client, allowed, true
+	}
+	scopes, err := auth.ParseScopes(auth.SplitScopes(params.Scope))
+	if err != nil {
+		writeErrorCode(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		return client, nil, false
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			writeErrorCode(w, http.StatusBadRequest, "invalid_scope", "client is not registered for scope "+scope)
+			return client, nil, false
+		}
+	}
+	return client, scopes, true
+}
+
+// GetOAuthConsent validates an authorization request and returns what the
+// consent screen should show the user.
+func GetOAuthConsent(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	params := authorizeParams{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+	client, scopes, ok := validateAuthorizeRequest(api, w, r, params)
+	if !ok {
+		return
+	}
+
+	writeSuccessResponse(w, http.StatusOK, models.OAuthConsent{
+		ClientID:    client.ID,
+		ClientName:  client.Name,
+		RedirectURI: params.RedirectURI,
+		Scopes:      scopes,
+	})
+}
+
+// AuthorizeOAuthClient records the user's consent decision and returns the
+// redirect back to the client, carrying either a code or access_denied.
+func AuthorizeOAuthClient(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	params := authorizeParams{}
+	errDecode := decodeJSONBody(r, &params)
+
+	if errDecode != nil {
+		log.Printf("Error decoding parameters: %s", errDecode)
+		writeErrorResponse(w, http.StatusBadRequest, "error decoding JSON")
+		return
+	}
+
+	client, scopes, ok := validateAuthorizeRequest(api, w, r, params)
+	if !ok {
+		return
+	}
+
+	redirect, err := url.Parse(params.RedirectURI)
+	if err != nil {
+		writeErrorCode(w, http.StatusBadRequest, "invalid_redirect_uri", "redirect_uri is not a valid URL")
+		return
+	}
+	query := redirect.Query()
+	if params.State != "" {
+		query.Set("state", params.State)
+	}
+
+	if !params.Approve {
+		query.Set("error", "access_denied")
+	} else {
+		code, err := auth.MakeRefreshToken()
+		if err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "authorization code creation failed")
+			return
+		}
+		err = api.Db.CreateAuthorizationCode(r.Context(), database.CreateAuthorizationCodeParams{
+			CodeHash:      auth.HashToken(code),
+			ClientID:      client.ID,
+			UserID:        userID,
+			RedirectUri:   params.RedirectURI,
+			Scopes:        auth.JoinScopes(scopes),
+			CodeChallenge: params.CodeChallenge,
+			CreatedAt:     time.Now(),
+			ExpiresAt:     time.Now().Add(oauthCodeTTL),
+		})
+		if err != nil {
+			log.Printf("Error on database: %v", err)
+			writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+			return
+		}
+		query.Set("code", code)
+		log.Printf("User %v authorized OAuth client %v for %s", userID, client.ID, auth.JoinScopes(scopes))
+	}
+
+	redirect.RawQuery = query.Encode()
+	writeSuccessResponse(w, http.StatusOK, models.OAuthRedirect{RedirectTo: redirect.String()})
+}
+
+// authenticateOAuthClient accepts client_secret_basic or client_secret_post.
+// Public clients only send client_id and are bound by PKCE instead.
+func authenticateOAuthClient(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) (database.OauthClient, bool) {
+	clientID, clientSecret, hasBasic := r.BasicAuth()
+	if !hasBasic {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	client, err := api.Db.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "unknown client")
+			return client, false
+		}
+		log.Printf("Error on database: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return client, false
+	}
+	if client.SecretHash.Valid && subtle.ConstantTimeCompare([]byte(auth.HashToken(clientSecret)), []byte(client.SecretHash.String)) != 1 {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return client, false
+	}
+	return client, true
+}
+
+// OAuthToken is the token endpoint. It takes form encoded parameters as
+// required by RFC 6749.
+func OAuthToken(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "error decoding form")
+		return
+	}
+
+	client, ok := authenticateOAuthClient(api, w, r)
+	if !ok {
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		exchangeAuthorizationCode(api, w, r, client)
+	case "refresh_token":
+		refreshOAuthToken(api, w, r, client)
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+// exchangeAuthorizationCode only consumes a code presented by the client and
+// with the redirect_uri it was issued for, so another client that got hold of
+// the code can't burn it.
+func exchangeAuthorizationCode(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	now := time.Now()
+	code, err := api.Db.ConsumeAuthorizationCode(r.Context(), database.ConsumeAuthorizationCodeParams{
+		UsedAt: sql.NullTime{
+			Time:  now,
+			Valid: true,
+		},
+		CodeHash:    auth.HashToken(r.PostForm.Get("code")),
+		ClientID:    client.ID,
+		RedirectUri: r.PostForm.Get("redirect_uri"),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "authorization code is invalid, expired, already used or issued for a different client or redirect_uri")
+			return
+		}
+		log.Printf("Error on database: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "code_verifier does not match the code_challenge")
+		return
+	}
+
+	issueOAuthTokens(api, w, r, client.ID, code.UserID, auth.SplitScopes(code.Scopes))
+}
+
+// refreshOAuthToken rotates the refresh token on every use.
+func refreshOAuthToken(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	refreshToken := r.PostForm.Get("refresh_token")
+	tokenDetails, err := api.Db.GetUserFromRefreshToken(r.Context(), refreshToken)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "refresh token is invalid")
+			return
+		}
+		log.Printf("Error on database: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	//first-party refresh tokens can't be exchanged here, they carry every scope
+	if tokenDetails.ClientID.String != client.ID || tokenDetails.RevokedAt.Valid || time.Now().After(tokenDetails.ExpiresAt) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "refresh token is invalid, revoked or expired")
+		return
+	}
+
+	err = api.Db.UpdateRefreshToken(r.Context(), database.UpdateRefreshTokenParams{
+		RevokedAt: sql.NullTime{
+			Time:  time.Now(),
+			Valid: true,
+		},
+		UpdatedAt: time.Now(),
+		Token:     refreshToken,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	issueOAuthTokens(api, w, r, client.ID, tokenDetails.UserID, auth.SplitScopes(tokenDetails.Scopes.String))
+}
+
+func issueOAuthTokens(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request, clientID string, userID uuid.UUID, scopes []string) {
+	userInfo, err := api.Db.GetUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if userInfo.LockedAt.Valid {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "account is locked")
+		return
+	}
+
+	accessToken, err := auth.MakeClientJWT(userID, userInfo.TokenVersion, clientID, scopes, api.Token, oauthAccessTokenTTL)
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	err = api.Db.CreateOAuthRefreshToken(r.Context(), database.CreateOAuthRefreshTokenParams{
+		Token:     refreshToken,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(oauthRefreshTokenTTL),
+		ClientID:  sql.NullString{String: clientID, Valid: true},
+		Scopes:    sql.NullString{String: auth.JoinScopes(scopes), Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	writeSuccessResponse(w, http.StatusOK, models.OAuthToken{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        auth.JoinScopes(scopes),
+	})
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Walther-Knight/chirpy/internal/auth"
+)
+
+func TestOAuthTokenDoesNotConsumeAnotherClientsCode(t *testing.T) {
+	api, mock, _ := newTestAPI(t)
+	mock.ExpectQuery("FROM oauth_clients").WithArgs("client-2").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "owner_id", "name", "secret_hash", "redirect_uris", "scopes", "created_at"}).
+			AddRow("client-2", "5f0c1a52-6f47-4a55-9d43-05c1f3f6a0c1", "other app", nil, "https://other.example.com/cb", auth.ScopeChirpsRead, time.Now()))
+	//the client and redirect_uri are part of the update, a mismatch leaves the code unused
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE code_hash = $2 AND client_id = $3 AND redirect_uri = $4")).
+		WithArgs(sqlmock.AnyArg(), auth.HashToken("stolen-code"), "client-2", "https://other.example.com/cb").
+		WillReturnError(sql.ErrNoRows)
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"client-2"},
+		"code":          {"stolen-code"},
+		"redirect_uri":  {"https://other.example.com/cb"},
+		"code_verifier": {"verifier"},
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/oauth/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	OAuthToken(api, w, r)
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"error":"invalid_grant"`) {
+		t.Errorf("response = %d %s, want 400 invalid_grant", w.Code, w.Body)
+	}
+}
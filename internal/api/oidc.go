@@ -0,0 +1,265 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/Walther-Knight/chirpy/internal/oidc"
+	"github.com/google/uuid"
+)
+
+const (
+	oidcStateTTL = 10 * time.Minute
+	// oidcAppURL is where the browser lands after single sign-on
+	oidcAppURL = "/app/"
+)
+
+// OIDCLogin starts single sign-on by redirecting the browser to the
+// identity provider.
+func OIDCLogin(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if api.OIDC == nil {
+		writeErrorResponse(w, http.StatusNotFound, "single sign-on is not configured")
+		return
+	}
+
+	state, err := auth.MakeRefreshToken()
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "state creation failed")
+		return
+	}
+	nonce, err := auth.MakeRefreshToken()
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "nonce creation failed")
+		return
+	}
+	verifier, err := auth.MakePKCEVerifier()
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "code verifier creation failed")
+		return
+	}
+
+	now := time.Now()
+	//abandoned logins are cleaned up here rather than by a background job
+	err = api.Db.DeleteExpiredOIDCLoginStates(r.Context(), now)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+	}
+	err = api.Db.CreateOIDCLoginState(r.Context(), database.CreateOIDCLoginStateParams{
+		StateHash:    auth.HashToken(state),
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(oidcStateTTL),
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	authURL, err := api.OIDC.AuthCodeURL(r.Context(), state, nonce, auth.PKCEChallenge(verifier))
+	if err != nil {
+		log.Printf("Error contacting identity provider: %v", err)
+		writeErrorCode(w, http.StatusBadGateway, "oidc_unavailable", "identity provider is unavailable")
+		return
+	}
+	api.SetOIDCStateCookie(w, state, oidcStateTTL)
+	w.Header().Del("Content-Type")
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback finishes single sign-on in a cookie session and redirects the
+// browser to the app.
+func OIDCCallback(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if api.OIDC == nil {
+		writeErrorResponse(w, http.StatusNotFound, "single sign-on is not configured")
+		return
+	}
+
+	query := r.URL.Query()
+	//the state must come back to the browser that started the login, otherwise
+	//an attacker could sign the victim in to the attacker's account
+	stateCookie, err := r.Cookie(middleware.OIDCStateCookie)
+	if err != nil || stateCookie.Value == "" || subtle.ConstantTimeCompare([]byte(stateCookie.Value), []byte(query.Get("state"))) != 1 {
+		writeErrorCode(w, http.StatusBadRequest, "invalid_state", "login state is invalid or expired, start again")
+		return
+	}
+	api.ClearOIDCStateCookie(w)
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		writeErrorCode(w, http.StatusUnauthorized, "oidc_error", "identity provider returned "+providerErr)
+		return
+	}
+
+	loginState, err := api.Db.ConsumeOIDCLoginState(r.Context(), database.ConsumeOIDCLoginStateParams{
+		StateHash: auth.HashToken(query.Get("state")),
+		ExpiresAt: time.Now(),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorCode(w, http.StatusBadRequest, "invalid_state", "login state is invalid or expired, start again")
+			return
+		}
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	tokens, err := api.OIDC.Exchange(r.Context(), query.Get("code"), loginState.CodeVerifier)
+	if err != nil {
+		log.Printf("Error exchanging OIDC code: %v", err)
+		writeErrorCode(w, http.StatusUnauthorized, "oidc_error", "sign-in with the identity provider failed")
+		return
+	}
+	claims, err := api.OIDC.VerifyIDToken(r.Context(), tokens.IDToken, loginState.Nonce)
+	if err != nil {
+		log.Printf("Error verifying OIDC id token: %v", err)
+		writeErrorCode(w, http.StatusUnauthorized, "oidc_error", "sign-in with the identity provider failed")
+		return
+	}
+
+	userInfo, ok := oidcUser(api, w, r, claims)
+	if !ok {
+		return
+	}
+
+	if userInfo.LockedAt.Valid {
+		recordLoginAttempt(api, r, userInfo.Email, userInfo.ID, false, "account_locked")
+		writeErrorCode(w, http.StatusForbidden, "account_locked", "account is locked, contact an administrator")
+		return
+	}
+	//a local second factor still applies, the provider's MFA is not visible to us.
+	//The fragment is not sent to servers, the app finishes with POST /api/login/mfa
+	if userInfo.TotpEnabled {
+		mfaToken, err := auth.MakeMFAToken(userInfo.ID, userInfo.TokenVersion, api.Token, mfaTokenTTL)
+		if err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "mfa token creation failed")
+			return
+		}
+		recordLoginAttempt(api, r, userInfo.Email, userInfo.ID, true, "mfa_required")
+		w.Header().Del("Content-Type")
+		http.Redirect(w, r, oidcAppURL+"#mfa_token="+url.QueryEscape(mfaToken), http.StatusFound)
+		return
+	}
+
+	newToken, newRefreshToken, ok := createSession(api, w, r, userInfo)
+	if !ok {
+		return
+	}
+	err = api.SetSessionCookies(w, newToken, sessionAccessTTL, newRefreshToken, sessionRefreshTTL)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "csrf token creation failed")
+		return
+	}
+	recordLoginAttempt(api, r, userInfo.Email, userInfo.ID, true, "oidc")
+	w.Header().Del("Content-Type")
+	http.Redirect(w, r, oidcAppURL, http.StatusFound)
+}
+
+// oidcUser returns the user linked to the external identity. On first sign-in
+// the identity is linked to the account with the same email if both sides have
+// verified it, or a new account is created.
+func oidcUser(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request, claims *oidc.Claims) (database.User, bool) {
+	issuer := api.OIDC.Issuer()
+	userID, err := api.Db.GetUserIDByIdentity(r.Context(), database.GetUserIDByIdentityParams{
+		Issuer:  issuer,
+		Subject: claims.Subject,
+	})
+	if err == nil {
+		userInfo, err := api.Db.GetUser(r.Context(), userID)
+		if err != nil {
+			log.Printf("Error on database: %v", err)
+			writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+			return userInfo, false
+		}
+		return userInfo, true
+	}
+	if err != sql.ErrNoRows {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return database.User{}, false
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		writeErrorCode(w, http.StatusForbidden, "oidc_email_unverified", "the identity provider did not return a verified email address")
+		return database.User{}, false
+	}
+
+	userInfo, err := api.Db.GetUserPassword(r.Context(), claims.Email)
+	switch {
+	case err == sql.ErrNoRows:
+		userInfo, err = createOIDCUser(api, r, claims.Email)
+		if err != nil {
+			log.Printf("Error on database: %v", err)
+			writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+			return userInfo, false
+		}
+		log.Printf("User %v created from %s sign-in", userInfo.ID, issuer)
+	case err != nil:
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return userInfo, false
+	case !userInfo.EmailVerified:
+		//otherwise whoever registered the address first would get the SSO user's account
+		writeErrorCode(w, http.StatusConflict, "oidc_account_unverified", "verify the email address of your existing account before using single sign-on")
+		return userInfo, false
+	}
+
+	err = api.Db.CreateUserIdentity(r.Context(), database.CreateUserIdentityParams{
+		Issuer:    issuer,
+		Subject:   claims.Subject,
+		UserID:    userInfo.ID,
+		Email:     claims.Email,
+		CreatedAt: time.Now(),
+	})
+	//a concurrent callback may have linked it already
+	if err != nil && !isUniqueViolation(err) {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return userInfo, false
+	}
+	log.Printf("Identity %s %s linked to user %v", issuer, claims.Subject, userInfo.ID)
+	return userInfo, true
+}
+
+// createOIDCUser creates an account with an unusable random password. The
+// user can set a password later through the password reset flow.
+func createOIDCUser(api *middleware.ApiConfig, r *http.Request, email string) (database.User, error) {
+	password, err := auth.MakeRefreshToken()
+	if err != nil {
+		return database.User{}, err
+	}
+	hashedPassword, err := api.Hasher.Hash(password)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	now := time.Now()
+	created, err := api.Db.CreateUser(r.Context(), database.CreateUserParams{
+		ID:             uuid.New(),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Email:          email,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		return created, err
+	}
+	//the provider verified the address
+	return api.Db.ConfirmUserEmail(r.Context(), database.ConfirmUserEmailParams{
+		Email:     created.Email,
+		UpdatedAt: now,
+		ID:        created.ID,
+	})
+}
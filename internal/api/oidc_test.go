@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/Walther-Knight/chirpy/internal/oidc"
+)
+
+// discoveryServer serves just enough of a provider for OIDCLogin.
+func discoveryServer(t *testing.T) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"jwks_uri":               srv.URL + "/jwks",
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOIDCLoginSetsStateCookie(t *testing.T) {
+	api, mock, _ := newTestAPI(t)
+	srv := discoveryServer(t)
+	api.OIDC = oidc.NewProvider(oidc.Config{Issuer: srv.URL, ClientID: "chirpy", RedirectURL: "http://localhost:8080/api/oidc/callback"})
+
+	stateHash := &capture{}
+	mock.ExpectExec("DELETE FROM oidc_login_states").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO oidc_login_states").
+		WithArgs(stateHash, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := httptest.NewRecorder()
+	OIDCLogin(api, w, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil))
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	location, _ := url.Parse(w.Header().Get("Location"))
+	state := location.Query().Get("state")
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == middleware.OIDCStateCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || cookie.Value != state || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("state cookie = %+v, want the HttpOnly, SameSite=Lax state %q", cookie, state)
+	}
+	if stateHash.value != auth.HashToken(state) {
+		t.Errorf("stored state hash %v does not match the redirect state", stateHash.value)
+	}
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie string
+	}{
+		{"no cookie, e.g. a link sent to the victim", ""},
+		{"cookie of another login", "other-state"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//the login state is not consumed, no query is expected
+			api, _, _ := newTestAPI(t)
+			api.OIDC = oidc.NewProvider(oidc.Config{Issuer: "http://idp.invalid"})
+
+			r := httptest.NewRequest(http.MethodGet, "/api/oidc/callback?code=c&state=attacker-state", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: middleware.OIDCStateCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			OIDCCallback(api, w, r)
+
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"code":"invalid_state"`) {
+				t.Errorf("response = %d %s, want 400 invalid_state", w.Code, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+)
+
+// inTx runs fn with queries bound to a single transaction and commits if fn
+// succeeds. Changes that record an outbox event go through here.
+func inTx(ctx context.Context, api *middleware.ApiConfig, fn func(q *database.Queries) error) error {
+	tx, err := api.Pool.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(api.Db.WithTx(tx))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// outboxRetention is how long published events are kept for debugging.
+const outboxRetention = 7 * 24 * time.Hour
+
+// RunOutboxRelay publishes recorded events to the configured sinks and
+// deletes published events after outboxRetention. A full batch is followed
+// by the next one right away. It never returns.
+func RunOutboxRelay(api *middleware.ApiConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		n, err := api.Outbox.RelayOnce(ctx, time.Now())
+		if err != nil {
+			log.Printf("Error relaying outbox: %v", err)
+		}
+		if time.Since(lastCleanup) > time.Hour {
+			lastCleanup = time.Now()
+			rows, err := api.Db.DeletePublishedOutboxEvents(ctx, sql.NullTime{Time: time.Now().Add(-outboxRetention), Valid: true})
+			if err != nil {
+				log.Printf("Error on database: %v", err)
+			} else if rows > 0 {
+				log.Printf("Deleted %d published outbox events", rows)
+			}
+		}
+		cancel()
+		if n < int(api.Outbox.BatchSize) {
+			<-ticker.C
+		}
+	}
+}
+
+// RunEventListener feeds api.Bus with the events relayed by any server,
+// restarting the listener if it cannot connect. It never returns.
+func RunEventListener(api *middleware.ApiConfig) {
+	for {
+		err := api.Listener.Run(context.Background())
+		log.Printf("Error on event listener, restarting: %v", err)
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/jobs"
+	"github.com/Walther-Knight/chirpy/internal/mailer"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+)
+
+// mailJob is the payload of a mail.send job.
+type mailJob struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// sendMail queues msg as a job. Pass the Queries of the transaction that
+// stores the token the message carries, so the mail is only sent if the token
+// exists and is retried if the mail server fails. Sending in the background
+// also keeps response time from revealing whether an address has an account.
+func sendMail(ctx context.Context, q *database.Queries, msg mailer.Message) error {
+	_, err := jobs.Enqueue(ctx, q, jobSendMail, mailJob(msg), jobs.Options{})
+	return err
+}
+
+// resetRetryAfter throttles reset requests with the login limiters, under
+// separate keys so that requesting resets for an address does not lock its
+// owner out of logging in.
+func resetRetryAfter(api *middleware.ApiConfig, r *http.Request, email string) time.Duration {
+	return throttleRetryAfter(api, r, "reset:"+accountThrottleKey(email), "reset:"+ipThrottleKey(clientIP(api, r)))
+}
+
+// recordResetRequest counts every request, whether or not the address has an
+// account.
+func recordResetRequest(api *middleware.ApiConfig, r *http.Request, email string) {
+	throttleFail(api, r, "reset:"+accountThrottleKey(email), "reset:"+ipThrottleKey(clientIP(api, r)))
+}
+
+func ForgotPassword(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	type reqParams struct {
+		Email string `json:"email"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	params := reqParams{}
+	errDecode := decodeJSONBody(r, &params)
+
+	if errDecode != nil {
+		log.Printf("Error decoding parameters: %s", errDecode)
+		writeErrorResponse(w, http.StatusBadRequest, "error decoding JSON")
+		return
+	}
+
+	if wait := resetRetryAfter(api, r, params.Email); wait > 0 {
+		writeTooManyRequests(w, wait, "too many password reset requests, try again later")
+		return
+	}
+	recordResetRequest(api, r, params.Email)
+
+	userInfo, err := api.Db.GetUserPassword(r.Context(), params.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			//same response as a known address, don't leak which emails have accounts
+			writeSuccessResponse(w, http.StatusNoContent, "")
+			return
+		}
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	resetToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "reset token creation failed")
+		return
+	}
+
+	err = inTx(r.Context(), api, func(q *database.Queries) error {
+		err := q.CreatePasswordResetToken(r.Context(), database.CreatePasswordResetTokenParams{
+			TokenHash: auth.HashToken(resetToken),
+			UserID:    userInfo.ID,
+			CreatedAt: time.Now(),
+			ExpiresAt: time.Now().Add(api.PasswordResetTTL),
+		})
+		if err != nil {
+			return err
+		}
+		return sendMail(r.Context(), q, mailer.Message{
+			To:      userInfo.Email,
+			Subject: "Reset your Chirpy password",
+			Body: fmt.Sprintf("Someone requested a password reset for your Chirpy account.\n\n"+
+				"Send this token with your new password to POST %s/api/password/reset:\n\n%s\n\n"+
+				"The token expires in %v. If you did not request a reset you can ignore this email.",
+				api.BaseURL, resetToken, api.PasswordResetTTL),
+		})
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	log.Printf("Password reset requested for user %v", userInfo.ID)
+	writeSuccessResponse(w, http.StatusNoContent, "")
+}
+
+func ResetPassword(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	type reqParams struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	params := reqParams{}
+	errDecode := decodeJSONBody(r, &params)
+
+	if errDecode != nil {
+		log.Printf("Error decoding parameters: %s", errDecode)
+		writeErrorResponse(w, http.StatusBadRequest, "error decoding JSON")
+		return
+	}
+
+	tokenHash := auth.HashToken(params.Token)
+	tokenDetails, err := api.Db.GetPasswordResetToken(r.Context(), tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorCode(w, http.StatusBadRequest, "invalid_reset_token", "reset token is invalid or expired")
+			return
+		}
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	if tokenDetails.UsedAt.Valid || time.Now().After(tokenDetails.ExpiresAt) {
+		writeErrorCode(w, http.StatusBadRequest, "invalid_reset_token", "reset token is invalid or expired")
+		return
+	}
+
+	userInfo, err := api.Db.GetUserFromID(r.Context(), tokenDetails.UserID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	if !checkPasswordPolicy(api, w, params.Password, userInfo.Email) {
+		return
+	}
+
+	newHash, err := api.Hasher.Hash(params.Password)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "error hashing password")
+		return
+	}
+
+	//consuming is atomic, so a token racing itself can only be used once
+	now := time.Now()
+	_, err = api.Db.ConsumePasswordResetToken(r.Context(), database.ConsumePasswordResetTokenParams{
+		UsedAt: sql.NullTime{
+			Time:  now,
+			Valid: true,
+		},
+		TokenHash: tokenHash,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorCode(w, http.StatusBadRequest, "invalid_reset_token", "reset token is invalid or expired")
+			return
+		}
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	err = api.Db.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		HashedPassword: newHash,
+		UpdatedAt:      now,
+		ID:             userInfo.ID,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	err = revokeUserSessions(r.Context(), api, userInfo.ID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	err = api.Db.InvalidatePasswordResetTokens(r.Context(), database.InvalidatePasswordResetTokensParams{
+		UsedAt: sql.NullTime{
+			Time:  now,
+			Valid: true,
+		},
+		UserID: userInfo.ID,
+	})
+	if err != nil {
+		log.Printf("Password reset, but other reset tokens could not be invalidated: %v", err)
+	}
+
+	log.Printf("Password reset for user %v", userInfo.ID)
+	writeSuccessResponse(w, http.StatusNoContent, "")
+}
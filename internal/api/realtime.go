@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/Walther-Knight/chirpy/internal/models"
+	"github.com/Walther-Knight/chirpy/internal/realtime"
+	"github.com/coder/websocket"
+	"github.com/google/uuid"
+)
+
+const (
+	// a client that does not answer a ping within this time is gone
+	realtimePongTimeout = 45 * time.Second
+	// a slow client blocks writes for at most this long before it is cut off
+	realtimeWriteTimeout = 10 * time.Second
+	// access tokens expire after an hour, connections do not outlive them by
+	// more than that
+	realtimeMaxLifetime      = time.Hour
+	realtimeMaxSubscriptions = 100
+	realtimeMaxMessage       = 4096
+	// events one connection may have waiting before it is cut off
+	realtimeBuffer = 256
+)
+
+// realtimePingInterval is also how often a connection checks that its
+// session has not been revoked.
+var realtimePingInterval = 30 * time.Second
+
+// sameOrigin reports whether a browser request comes from Chirpy's own
+// pages. Other clients send no Origin.
+func sameOrigin(api *middleware.ApiConfig, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	o, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	base, err := url.Parse(api.BaseURL)
+	return err == nil && o.Scheme == base.Scheme && o.Host == base.Host
+}
+
+// handleRealtimeCommand applies a subscribe or unsubscribe to subs, keyed by
+// channel key with the channel as the client named it.
+func handleRealtimeCommand(subs map[string]string, userID uuid.UUID, cmd models.RealtimeCommand) models.RealtimeMessage {
+	reply := models.RealtimeMessage{ID: cmd.ID, Channel: cmd.Channel}
+	if cmd.Type != "subscribe" && cmd.Type != "unsubscribe" {
+		reply.Type, reply.Code, reply.Error = "error", "invalid_command", "type must be subscribe or unsubscribe"
+		return reply
+	}
+	key, err := realtime.Key(cmd.Channel, userID)
+	if err != nil {
+		reply.Type, reply.Code, reply.Error = "error", "unknown_channel", "unknown channel "+cmd.Channel
+		return reply
+	}
+	if cmd.Type == "unsubscribe" {
+		delete(subs, key)
+		reply.Type = "unsubscribed"
+		return reply
+	}
+	if _, ok := subs[key]; !ok && len(subs) >= realtimeMaxSubscriptions {
+		reply.Type, reply.Code, reply.Error = "error", "too_many_subscriptions", "a connection can subscribe to at most 100 channels"
+		return reply
+	}
+	subs[key] = cmd.Channel
+	reply.Type = "subscribed"
+	return reply
+}
+
+// Realtime upgrades to a WebSocket on which the client subscribes to
+// channels and receives their events as they are published.
+func Realtime(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !sameOrigin(api, r) {
+		writeErrorCode(w, http.StatusForbidden, "origin_not_allowed", "cross-origin WebSocket connections are not allowed")
+		return
+	}
+	if !api.RealtimeConns.Acquire(userID) {
+		writeErrorCode(w, http.StatusTooManyRequests, "too_many_connections", "too many open realtime connections")
+		return
+	}
+	defer api.RealtimeConns.Release(userID)
+
+	//subscribe before the upgrade, so the client misses nothing published after it
+	events, unsubscribe := api.Bus.Subscribe(realtimeBuffer)
+	defer unsubscribe()
+
+	principal, _ := auth.PrincipalFrom(r.Context())
+	//the origin is checked against BASE_URL above, not the Host header
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{InsecureSkipVerify: true})
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(realtimeMaxMessage)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	commands := make(chan models.RealtimeCommand)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			op, data, err := conn.Read(ctx)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			cmd := models.RealtimeCommand{}
+			if op != websocket.MessageText || json.Unmarshal(data, &cmd) != nil {
+				cmd.Type = ""
+			}
+			select {
+			case commands <- cmd:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	send := func(msg models.RealtimeMessage) error {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		writeCtx, cancel := context.WithTimeout(ctx, realtimeWriteTimeout)
+		defer cancel()
+		return conn.Write(writeCtx, websocket.MessageText, data)
+	}
+
+	subs := map[string]string{}
+	ping := time.NewTicker(realtimePingInterval)
+	defer ping.Stop()
+	lifetime := time.NewTimer(realtimeMaxLifetime)
+	defer lifetime.Stop()
+	for {
+		select {
+		case cmd := <-commands:
+			if send(handleRealtimeCommand(subs, userID, cmd)) != nil {
+				return
+			}
+		case e, ok := <-events:
+			if !ok {
+				conn.Close(websocket.StatusTryAgainLater, "fell behind, reconnect")
+				return
+			}
+			for _, key := range realtime.Route(e) {
+				channel, subscribed := subs[key]
+				if !subscribed {
+					continue
+				}
+				err := send(models.RealtimeMessage{
+					Type:    "event",
+					Channel: channel,
+					Event:   e.Type,
+					EventID: &e.ID,
+					Data:    e.Data,
+				})
+				if err != nil {
+					return
+				}
+			}
+		case <-ping.C:
+			//a password change or session revocation bumps the token version
+			version, err := api.TokenVersions.Get(ctx, userID)
+			if err == nil && version != principal.TokenVersion {
+				conn.Close(websocket.StatusPolicyViolation, "session revoked")
+				return
+			}
+			if err != nil {
+				log.Printf("Error loading token version for user %v: %v", userID, err)
+			}
+			pingCtx, cancel := context.WithTimeout(ctx, realtimePongTimeout)
+			err = conn.Ping(pingCtx)
+			cancel()
+			if err != nil {
+				return
+			}
+		case <-lifetime.C:
+			conn.Close(websocket.StatusGoingAway, "session expired, reconnect with a fresh token")
+			return
+		case err := <-readErr:
+			if websocket.CloseStatus(err) == -1 {
+				log.Printf("Realtime connection of user %v ended: %v", userID, err)
+			}
+			return
+		}
+	}
+}
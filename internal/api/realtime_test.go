@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/outbox"
+	"github.com/Walther-Knight/chirpy/internal/realtime"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/google/uuid"
+)
+
+func TestRealtimeClosesRevokedSession(t *testing.T) {
+	pingInterval := realtimePingInterval
+	realtimePingInterval = 20 * time.Millisecond
+	t.Cleanup(func() { realtimePingInterval = pingInterval })
+
+	api, _, _ := newTestAPI(t)
+	api.Bus = outbox.NewBus()
+	api.RealtimeConns = realtime.NewConnLimiter(5)
+	api.TokenVersions = auth.NewVersionCache(time.Minute, func(ctx context.Context, userID uuid.UUID) (int32, error) {
+		return 0, nil
+	})
+	userID := uuid.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := &auth.Principal{UserID: userID, Roles: auth.RolesFor(auth.RoleUser), Scopes: auth.AllScopes, Method: auth.MethodSession}
+		Realtime(api, w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.CloseNow()
+
+	//the connection works until the session is revoked
+	err = wsjson.Write(ctx, conn, map[string]string{"type": "subscribe", "channel": "chirps"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := map[string]any{}
+	if err := wsjson.Read(ctx, conn, &reply); err != nil || reply["type"] != "subscribed" {
+		t.Fatalf("reply = %v, %v", reply, err)
+	}
+
+	api.TokenVersions.Set(userID, 1)
+	_, _, err = conn.Read(ctx)
+	if websocket.CloseStatus(err) != websocket.StatusPolicyViolation {
+		t.Errorf("Read() = %v, want close with %v", err, websocket.StatusPolicyViolation)
+	}
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/Walther-Knight/chirpy/internal/models"
+	"github.com/Walther-Knight/chirpy/internal/sse"
+	"github.com/Walther-Knight/chirpy/internal/webhooks"
+	"github.com/google/uuid"
+)
+
+const (
+	streamHeartbeat = 15 * time.Second
+	streamRetry     = 3 * time.Second
+	// live events one connection may have waiting before it is cut off
+	streamBuffer     = 64
+	streamReplayPage = 100
+)
+
+// chirpCursor is a position in the stream, which is ordered like a resume
+// query: by publish time, then ID.
+type chirpCursor struct {
+	PublishAt time.Time
+	ID        uuid.UUID
+}
+
+// String is the SSE event ID of the chirp at c.
+func (c chirpCursor) String() string {
+	return fmt.Sprintf("%d-%s", c.PublishAt.UnixMicro(), c.ID)
+}
+
+func parseChirpCursor(s string) (chirpCursor, error) {
+	micros, id, found := strings.Cut(s, "-")
+	if !found {
+		return chirpCursor{}, errors.New("malformed event ID")
+	}
+	n, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return chirpCursor{}, err
+	}
+	chirpID, err := uuid.Parse(id)
+	if err != nil {
+		return chirpCursor{}, err
+	}
+	//timestamps are stored without a zone, they come back from the database as UTC
+	return chirpCursor{PublishAt: time.UnixMicro(n).UTC(), ID: chirpID}, nil
+}
+
+// StreamChirps pushes chirps as they are published. With Last-Event-ID the
+// chirps published since that event are sent first. A connection that falls
+// behind is closed, the client reconnects and catches up the same way.
+func StreamChirps(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	var author uuid.NullUUID
+	if s := r.URL.Query().Get("author_id"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "error: invalid author_id")
+			return
+		}
+		author = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	//EventSource sets the header on reconnects, the query parameter lets a new page resume
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var after *chirpCursor
+	if lastEventID != "" {
+		c, err := parseChirpCursor(lastEventID)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "error: invalid Last-Event-ID")
+			return
+		}
+		after = &c
+	}
+
+	//subscribe before catching up, so nothing published meanwhile is missed
+	events, unsubscribe := api.Bus.Subscribe(streamBuffer)
+	defer unsubscribe()
+
+	stream, err := sse.NewWriter(w, streamRetry)
+	if err != nil {
+		log.Printf("Error starting chirp stream: %v", err)
+		return
+	}
+
+	send := func(chirp models.Chirp, c chirpCursor) error {
+		data, err := json.Marshal(chirp)
+		if err != nil {
+			return err
+		}
+		return stream.Event(c.String(), webhooks.EventChirpCreated, data)
+	}
+
+	//chirps sent while catching up, the bus may deliver them again
+	replayed := map[uuid.UUID]bool{}
+	for after != nil {
+		page, err := api.Db.ListChirpsAfter(r.Context(), database.ListChirpsAfterParams{
+			AfterPublishAt: after.PublishAt,
+			AfterID:        after.ID,
+			Now:            time.Now(),
+			AuthorID:       author,
+			Limit:          streamReplayPage,
+		})
+		if err != nil {
+			log.Printf("Error on database: %v", err)
+			return
+		}
+		for _, chirp := range page {
+			c := chirpCursor{PublishAt: chirp.PublishAt, ID: chirp.ID}
+			if send(chirpResponse(chirp), c) != nil {
+				return
+			}
+			replayed[chirp.ID] = true
+			after = &c
+		}
+		if len(page) < streamReplayPage {
+			break
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if e.Type != webhooks.EventChirpCreated {
+				continue
+			}
+			var chirp models.Chirp
+			err := json.Unmarshal(e.Data, &chirp)
+			if err != nil {
+				log.Printf("Error decoding event %v: %v", e.ID, err)
+				continue
+			}
+			chirpID, err := uuid.Parse(chirp.ID)
+			if err != nil || replayed[chirpID] {
+				continue
+			}
+			if author.Valid && chirp.UserID != author.UUID.String() {
+				continue
+			}
+			if send(chirp, chirpCursor{PublishAt: chirp.PublishedAt, ID: chirpID}) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if stream.Comment("heartbeat") != nil {
+				return
+			}
+		}
+	}
+}
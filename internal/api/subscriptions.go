@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/Walther-Knight/chirpy/internal/models"
+	"github.com/Walther-Knight/chirpy/internal/outbox"
+	"github.com/Walther-Knight/chirpy/internal/subscription"
+	"github.com/Walther-Knight/chirpy/internal/webhooks"
+	"github.com/google/uuid"
+)
+
+func subscriptionFromRow(row database.Subscription) subscription.Subscription {
+	s := subscription.Subscription{
+		Plan:             row.Plan,
+		Status:           row.Status,
+		CurrentPeriodEnd: row.CurrentPeriodEnd,
+	}
+	if row.CancelledAt.Valid {
+		s.CancelledAt = &row.CancelledAt.Time
+	}
+	return s
+}
+
+// applySubscriptionEvent moves the user's subscription to its next state and
+// updates is_chirpy_red in the same statement. Gaining Chirpy Red records a
+// user.upgraded event. Everything happens in the caller's transaction, which
+// also records the webhook event carrying it as processed.
+func applySubscriptionEvent(ctx context.Context, api *middleware.ApiConfig, q *database.Queries, userID uuid.UUID, event subscription.Event) (subscription.Subscription, error) {
+	now := time.Now()
+	var current *subscription.Subscription
+	//the row stays locked until commit so concurrent events for the user apply in turn
+	row, err := q.GetSubscriptionForUpdate(ctx, userID)
+	if err == nil {
+		s := subscriptionFromRow(row)
+		current = &s
+	} else if err != sql.ErrNoRows {
+		return subscription.Subscription{}, err
+	}
+
+	next, err := subscription.Apply(current, event, now, api.SubscriptionPeriod)
+	if err != nil {
+		return next, err
+	}
+
+	cancelledAt := sql.NullTime{}
+	if next.CancelledAt != nil {
+		cancelledAt = sql.NullTime{Time: *next.CancelledAt, Valid: true}
+	}
+	err = q.SaveSubscription(ctx, database.SaveSubscriptionParams{
+		UserID:           userID,
+		Plan:             next.Plan,
+		Status:           next.Status,
+		CurrentPeriodEnd: next.CurrentPeriodEnd,
+		CancelledAt:      cancelledAt,
+		UpdatedAt:        now,
+		IsChirpyRed:      next.Entitled(now),
+	})
+	if err != nil {
+		return next, err
+	}
+
+	if !next.Entitled(now) || (current != nil && current.Entitled(now)) {
+		return next, nil
+	}
+	type upgraded struct {
+		UserID       uuid.UUID           `json:"user_id"`
+		Subscription models.Subscription `json:"subscription"`
+	}
+	return next, outbox.Record(ctx, q, userID, webhooks.EventUserUpgraded, upgraded{
+		UserID: userID,
+		Subscription: models.Subscription{
+			Plan:             next.Plan,
+			Status:           next.Status,
+			CurrentPeriodEnd: next.CurrentPeriodEnd,
+		},
+	}, now)
+}
+
+// attachSubscription adds the user's subscription, if any, to a response.
+// A lookup failure only omits it.
+func attachSubscription(ctx context.Context, api *middleware.ApiConfig, res *models.User) {
+	row, err := api.Db.GetSubscription(ctx, res.ID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error on database: %v", err)
+		}
+		return
+	}
+	res.Subscription = &models.Subscription{
+		Plan:             row.Plan,
+		Status:           row.Status,
+		CurrentPeriodEnd: row.CurrentPeriodEnd,
+	}
+	if row.CancelledAt.Valid {
+		res.Subscription.CancelledAt = &row.CancelledAt.Time
+	}
+}
+
+// attachEntitlements adds the user's paid features to a response. A lookup
+// failure only omits them.
+func attachEntitlements(ctx context.Context, api *middleware.ApiConfig, res *models.User) {
+	features, err := api.Entitlements.Features(ctx, res.ID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		return
+	}
+	res.Entitlements = features
+}
+
+// expireSubscriptions revokes Chirpy Red from subscriptions whose period has
+// ended without a renewal.
+func expireSubscriptions(ctx context.Context, api *middleware.ApiConfig) error {
+	rows, err := api.Db.ExpireSubscriptions(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	if rows > 0 {
+		log.Printf("Expired %d Chirpy Red subscriptions", rows)
+	}
+	return nil
+}
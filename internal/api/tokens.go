@@ -0,0 +1,164 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/Walther-Knight/chirpy/internal/models"
+	"github.com/google/uuid"
+)
+
+func personalAccessTokenResponse(pat database.PersonalAccessToken) models.PersonalAccessToken {
+	res := models.PersonalAccessToken{
+		ID:        pat.ID,
+		Name:      pat.Name,
+		Scopes:    auth.SplitScopes(pat.Scopes),
+		CreatedAt: pat.CreatedAt,
+	}
+	if pat.ExpiresAt.Valid {
+		res.ExpiresAt = &pat.ExpiresAt.Time
+	}
+	if pat.LastUsedAt.Valid {
+		res.LastUsedAt = &pat.LastUsedAt.Time
+	}
+	return res
+}
+
+// Personal access tokens can only be managed from an interactive session,
+// a leaked token must not be able to mint more tokens.
+func CreatePersonalAccessToken(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	type reqParams struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	params := reqParams{}
+	errDecode := decodeJSONBody(r, &params)
+
+	if errDecode != nil {
+		log.Printf("Error decoding parameters: %s", errDecode)
+		writeErrorResponse(w, http.StatusBadRequest, "error decoding JSON")
+		return
+	}
+
+	if params.Name == "" || len(params.Name) > 100 {
+		writeErrorResponse(w, http.StatusBadRequest, "token name must be 1 to 100 characters")
+		return
+	}
+	scopes, err := auth.ParseScopes(params.Scopes)
+	if err != nil {
+		writeErrorCode(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		return
+	}
+	if params.ExpiresInDays < 0 {
+		writeErrorResponse(w, http.StatusBadRequest, "expires_in_days must not be negative")
+		return
+	}
+
+	tokenString, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "token creation failed")
+		return
+	}
+
+	//0 days means the token never expires
+	expiresAt := sql.NullTime{}
+	if params.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{
+			Time:  time.Now().AddDate(0, 0, params.ExpiresInDays),
+			Valid: true,
+		}
+	}
+
+	res, err := api.Db.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      params.Name,
+		TokenHash: auth.HashToken(tokenString),
+		Scopes:    auth.JoinScopes(scopes),
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	ResJson := personalAccessTokenResponse(res)
+	//the plaintext token is only ever returned here
+	ResJson.Token = tokenString
+	log.Printf("Personal access token %v created for user %v", res.ID, userID)
+	writeSuccessResponse(w, http.StatusCreated, ResJson)
+}
+
+func ListPersonalAccessTokens(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := api.Db.ListPersonalAccessTokens(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	ResJson := []models.PersonalAccessToken{}
+	for _, pat := range res {
+		ResJson = append(ResJson, personalAccessTokenResponse(pat))
+	}
+	writeSuccessResponse(w, http.StatusOK, ResJson)
+}
+
+func RevokePersonalAccessToken(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "error: token ID does not exist")
+		return
+	}
+
+	rows, err := api.Db.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		RevokedAt: sql.NullTime{
+			Time:  time.Now(),
+			Valid: true,
+		},
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	if rows == 0 {
+		writeErrorResponse(w, http.StatusNotFound, "error: token ID does not exist")
+		return
+	}
+
+	log.Printf("Personal access token %v revoked", tokenID)
+	writeSuccessResponse(w, http.StatusNoContent, "")
+}
@@ -0,0 +1,427 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/Walther-Knight/chirpy/internal/models"
+	"github.com/Walther-Knight/chirpy/internal/webhooks"
+	"github.com/google/uuid"
+)
+
+const (
+	webhookSecretPrefix = "whsec_"
+	webhookBatchSize    = 20
+)
+
+func webhookSubscriptionResponse(s database.WebhookSubscription) models.WebhookSubscription {
+	return models.WebhookSubscription{
+		ID:         s.ID,
+		URL:        s.Url,
+		Events:     webhooks.SplitEvents(s.Events),
+		AllUsers:   s.AllUsers,
+		Disabled:   s.DisabledAt.Valid,
+		DisabledAt: optionalTime(s.DisabledAt),
+		CreatedAt:  s.CreatedAt,
+	}
+}
+
+func webhookDeliveryResponse(d database.WebhookDelivery) models.WebhookDelivery {
+	res := models.WebhookDelivery{
+		ID:          d.ID,
+		EventID:     d.EventID,
+		EventType:   d.EventType,
+		Payload:     d.Payload,
+		Status:      d.Status,
+		Attempts:    d.Attempts,
+		LastError:   d.LastError.String,
+		CreatedAt:   d.CreatedAt,
+		DeliveredAt: optionalTime(d.DeliveredAt),
+	}
+	if d.Status == "pending" {
+		res.NextAttemptAt = &d.NextAttemptAt
+	}
+	if d.ResponseStatus.Valid {
+		res.ResponseStatus = &d.ResponseStatus.Int32
+	}
+	return res
+}
+
+// webhookSubscriptionFromPath loads the subscription named in the path if it
+// belongs to the caller, writing the error response otherwise.
+func webhookSubscriptionFromPath(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request, userID uuid.UUID) (database.WebhookSubscription, bool) {
+	id, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "error: webhook ID does not exist")
+		return database.WebhookSubscription{}, false
+	}
+	res, err := api.Db.GetWebhookSubscription(r.Context(), database.GetWebhookSubscriptionParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(w, http.StatusNotFound, "error: webhook ID does not exist")
+			return database.WebhookSubscription{}, false
+		}
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return database.WebhookSubscription{}, false
+	}
+	return res, true
+}
+
+func CreateWebhookSubscription(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	type reqParams struct {
+		URL      string   `json:"url"`
+		Events   []string `json:"events"`
+		AllUsers bool     `json:"all_users"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	params := reqParams{}
+	errDecode := decodeJSONBody(r, &params)
+
+	if errDecode != nil {
+		log.Printf("Error decoding parameters: %s", errDecode)
+		writeErrorResponse(w, http.StatusBadRequest, "error decoding JSON")
+		return
+	}
+
+	//plain http and local receivers are only allowed while developing locally
+	if err := webhooks.ValidateURL(r.Context(), params.URL, api.Platform == "dev"); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, "invalid_url", err.Error())
+		return
+	}
+	events, err := webhooks.ParseEvents(params.Events)
+	if err != nil {
+		writeErrorCode(w, http.StatusBadRequest, "invalid_event", err.Error())
+		return
+	}
+	if params.AllUsers {
+		//the route needs no role, so the principal does not carry the user's role
+		role, err := api.Db.GetUserRole(r.Context(), userID)
+		if err != nil {
+			log.Printf("Error on database: %v", err)
+			writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+			return
+		}
+		if role != auth.RoleAdmin {
+			writeErrorCode(w, http.StatusForbidden, "forbidden", "only admins can subscribe to events of all users")
+			return
+		}
+	}
+
+	secret, err := auth.MakeRefreshToken()
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "webhook secret creation failed")
+		return
+	}
+
+	res, err := api.Db.CreateWebhookSubscription(r.Context(), database.CreateWebhookSubscriptionParams{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Url:       params.URL,
+		Secret:    webhookSecretPrefix + secret,
+		Events:    webhooks.JoinEvents(events),
+		AllUsers:  params.AllUsers,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	ResJson := webhookSubscriptionResponse(res)
+	//receivers need the secret to verify signatures, it is only returned here
+	ResJson.Secret = res.Secret
+	log.Printf("Webhook %v registered by user %v", res.ID, userID)
+	writeSuccessResponse(w, http.StatusCreated, ResJson)
+}
+
+func ListWebhookSubscriptions(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := api.Db.ListWebhookSubscriptions(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	ResJson := []models.WebhookSubscription{}
+	for _, s := range res {
+		ResJson = append(ResJson, webhookSubscriptionResponse(s))
+	}
+	writeSuccessResponse(w, http.StatusOK, ResJson)
+}
+
+// DeleteWebhookSubscription also drops the subscription's delivery log and
+// any deliveries still queued.
+func DeleteWebhookSubscription(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "error: webhook ID does not exist")
+		return
+	}
+	rows, err := api.Db.DeleteWebhookSubscription(r.Context(), database.DeleteWebhookSubscriptionParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+	if rows == 0 {
+		writeErrorResponse(w, http.StatusNotFound, "error: webhook ID does not exist")
+		return
+	}
+
+	log.Printf("Webhook %v deleted", id)
+	writeSuccessResponse(w, http.StatusNoContent, "")
+}
+
+func DisableWebhookSubscription(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	setWebhookSubscriptionDisabled(api, w, r, true)
+}
+
+func EnableWebhookSubscription(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	setWebhookSubscriptionDisabled(api, w, r, false)
+}
+
+// setWebhookSubscriptionDisabled pauses or resumes a subscription. Events
+// are not queued while it is disabled, deliveries already queued wait and are
+// sent once it is enabled again.
+func setWebhookSubscriptionDisabled(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request, disabled bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	current, ok := webhookSubscriptionFromPath(api, w, r, userID)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	disabledAt := current.DisabledAt
+	if disabled && !disabledAt.Valid {
+		disabledAt = sql.NullTime{Time: now, Valid: true}
+	} else if !disabled {
+		disabledAt = sql.NullTime{}
+	}
+	res, err := api.Db.SetWebhookSubscriptionDisabled(r.Context(), database.SetWebhookSubscriptionDisabledParams{
+		DisabledAt: disabledAt,
+		UpdatedAt:  now,
+		ID:         current.ID,
+		UserID:     userID,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	writeSuccessResponse(w, http.StatusOK, webhookSubscriptionResponse(res))
+}
+
+// TestWebhookSubscription sends a webhook.test event right away, also to a
+// disabled subscription, and returns the logged delivery. It is not retried.
+func TestWebhookSubscription(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	sub, ok := webhookSubscriptionFromPath(api, w, r, userID)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	eventID := uuid.New()
+	body, err := webhooks.NewEnvelope(eventID, webhooks.EventTest, map[string]uuid.UUID{"subscription_id": sub.ID}, now)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "webhook event creation failed")
+		return
+	}
+	delivery, err := api.Db.CreateWebhookDelivery(r.Context(), database.CreateWebhookDeliveryParams{
+		ID:             uuid.New(),
+		SubscriptionID: sub.ID,
+		EventID:        eventID,
+		EventType:      webhooks.EventTest,
+		Payload:        body,
+		CreatedAt:      now,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	delivery = attemptWebhookDelivery(r.Context(), api, delivery, sub.Url, sub.Secret, false)
+	writeSuccessResponse(w, http.StatusOK, webhookDeliveryResponse(delivery))
+}
+
+func ListWebhookDeliveries(api *middleware.ApiConfig, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	sub, ok := webhookSubscriptionFromPath(api, w, r, userID)
+	if !ok {
+		return
+	}
+
+	limit := int32(50)
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 500 {
+		limit = int32(n)
+	}
+	res, err := api.Db.ListWebhookDeliveries(r.Context(), database.ListWebhookDeliveriesParams{
+		SubscriptionID: sub.ID,
+		Limit:          limit,
+	})
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "database error reported")
+		return
+	}
+
+	ResJson := []models.WebhookDelivery{}
+	for _, d := range res {
+		ResJson = append(ResJson, webhookDeliveryResponse(d))
+	}
+	writeSuccessResponse(w, http.StatusOK, ResJson)
+}
+
+// attemptWebhookDelivery sends one delivery and records the outcome. A failed
+// delivery is rescheduled with backoff when retry is set, otherwise failed.
+func attemptWebhookDelivery(ctx context.Context, api *middleware.ApiConfig, d database.WebhookDelivery, url, secret string, retry bool) database.WebhookDelivery {
+	status, err := api.Webhooks.Send(ctx, webhooks.Delivery{
+		ID:        d.ID,
+		EventType: d.EventType,
+		URL:       url,
+		Secret:    secret,
+		Body:      d.Payload,
+	}, time.Now())
+
+	now := time.Now()
+	attempts := d.Attempts
+	d.Attempts++
+	d.NextAttemptAt = now
+	d.ResponseStatus = sql.NullInt32{Int32: int32(status), Valid: status != 0}
+	d.LastError = sql.NullString{}
+	if err == nil {
+		d.Status = "succeeded"
+		d.DeliveredAt = sql.NullTime{Time: now, Valid: true}
+	} else {
+		d.LastError = sql.NullString{String: err.Error(), Valid: true}
+		d.Status = "failed"
+		if next, ok := api.Webhooks.NextAttempt(int(d.Attempts), now); ok && retry {
+			d.Status = "pending"
+			d.NextAttemptAt = next
+		}
+	}
+
+	//only recorded if no other replica has claimed the delivery after the
+	//lease expired and recorded its attempt first
+	rows, errFinish := api.Db.FinishWebhookDelivery(ctx, database.FinishWebhookDeliveryParams{
+		Status:         d.Status,
+		NextAttemptAt:  d.NextAttemptAt,
+		ResponseStatus: d.ResponseStatus,
+		LastError:      d.LastError,
+		DeliveredAt:    d.DeliveredAt,
+		ID:             d.ID,
+		Attempts:       attempts,
+	})
+	if errFinish != nil {
+		log.Printf("Error on database: %v", errFinish)
+	} else if rows == 0 {
+		log.Printf("Outcome of webhook delivery %v discarded, another attempt was recorded first", d.ID)
+	}
+	return d
+}
+
+// deliverWebhooks sends the deliveries that are due. Claimed deliveries are
+// leased past the send timeout, so other replicas skip them and a crash
+// only delays them.
+func deliverWebhooks(ctx context.Context, api *middleware.ApiConfig) (int, error) {
+	now := time.Now()
+	claimed, err := api.Db.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+		LeaseUntil: now.Add(2 * time.Minute),
+		Now:        now,
+		Limit:      webhookBatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	wg := sync.WaitGroup{}
+	for _, c := range claimed {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attemptWebhookDelivery(ctx, api, database.WebhookDelivery{
+				ID:        c.ID,
+				EventType: c.EventType,
+				Payload:   c.Payload,
+				Attempts:  c.Attempts,
+			}, c.Url, c.Secret, true)
+		}()
+	}
+	wg.Wait()
+	return len(claimed), nil
+}
+
+// RunWebhookDispatcher sends queued webhook deliveries. A full batch is
+// followed by the next one right away. It never returns.
+func RunWebhookDispatcher(api *middleware.ApiConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		n, err := deliverWebhooks(ctx, api)
+		cancel()
+		if err != nil {
+			log.Printf("Error on database: %v", err)
+		}
+		if n < webhookBatchSize {
+			<-ticker.C
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/webhooks"
+	"github.com/google/uuid"
+)
+
+func TestCreateWebhookSubscriptionRejectsLocalURL(t *testing.T) {
+	for _, url := range []string{"https://127.0.0.1/hooks", "https://169.254.169.254/latest/meta-data/", "https://[fd00:ec2::254]/", "https://10.0.0.1/"} {
+		t.Run(url, func(t *testing.T) {
+			//the database is never reached, sqlmock fails the test otherwise
+			api, _, _ := newTestAPI(t)
+			body := `{"url":"` + url + `","events":["chirp.created"]}`
+			r := withUser(httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(body)), uuid.New())
+			w := httptest.NewRecorder()
+			CreateWebhookSubscription(api, w, r)
+
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"code":"invalid_url"`) {
+				t.Errorf("status = %d: %s, want 400 invalid_url", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestCreateWebhookSubscriptionAllUsers(t *testing.T) {
+	tests := []struct {
+		role     string
+		wantCode int
+	}{
+		{auth.RoleAdmin, http.StatusCreated},
+		{auth.RoleUser, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			api, mock, _ := newTestAPI(t)
+			userID := uuid.New()
+			mock.ExpectQuery("SELECT role").WithArgs(userID).WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(tt.role))
+			if tt.wantCode == http.StatusCreated {
+				now := time.Now()
+				mock.ExpectQuery("INSERT INTO webhook_subscriptions").
+					WithArgs(sqlmock.AnyArg(), userID, "https://93.184.216.34/hooks", sqlmock.AnyArg(), "chirp.created", true, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "url", "secret", "events", "all_users", "disabled_at", "created_at", "updated_at"}).
+						AddRow(uuid.NewString(), userID.String(), "https://93.184.216.34/hooks", "whsec_x", "chirp.created", true, nil, now, now))
+			}
+
+			body := `{"url":"https://93.184.216.34/hooks","events":["chirp.created"],"all_users":true}`
+			r := withUser(httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(body)), userID)
+			w := httptest.NewRecorder()
+			CreateWebhookSubscription(api, w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d: %s, want %d", w.Code, w.Body, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestAttemptWebhookDeliveryRecordsOnlyItsOwnAttempt(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	for _, rows := range []int64{1, 0} {
+		api, mock, _ := newTestAPI(t)
+		api.Webhooks = &webhooks.Sender{Client: srv.Client(), MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute}
+		d := database.WebhookDelivery{ID: uuid.New(), EventType: webhooks.EventChirpCreated, Payload: []byte(`{}`), Attempts: 2}
+
+		//zero rows: another replica claimed the delivery after the lease expired
+		//and recorded its attempt first
+		mock.ExpectExec(regexp.QuoteMeta("WHERE id = $6 AND status = 'pending' AND attempts = $7")).
+			WithArgs("succeeded", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), d.ID, int32(2)).
+			WillReturnResult(sqlmock.NewResult(0, rows))
+
+		got := attemptWebhookDelivery(context.Background(), api, d, srv.URL, "whsec_x", true)
+		if got.Status != "succeeded" || got.Attempts != 3 {
+			t.Errorf("attemptWebhookDelivery() = %s after %d attempts, want succeeded after 3", got.Status, got.Attempts)
+		}
+	}
+}
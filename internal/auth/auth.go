@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"log"
@@ -11,31 +12,79 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
+var defaultHasher = &Hasher{cfg: DefaultHashConfig}
+
+// HashPassword hashes with DefaultHashConfig. Handlers use the configured
+// ApiConfig.Hasher instead.
 func HashPassword(password string) (string, error) {
-	pwd := []byte(password)
-	hashedPass, errHash := bcrypt.GenerateFromPassword(pwd, 3)
+	hashedPass, errHash := defaultHasher.Hash(password)
 	if errHash != nil {
 		log.Printf("error hashing password: %v", errHash)
 		return "", errHash
 	}
-	return string(hashedPass), nil
+	return hashedPass, nil
 }
 
 func CheckPasswordHash(hash, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	return defaultHasher.Check(hash, password)
+}
+
+// Claims are the JWT claims issued by chirpy. TokenVersion is compared against
+// the user's current token_version on every authenticated request so that
+// access tokens can be revoked before they expire.
+type Claims struct {
+	jwt.RegisteredClaims
+	TokenVersion int32 `json:"ver"`
+	// Purpose is empty for access tokens. Tokens issued for another purpose,
+	// such as an MFA challenge, are never accepted as access tokens.
+	Purpose string `json:"purpose,omitempty"`
+	// ClientID and Scope are set on access tokens issued to OAuth clients
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// PendingDeletion marks sessions of accounts scheduled for deletion
+	PendingDeletion bool      `json:"pending_deletion,omitempty"`
+	UserID          uuid.UUID `json:"-"`
+}
+
+const PurposeMFA = "mfa"
+
+func MakeJWT(userID uuid.UUID, tokenVersion int32, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return makeToken(userID, Claims{TokenVersion: tokenVersion}, tokenSecret, expiresIn)
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+// MakePendingDeletionJWT issues an access token for an account scheduled for
+// deletion, which only routes that allow it accept.
+func MakePendingDeletionJWT(userID uuid.UUID, tokenVersion int32, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return makeToken(userID, Claims{TokenVersion: tokenVersion, PendingDeletion: true}, tokenSecret, expiresIn)
+}
+
+// MakeMFAToken issues the short-lived challenge returned by login when the
+// user has two-factor authentication enabled.
+func MakeMFAToken(userID uuid.UUID, tokenVersion int32, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return makeToken(userID, Claims{TokenVersion: tokenVersion, Purpose: PurposeMFA}, tokenSecret, expiresIn)
+}
+
+// MakeClientJWT issues an access token for a third-party OAuth client that
+// is limited to scopes.
+func MakeClientJWT(userID uuid.UUID, tokenVersion int32, clientID string, scopes []string, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return makeToken(userID, Claims{
+		TokenVersion: tokenVersion,
+		ClientID:     clientID,
+		Scope:        JoinScopes(scopes),
+	}, tokenSecret, expiresIn)
+}
+
+func makeToken(userID uuid.UUID, claims Claims, tokenSecret string, expiresIn time.Duration) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
 		Issuer:   "chirpy",
 		IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
 		//expiresIn defined in api.UserLogin()
 		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
 		Subject:   userID.String(),
-	})
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	secretKey := []byte(tokenSecret)
 	tokenString, err := token.SignedString(secretKey)
 	if err != nil {
@@ -46,26 +95,38 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 	return tokenString, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := &jwt.RegisteredClaims{}
+func ValidateJWT(tokenString, tokenSecret string) (*Claims, error) {
+	return parseToken(tokenString, "", tokenSecret)
+}
+
+func ValidateMFAToken(tokenString, tokenSecret string) (*Claims, error) {
+	return parseToken(tokenString, PurposeMFA, tokenSecret)
+}
+
+func parseToken(tokenString, purpose, tokenSecret string) (*Claims, error) {
+	claims := &Claims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		return []byte(tokenSecret), nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if err != nil {
 		log.Printf("authentication error decoding token: %v", err)
-		return uuid.Nil, err
+		return nil, err
 	}
 	if !token.Valid {
-		return uuid.Nil, errors.New("invalid token")
+		return nil, errors.New("invalid token")
+	}
+	if claims.Purpose != purpose {
+		return nil, errors.New("token issued for a different purpose")
 	}
 
 	userID, err := uuid.Parse(claims.Subject)
 	if err != nil {
-		return uuid.Nil, err
+		return nil, err
 	}
+	claims.UserID = userID
 
-	return userID, nil
+	return claims, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -85,10 +146,18 @@ func MakeRefreshToken() (string, error) {
 	_, err := rand.Read(tokenSeed)
 	if err != nil {
 		log.Printf("error seeding refresh token: %v", err)
+		return "", err
 	}
 	return hex.EncodeToString(tokenSeed), nil
 }
 
+// HashToken returns the SHA-256 hex digest of a random token. Single-use
+// tokens such as password reset tokens are stored only in hashed form.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	apiString, found := strings.CutPrefix(headers.Get("Authorization"), "ApiKey ")
 	apiString = strings.TrimSpace(apiString)
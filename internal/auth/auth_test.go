@@ -29,15 +29,91 @@ func TestJWT(t *testing.T) {
 	userID := uuid.New()
 	tokenSecret := "dfahjkghfhjgashaghfjkhgajfgl"
 	expiresIn := 2 * time.Hour
-	testJWT, err := MakeJWT(userID, tokenSecret, expiresIn)
+	testJWT, err := MakeJWT(userID, 3, tokenSecret, expiresIn)
 	if err != nil {
 		t.Error(err)
 	}
 	res, err := ValidateJWT(testJWT, tokenSecret)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
-	if res != userID {
+	if res.UserID != userID {
 		t.Fatal()
 	}
+	if res.TokenVersion != 3 {
+		t.Fatalf("expected token version 3, got %d", res.TokenVersion)
+	}
+	if res.PendingDeletion {
+		t.Fatal("expected a regular session")
+	}
+	pendingJWT, err := MakePendingDeletionJWT(userID, 3, tokenSecret, expiresIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = ValidateJWT(pendingJWT, tokenSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.PendingDeletion || res.UserID != userID {
+		t.Fatalf("expected a pending deletion session for %s, got %+v", userID, res)
+	}
+}
+
+func TestArgon2Hasher(t *testing.T) {
+	hasher, err := NewHasher(HashConfig{
+		Algorithm:     AlgorithmArgon2id,
+		Argon2Memory:  8 * 1024,
+		Argon2Time:    1,
+		Argon2Threads: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := hasher.Hash("testpwdstring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hasher.Check(hash, "testpwdstring"); err != nil {
+		t.Error(err)
+	}
+	if err := hasher.Check(hash, "thispasswordiswrong"); err != ErrPasswordMismatch {
+		t.Errorf("expected ErrPasswordMismatch, got %v", err)
+	}
+	if hasher.NeedsRehash(hash) {
+		t.Error("fresh hash should not need rehash")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	oldHasher, err := NewHasher(HashConfig{Algorithm: AlgorithmBcrypt, BcryptCost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := oldHasher.Hash("testpwdstring")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newHasher, err := NewHasher(DefaultHashConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !newHasher.NeedsRehash(hash) {
+		t.Error("bcrypt cost 4 hash should need rehash at default cost")
+	}
+	// old hashes must keep working until they are rehashed
+	if err := newHasher.Check(hash, "testpwdstring"); err != nil {
+		t.Error(err)
+	}
+
+	argonHasher, err := NewHasher(HashConfig{Algorithm: AlgorithmArgon2id, Argon2Memory: 8 * 1024, Argon2Time: 1, Argon2Threads: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !argonHasher.NeedsRehash(hash) {
+		t.Error("bcrypt hash should need rehash when argon2id is configured")
+	}
+	if err := argonHasher.Check(hash, "testpwdstring"); err != nil {
+		t.Error(err)
+	}
 }
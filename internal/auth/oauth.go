@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// MakePKCEVerifier returns a random RFC 7636 code_verifier, used when
+// Chirpy is itself the client of an external provider.
+func MakePKCEVerifier() (string, error) {
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(seed), nil
+}
+
+// PKCEChallenge is the S256 code_challenge of verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE checks an RFC 7636 code_verifier against the S256 code_challenge
+// sent with the authorization request. The plain method is not supported.
+func VerifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
+
+// ValidateRedirectURI accepts absolute https URIs, plus http on loopback for
+// native apps and local development. Fragments are not allowed by RFC 6749.
+func ValidateRedirectURI(raw string) error {
+	if strings.ContainsAny(raw, " \t\r\n") {
+		return errors.New("redirect URI must not contain whitespace")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return errors.New("redirect URI must be an absolute URL")
+	}
+	if u.Fragment != "" || strings.Contains(raw, "#") {
+		return errors.New("redirect URI must not contain a fragment")
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" || host == "127.0.0.1" || host == "::1" {
+			return nil
+		}
+	}
+	return errors.New("redirect URI must use https")
+}
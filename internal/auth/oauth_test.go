@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if !VerifyPKCE(verifier, challenge) {
+		t.Error("valid verifier rejected")
+	}
+	if VerifyPKCE(verifier+"x", challenge) {
+		t.Error("wrong verifier accepted")
+	}
+	if VerifyPKCE("short", challenge) {
+		t.Error("short verifier accepted")
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	cases := map[string]bool{
+		"https://app.example.com/callback": true,
+		"http://localhost:3000/callback":   true,
+		"http://127.0.0.1/cb":              true,
+		"http://app.example.com/callback":  false,
+		"https://app.example.com/cb#frag":  false,
+		"https://app.example.com/a b":      false,
+		"/relative/callback":               false,
+		"javascript:alert(1)":              false,
+	}
+	for uri, valid := range cases {
+		if err := ValidateRedirectURI(uri); (err == nil) != valid {
+			t.Errorf("%q: expected valid=%v, got %v", uri, valid, err)
+		}
+	}
+}
+
+func TestClientJWT(t *testing.T) {
+	userID := uuid.New()
+	token, err := MakeClientJWT(userID, 3, "client-1", []string{ScopeChirpsRead}, "secret", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ValidateJWT(token, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != userID || claims.TokenVersion != 3 || claims.ClientID != "client-1" || claims.Scope != ScopeChirpsRead {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+}
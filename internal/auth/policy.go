@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// bcrypt silently ignores everything past 72 bytes, so longer passwords
+// would give a false sense of security.
+const MaxPasswordBytes = 72
+
+// PolicyError is returned when a password is rejected. Code is stable and
+// meant for API clients, Message is human readable.
+type PolicyError struct {
+	Code    string
+	Message string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Message
+}
+
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// Breached is optional, nil skips the breached password check
+	Breached *BreachedPasswords
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength: 8,
+	MaxLength: MaxPasswordBytes,
+}
+
+// Validate checks password against the policy. Any rejection is a *PolicyError.
+func (p PasswordPolicy) Validate(password, email string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return &PolicyError{
+			Code:    "password_too_short",
+			Message: fmt.Sprintf("password must be at least %d characters", p.MinLength),
+		}
+	}
+	if len(password) > p.MaxLength {
+		return &PolicyError{
+			Code:    "password_too_long",
+			Message: fmt.Sprintf("password must be at most %d bytes", p.MaxLength),
+		}
+	}
+
+	normalized := strings.ToLower(strings.TrimSpace(password))
+	email = strings.ToLower(strings.TrimSpace(email))
+	localPart, _, _ := strings.Cut(email, "@")
+	if email != "" && (normalized == email || normalized == localPart) {
+		return &PolicyError{
+			Code:    "password_matches_email",
+			Message: "password must not be your email address",
+		}
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			//fail open, an unreadable breach list should not block signups
+			log.Printf("error checking breached passwords: %v", err)
+		}
+		if breached {
+			return &PolicyError{
+				Code:    "password_breached",
+				Message: "password has appeared in a data breach, choose a different one",
+			}
+		}
+	}
+	return nil
+}
+
+// BreachedPasswords checks passwords against an offline copy of the Pwned
+// Passwords list using k-anonymity ranges: Dir holds one file per 5 character
+// SHA-1 prefix named PREFIX.txt, each line "SUFFIX:COUNT", the same format
+// the range API returns.
+type BreachedPasswords struct {
+	Dir string
+}
+
+func (b *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(b.Dir, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineSuffix, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(lineSuffix), suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
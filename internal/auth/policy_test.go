@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	// sha1("password") = 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "5BAA6.txt"), []byte("003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := DefaultPasswordPolicy
+	policy.Breached = &BreachedPasswords{Dir: dir}
+
+	cases := []struct {
+		password string
+		code     string
+	}{
+		{"", "password_too_short"},
+		{"short", "password_too_short"},
+		{strings.Repeat("a", 73), "password_too_long"},
+		{"Walt@Example.com", "password_matches_email"},
+		{"walt@example.com", "password_matches_email"},
+		{"password", "password_breached"},
+		{"correct horse battery staple", ""},
+	}
+	for _, c := range cases {
+		err := policy.Validate(c.password, "walt@example.com")
+		if c.code == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error %v", c.password, err)
+			}
+			continue
+		}
+		var policyErr *PolicyError
+		if !errors.As(err, &policyErr) || policyErr.Code != c.code {
+			t.Errorf("%q: expected %s, got %v", c.password, c.code, err)
+		}
+	}
+}
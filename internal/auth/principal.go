@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MethodSession             = "session"
+	MethodPersonalAccessToken = "pat"
+	MethodOAuth               = "oauth"
+
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Principal is the authenticated caller of a request, put into the request
+// context by the authentication middleware.
+type Principal struct {
+	UserID uuid.UUID
+	Roles  []string
+	Scopes []string
+	// Method is how the caller authenticated, one of the Method constants
+	Method string
+	// ClientID is the OAuth client acting for the user, if Method is MethodOAuth
+	ClientID string
+	// PendingDeletion is set for sessions of accounts scheduled for deletion
+	PendingDeletion bool
+	// TokenVersion is the user's token version the caller authenticated
+	// with. Connections that outlive the request compare it with the current
+	// one to notice a revocation.
+	TokenVersion int32
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// RolesFor expands the role stored on a user, admins can do anything a user can.
+func RolesFor(role string) []string {
+	if role == RoleAdmin {
+		return []string{RoleUser, RoleAdmin}
+	}
+	return []string{RoleUser}
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scopes limit what a personal access token may do. Interactive sessions
+// (access tokens from /api/login) carry every scope.
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+var AllScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+const personalAccessTokenPrefix = "chirpy_pat_"
+
+// MakePersonalAccessToken returns a random token with a recognizable prefix,
+// so GetBearerToken callers can tell it apart from a JWT.
+func MakePersonalAccessToken() (string, error) {
+	tokenSeed := make([]byte, 32)
+	_, err := rand.Read(tokenSeed)
+	if err != nil {
+		return "", err
+	}
+	return personalAccessTokenPrefix + hex.EncodeToString(tokenSeed), nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalAccessTokenPrefix)
+}
+
+// ParseScopes validates requested scopes and returns them de-duplicated in
+// canonical order.
+func ParseScopes(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range requested {
+		if !slices.Contains(AllScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	scopes := []string{}
+	for _, scope := range AllScopes {
+		if slices.Contains(requested, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// JoinScopes and SplitScopes convert to and from the space separated form
+// stored in the database.
+func JoinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+func SplitScopes(scopes string) []string {
+	return strings.Fields(scopes)
+}
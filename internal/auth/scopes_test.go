@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseScopes(t *testing.T) {
+	cases := []struct {
+		requested []string
+		want      []string
+		wantErr   bool
+	}{
+		{[]string{ScopeChirpsRead}, []string{ScopeChirpsRead}, false},
+		{[]string{ScopeProfileWrite, ScopeChirpsRead, ScopeChirpsRead}, []string{ScopeChirpsRead, ScopeProfileWrite}, false},
+		{[]string{ScopeChirpsWrite, ScopeChirpsRead, ScopeProfileWrite}, AllScopes, false},
+		{nil, nil, true},
+		{[]string{}, nil, true},
+		{[]string{ScopeChirpsRead, "admin"}, nil, true},
+		{[]string{"Chirps:Read"}, nil, true},
+	}
+	for _, c := range cases {
+		got, err := ParseScopes(c.requested)
+		if (err != nil) != c.wantErr || !slices.Equal(got, c.want) {
+			t.Errorf("ParseScopes(%q) = %q, %v, want %q", c.requested, got, err, c.want)
+		}
+	}
+}
+
+func TestJoinSplitScopes(t *testing.T) {
+	joined := JoinScopes(AllScopes)
+	if joined != "chirps:read chirps:write profile:write" {
+		t.Errorf("JoinScopes() = %q", joined)
+	}
+	if got := SplitScopes(joined); !slices.Equal(got, AllScopes) {
+		t.Errorf("SplitScopes(%q) = %q", joined, got)
+	}
+	if got := SplitScopes(""); len(got) != 0 {
+		t.Errorf("SplitScopes(\"\") = %q, want none", got)
+	}
+}
+
+func TestPersonalAccessTokenPrefix(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsPersonalAccessToken(token) {
+		t.Errorf("IsPersonalAccessToken(%q) = false", token)
+	}
+	//access tokens are JWTs and must not be looked up as personal access tokens
+	jwt, err := MakeJWT(uuid.New(), 0, "secret", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsPersonalAccessToken(jwt) {
+		t.Errorf("IsPersonalAccessToken(%q) = true for a JWT", jwt)
+	}
+}
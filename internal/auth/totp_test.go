@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B, SHA1 seed "12345678901234567890", truncated to 6 digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, c := range cases {
+		code, err := TOTPCode(secret, time.Unix(c.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != c.code {
+			t.Errorf("at %d expected %s, got %s", c.unix, c.code, code)
+		}
+	}
+
+	now := time.Unix(1111111109, 0)
+	step, ok := ValidateTOTP(secret, "081804", now, 0)
+	if !ok {
+		t.Fatal("valid code rejected")
+	}
+	if _, ok := ValidateTOTP(secret, "081804", now, step); ok {
+		t.Error("replayed code accepted")
+	}
+	if _, ok := ValidateTOTP(secret, "000000", now, 0); ok {
+		t.Error("wrong code accepted")
+	}
+}
+
+func TestMFATokenIsNotAccessToken(t *testing.T) {
+	tokenSecret := "dfahjkghfhjgashaghfjkhgajfgl"
+	mfaToken, err := MakeMFAToken(uuid.New(), 0, tokenSecret, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(mfaToken, tokenSecret); err == nil {
+		t.Error("mfa token accepted as access token")
+	}
+	if _, err := ValidateMFAToken(mfaToken, tokenSecret); err != nil {
+		t.Error(err)
+	}
+}
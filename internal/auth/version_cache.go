@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VersionCache keeps recently seen user token versions in memory so that
+// validating an access token does not cost a database round-trip per request.
+// Entries expire after ttl, which bounds how long another replica can keep
+// accepting a revoked token.
+type VersionCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[uuid.UUID]versionEntry
+	lookup  func(context.Context, uuid.UUID) (int32, error)
+}
+
+type versionEntry struct {
+	version  int32
+	loadedAt time.Time
+}
+
+func NewVersionCache(ttl time.Duration, lookup func(context.Context, uuid.UUID) (int32, error)) *VersionCache {
+	return &VersionCache{
+		ttl:     ttl,
+		entries: make(map[uuid.UUID]versionEntry),
+		lookup:  lookup,
+	}
+}
+
+// Get returns the current token version for userID, loading it from the
+// lookup function when the cached entry is missing or stale.
+func (c *VersionCache) Get(ctx context.Context, userID uuid.UUID) (int32, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[userID]
+	c.mu.RUnlock()
+	if ok && time.Since(entry.loadedAt) < c.ttl {
+		return entry.version, nil
+	}
+
+	version, err := c.lookup(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	c.Set(userID, version)
+	return version, nil
+}
+
+// Set records a freshly changed token version, e.g. after revoking sessions.
+func (c *VersionCache) Set(userID uuid.UUID, version int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[userID] = versionEntry{version: version, loadedAt: time.Now()}
+}
+
+func (c *VersionCache) Invalidate(userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, userID)
+}
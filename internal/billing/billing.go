@@ -0,0 +1,46 @@
+// Package billing abstracts payment providers. A Provider authenticates and
+// decodes its webhooks into provider-neutral Events and starts checkouts, so
+// the subscription logic does not depend on any one provider's format.
+package billing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnauthorized = errors.New("webhook is not authentic")
+	ErrInvalidEvent = errors.New("webhook payload is malformed")
+	// ErrUnknownUser means the event names a user ID that cannot exist
+	ErrUnknownUser         = errors.New("webhook names an invalid user")
+	ErrCheckoutUnavailable = errors.New("checkout is not configured")
+)
+
+// Event is a billing event. Type is one of the subscription.Event* values,
+// providers pass other event types through unchanged.
+type Event struct {
+	// ID is unique per event and stays the same when a delivery is retried,
+	// empty when the provider did not send one
+	ID     string
+	Type   string
+	UserID uuid.UUID
+	// Plan and PeriodEnd are zero when the provider did not send them
+	Plan      string
+	PeriodEnd time.Time
+}
+
+type Provider interface {
+	// Name identifies the provider in stored events and in its webhook URL
+	Name() string
+	// VerifyWebhook authenticates a delivery. The body is the raw request body.
+	VerifyWebhook(header http.Header, body []byte) error
+	// ParseEvent decodes an authenticated body.
+	ParseEvent(body []byte) (Event, error)
+	// StartCheckout returns the URL to send userID to for paying for plan.
+	// The provider redirects to returnURL afterwards.
+	StartCheckout(ctx context.Context, userID uuid.UUID, plan, returnURL string) (string, error)
+}
@@ -0,0 +1,109 @@
+package billing
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/signature"
+	"github.com/google/uuid"
+)
+
+const PolkaSignatureHeader = "Polka-Signature"
+
+// Polka authenticates webhooks with a signature when WebhookSecrets is set,
+// otherwise with the legacy "Authorization: ApiKey" header.
+type Polka struct {
+	APIKey string
+	// WebhookSecrets are the current and, during rotation, the previous secret
+	WebhookSecrets []string
+	Tolerance      time.Duration
+	// CheckoutURL is Polka's hosted payment page, empty disables checkout
+	CheckoutURL string
+}
+
+// PolkaPayload is the JSON body of a Polka webhook.
+type PolkaPayload struct {
+	ID    string    `json:"id,omitempty"`
+	Event string    `json:"event"`
+	Data  PolkaData `json:"data"`
+}
+
+type PolkaData struct {
+	UserID           string     `json:"user_id"`
+	Plan             string     `json:"plan,omitempty"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end,omitempty"`
+}
+
+func (p *Polka) Name() string {
+	return "polka"
+}
+
+func (p *Polka) VerifyWebhook(header http.Header, body []byte) error {
+	if len(p.WebhookSecrets) > 0 {
+		err := signature.Verify(header.Get(PolkaSignatureHeader), body, p.WebhookSecrets, p.Tolerance, time.Now())
+		if err != nil {
+			return errors.Join(ErrUnauthorized, err)
+		}
+		return nil
+	}
+
+	key, err := auth.GetAPIKey(header)
+	if err != nil || p.APIKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(p.APIKey)) != 1 {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+func (p *Polka) ParseEvent(body []byte) (Event, error) {
+	payload := PolkaPayload{}
+	err := json.Unmarshal(body, &payload)
+	if err != nil || payload.Event == "" {
+		return Event{}, ErrInvalidEvent
+	}
+
+	event := Event{
+		ID:   payload.ID,
+		Type: payload.Event,
+		Plan: payload.Data.Plan,
+	}
+	if payload.Data.CurrentPeriodEnd != nil {
+		event.PeriodEnd = *payload.Data.CurrentPeriodEnd
+	}
+	event.UserID, err = uuid.Parse(payload.Data.UserID)
+	if err != nil {
+		return event, ErrUnknownUser
+	}
+	return event, nil
+}
+
+func (p *Polka) StartCheckout(ctx context.Context, userID uuid.UUID, plan, returnURL string) (string, error) {
+	if p.CheckoutURL == "" {
+		return "", ErrCheckoutUnavailable
+	}
+	u, err := url.Parse(p.CheckoutURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("user_id", userID.String())
+	q.Set("plan", plan)
+	q.Set("return_url", returnURL)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// SignRequest authenticates an outgoing webhook the way Polka does. It is
+// used by the local simulator.
+func (p *Polka) SignRequest(r *http.Request, body []byte) {
+	if len(p.WebhookSecrets) > 0 {
+		r.Header.Set(PolkaSignatureHeader, signature.Header(p.WebhookSecrets[:1], time.Now(), body))
+		return
+	}
+	r.Header.Set("Authorization", "ApiKey "+p.APIKey)
+}
@@ -0,0 +1,83 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPolkaSignedRoundTrip(t *testing.T) {
+	sender := &Polka{WebhookSecrets: []string{"new"}}
+	receiver := &Polka{WebhookSecrets: []string{"new", "old"}, Tolerance: time.Minute}
+	body := []byte(`{"event":"user.upgraded","data":{"user_id":"` + uuid.NewString() + `"}}`)
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/polka/webhooks", nil)
+	sender.SignRequest(req, body)
+	if err := receiver.VerifyWebhook(req.Header, body); err != nil {
+		t.Fatalf("VerifyWebhook() = %v", err)
+	}
+	if err := receiver.VerifyWebhook(req.Header, append(body, ' ')); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("tampered body: VerifyWebhook() = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestPolkaAPIKey(t *testing.T) {
+	p := &Polka{APIKey: "secret"}
+	header := http.Header{}
+	header.Set("Authorization", "ApiKey secret")
+	if err := p.VerifyWebhook(header, nil); err != nil {
+		t.Errorf("VerifyWebhook() = %v", err)
+	}
+	header.Set("Authorization", "ApiKey wrong")
+	if err := p.VerifyWebhook(header, nil); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("wrong key: VerifyWebhook() = %v, want ErrUnauthorized", err)
+	}
+	if err := (&Polka{}).VerifyWebhook(http.Header{"Authorization": {"ApiKey "}}, nil); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("unconfigured key must reject, got %v", err)
+	}
+}
+
+func TestPolkaParseEvent(t *testing.T) {
+	p := &Polka{}
+	userID := uuid.New()
+
+	event, err := p.ParseEvent([]byte(`{"id":"evt_1","event":"subscription.renewed","data":{"user_id":"` + userID.String() + `","plan":"red","current_period_end":"2025-02-01T00:00:00Z"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != "evt_1" || event.UserID != userID || event.Plan != "red" || !event.PeriodEnd.Equal(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	//without an id the receiver decides whether a delivery is a retry
+	event, err = p.ParseEvent([]byte(`{"event":"user.upgraded","data":{"user_id":"` + userID.String() + `"}}`))
+	if err != nil || event.ID != "" {
+		t.Errorf("ParseEvent() = %+v, %v, want no id", event, err)
+	}
+
+	if _, err := p.ParseEvent([]byte(`{"event":"user.upgraded","data":{"user_id":"nope"}}`)); err != ErrUnknownUser {
+		t.Errorf("ParseEvent() error = %v, want ErrUnknownUser", err)
+	}
+	if _, err := p.ParseEvent([]byte(`not json`)); err != ErrInvalidEvent {
+		t.Errorf("ParseEvent() error = %v, want ErrInvalidEvent", err)
+	}
+}
+
+func TestPolkaStartCheckout(t *testing.T) {
+	userID := uuid.New()
+	url, err := (&Polka{CheckoutURL: "https://pay.polka.example/checkout"}).StartCheckout(context.Background(), userID, "red", "https://chirpy.example/done")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(url, "https://pay.polka.example/checkout?") || !strings.Contains(url, "user_id="+userID.String()) {
+		t.Errorf("unexpected checkout url %q", url)
+	}
+	if _, err := (&Polka{}).StartCheckout(context.Background(), userID, "red", ""); err != ErrCheckoutUnavailable {
+		t.Errorf("StartCheckout() error = %v, want ErrCheckoutUnavailable", err)
+	}
+}
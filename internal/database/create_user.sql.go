@@ -21,7 +21,7 @@ VALUES (
     $4,
     $5
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, token_version, email_verified, pending_email, totp_secret, totp_enabled, totp_last_step, role, locked_at, deletion_scheduled_at
 `
 
 type CreateUserParams struct {
@@ -48,6 +48,15 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.TokenVersion,
+		&i.EmailVerified,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.LockedAt,
+		&i.DeletionScheduledAt,
 	)
 	return i, err
 }
@@ -7,15 +7,18 @@ package database
 
 import (
 	"context"
+	"time"
 )
 
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-ORDER BY created_at
+SELECT id, created_at, updated_at, body, user_id, publish_at FROM chirps
+WHERE publish_at <= $1
+AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.deletion_scheduled_at IS NOT NULL)
+ORDER BY publish_at
 `
 
-func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirps)
+func (q *Queries) GetAllChirps(ctx context.Context, publishAt time.Time) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getAllChirps, publishAt)
 	if err != nil {
 		return nil, err
 	}
@@ -29,6 +32,7 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.PublishAt,
 		); err != nil {
 			return nil, err
 		}
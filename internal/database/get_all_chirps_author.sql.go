@@ -12,7 +12,7 @@ import (
 )
 
 const getAllChirpsByAuthor = `-- name: GetAllChirpsByAuthor :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, publish_at FROM chirps
 WHERE user_id = $1
 ORDER BY created_at
 `
@@ -32,6 +32,7 @@ func (q *Queries) GetAllChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.PublishAt,
 		); err != nil {
 			return nil, err
 		}
@@ -12,8 +12,9 @@ import (
 )
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, publish_at FROM chirps
 WHERE id = $1
+AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.deletion_scheduled_at IS NOT NULL)
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -25,6 +26,7 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.PublishAt,
 	)
 	return i, err
 }
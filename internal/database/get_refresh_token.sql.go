@@ -14,20 +14,32 @@ import (
 )
 
 const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-SELECT expires_at, user_id, revoked_at
+SELECT refresh_tokens.expires_at, refresh_tokens.user_id, refresh_tokens.revoked_at, refresh_tokens.client_id, refresh_tokens.scopes,
+    users.deletion_scheduled_at
 FROM refresh_tokens
+JOIN users ON users.id = refresh_tokens.user_id
 WHERE token = $1
 `
 
 type GetUserFromRefreshTokenRow struct {
-	ExpiresAt time.Time
-	UserID    uuid.UUID
-	RevokedAt sql.NullTime
+	ExpiresAt           time.Time
+	UserID              uuid.UUID
+	RevokedAt           sql.NullTime
+	ClientID            sql.NullString
+	Scopes              sql.NullString
+	DeletionScheduledAt sql.NullTime
 }
 
 func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (GetUserFromRefreshTokenRow, error) {
 	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
 	var i GetUserFromRefreshTokenRow
-	err := row.Scan(&i.ExpiresAt, &i.UserID, &i.RevokedAt)
+	err := row.Scan(
+		&i.ExpiresAt,
+		&i.UserID,
+		&i.RevokedAt,
+		&i.ClientID,
+		&i.Scopes,
+		&i.DeletionScheduledAt,
+	)
 	return i, err
 }
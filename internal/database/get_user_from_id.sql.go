@@ -7,7 +7,6 @@ package database
 
 import (
 	"context"
-	"database/sql"
 
 	"github.com/google/uuid"
 )
@@ -21,7 +20,7 @@ WHERE id = $1
 type GetUserFromIDRow struct {
 	ID          uuid.UUID
 	Email       string
-	IsChirpyRed sql.NullBool
+	IsChirpyRed bool
 }
 
 func (q *Queries) GetUserFromID(ctx context.Context, id uuid.UUID) (GetUserFromIDRow, error) {
@@ -10,7 +10,7 @@ import (
 )
 
 const getUserPassword = `-- name: GetUserPassword :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, token_version, email_verified, pending_email, totp_secret, totp_enabled, totp_last_step, role, locked_at, deletion_scheduled_at
 FROM users
 WHERE email = $1
 `
@@ -25,6 +25,15 @@ func (q *Queries) GetUserPassword(ctx context.Context, email string) (User, erro
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.TokenVersion,
+		&i.EmailVerified,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.LockedAt,
+		&i.DeletionScheduledAt,
 	)
 	return i, err
 }
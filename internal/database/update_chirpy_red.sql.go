@@ -1,23 +0,0 @@
-// Code generated by sqlc. DO NOT EDIT.
-// versions:
-//   sqlc v1.29.0
-// source: update_chirpy_red.sql
-
-package database
-
-import (
-	"context"
-
-	"github.com/google/uuid"
-)
-
-const updateChirpyRed = `-- name: UpdateChirpyRed :exec
-UPDATE users
-SET is_chirpy_red = true
-WHERE id = $1
-`
-
-func (q *Queries) UpdateChirpyRed(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, updateChirpyRed, id)
-	return err
-}
@@ -0,0 +1,100 @@
+// Package entitlements decides which paid features a user has. Handlers ask
+// Has instead of looking at is_chirpy_red, so features can move between
+// plans through configuration alone.
+package entitlements
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/subscription"
+	"github.com/google/uuid"
+)
+
+const (
+	// FeatureLongChirps raises the chirp length limit
+	FeatureLongChirps = "long_chirps"
+	// FeatureEditChirps allows editing a chirp shortly after it is published
+	FeatureEditChirps = "edit_chirps"
+	// FeatureScheduledChirps allows posting a chirp with a future publish_at
+	FeatureScheduledChirps = "scheduled_chirps"
+)
+
+var knownFeatures = []string{FeatureLongChirps, FeatureEditChirps, FeatureScheduledChirps}
+
+// Plans maps a subscription plan to the features it grants.
+type Plans map[string][]string
+
+var DefaultPlans = Plans{
+	subscription.PlanRed: {FeatureLongChirps, FeatureEditChirps, FeatureScheduledChirps},
+}
+
+// ParsePlans reads a mapping such as "red=long_chirps,edit_chirps;pro=long_chirps".
+func ParsePlans(s string) (Plans, error) {
+	plans := Plans{}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		plan, list, found := strings.Cut(entry, "=")
+		plan = strings.TrimSpace(plan)
+		if !found || plan == "" {
+			return nil, fmt.Errorf("invalid plan entry %q, expected plan=feature,feature", entry)
+		}
+		features := []string{}
+		for _, feature := range strings.Split(list, ",") {
+			feature = strings.TrimSpace(feature)
+			if feature == "" {
+				continue
+			}
+			if !slices.Contains(knownFeatures, feature) {
+				return nil, fmt.Errorf("unknown feature %q for plan %s", feature, plan)
+			}
+			features = append(features, feature)
+		}
+		plans[plan] = features
+	}
+	return plans, nil
+}
+
+// Checker resolves a user's features from their subscription.
+type Checker struct {
+	plans  Plans
+	lookup func(context.Context, uuid.UUID) (database.Subscription, error)
+}
+
+func NewChecker(plans Plans, lookup func(context.Context, uuid.UUID) (database.Subscription, error)) *Checker {
+	return &Checker{plans: plans, lookup: lookup}
+}
+
+// Features returns the features of userID's plan, or none when the user has
+// no subscription or it has lapsed. The subscription period is checked here
+// so access ends on time even before the subscription is marked expired.
+func (c *Checker) Features(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	row, err := c.lookup(ctx, userID)
+	if err == sql.ErrNoRows {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := subscription.Subscription{Plan: row.Plan, Status: row.Status, CurrentPeriodEnd: row.CurrentPeriodEnd}
+	if !s.Entitled(time.Now()) {
+		return []string{}, nil
+	}
+	return slices.Clone(c.plans[row.Plan]), nil
+}
+
+func (c *Checker) Has(ctx context.Context, userID uuid.UUID, feature string) (bool, error) {
+	features, err := c.Features(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(features, feature), nil
+}
@@ -0,0 +1,63 @@
+package entitlements
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestParsePlans(t *testing.T) {
+	plans, err := ParsePlans("red=long_chirps, edit_chirps; pro=long_chirps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plans["red"]) != 2 || len(plans["pro"]) != 1 {
+		t.Errorf("unexpected plans %v", plans)
+	}
+
+	for _, bad := range []string{"red", "=long_chirps", "red=flying"} {
+		if _, err := ParsePlans(bad); err == nil {
+			t.Errorf("ParsePlans(%q) should fail", bad)
+		}
+	}
+}
+
+func TestHas(t *testing.T) {
+	subs := map[uuid.UUID]database.Subscription{}
+	lookup := func(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+		s, ok := subs[userID]
+		if !ok {
+			return database.Subscription{}, sql.ErrNoRows
+		}
+		return s, nil
+	}
+	checker := NewChecker(DefaultPlans, lookup)
+
+	active, lapsed, cancelled, free := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	subs[active] = database.Subscription{Plan: "red", Status: "active", CurrentPeriodEnd: time.Now().Add(time.Hour)}
+	subs[lapsed] = database.Subscription{Plan: "red", Status: "active", CurrentPeriodEnd: time.Now().Add(-time.Hour)}
+	subs[cancelled] = database.Subscription{Plan: "red", Status: "cancelled", CurrentPeriodEnd: time.Now().Add(time.Hour)}
+
+	tests := []struct {
+		userID uuid.UUID
+		want   bool
+	}{
+		{active, true},
+		{lapsed, false},
+		{cancelled, true},
+		{free, false},
+	}
+	for _, tt := range tests {
+		got, err := checker.Has(context.Background(), tt.userID, FeatureLongChirps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Has(%v) = %v, want %v", subs[tt.userID], got, tt.want)
+		}
+	}
+}
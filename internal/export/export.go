@@ -0,0 +1,201 @@
+// Package export writes the archive a user downloads to get a copy of their
+// data (GDPR article 20). Every list is included as JSON and as CSV.
+package export
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Data struct {
+	GeneratedAt          time.Time             `json:"generated_at"`
+	Profile              Profile               `json:"profile"`
+	Chirps               []Chirp               `json:"chirps"`
+	Sessions             []Session             `json:"sessions"`
+	PersonalAccessTokens []PersonalAccessToken `json:"personal_access_tokens"`
+	Identities           []Identity            `json:"identities"`
+	LoginAttempts        []LoginAttempt        `json:"login_attempts"`
+}
+
+type Profile struct {
+	ID                  uuid.UUID  `json:"id"`
+	Email               string     `json:"email"`
+	PendingEmail        string     `json:"pending_email,omitempty"`
+	EmailVerified       bool       `json:"email_verified"`
+	IsChirpyRed         bool       `json:"is_chirpy_red"`
+	TOTPEnabled         bool       `json:"totp_enabled"`
+	Role                string     `json:"role"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+type Chirp struct {
+	ID        uuid.UUID `json:"id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Session is a refresh token without its secret value.
+type Session struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	ClientID  string     `json:"oauth_client_id,omitempty"`
+}
+
+type PersonalAccessToken struct {
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type Identity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LoginAttempt struct {
+	IPAddress string    `json:"ip_address"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WriteArchive writes d as a zip archive to w.
+func WriteArchive(w io.Writer, d Data) error {
+	zw := zip.NewWriter(w)
+
+	err := writeJSON(zw, "profile.json", d.Profile, d.GeneratedAt)
+	if err != nil {
+		return err
+	}
+	err = writeJSON(zw, "export.json", d, d.GeneratedAt)
+	if err != nil {
+		return err
+	}
+
+	tables := []struct {
+		name   string
+		header []string
+		rows   [][]string
+		data   any
+	}{
+		{"chirps", []string{"id", "body", "created_at", "updated_at"}, chirpRows(d.Chirps), d.Chirps},
+		{"sessions", []string{"created_at", "expires_at", "revoked_at", "oauth_client_id"}, sessionRows(d.Sessions), d.Sessions},
+		{"personal_access_tokens", []string{"name", "scopes", "created_at", "expires_at", "last_used_at", "revoked_at"}, tokenRows(d.PersonalAccessTokens), d.PersonalAccessTokens},
+		{"identities", []string{"issuer", "subject", "email", "created_at"}, identityRows(d.Identities), d.Identities},
+		{"login_attempts", []string{"ip_address", "success", "reason", "created_at"}, loginAttemptRows(d.LoginAttempts), d.LoginAttempts},
+	}
+	for _, t := range tables {
+		err = writeJSON(zw, t.name+".json", t.data, d.GeneratedAt)
+		if err != nil {
+			return err
+		}
+		err = writeCSV(zw, t.name+".csv", t.header, t.rows, d.GeneratedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func create(zw *zip.Writer, name string, modified time.Time) (io.Writer, error) {
+	return zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+}
+
+func writeJSON(zw *zip.Writer, name string, v any, modified time.Time) error {
+	f, err := create(zw, name, modified)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeCSV(zw *zip.Writer, name string, header []string, rows [][]string, modified time.Time) error {
+	f, err := create(zw, name, modified)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	err = cw.Write(header)
+	if err != nil {
+		return err
+	}
+	err = cw.WriteAll(rows)
+	if err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return formatTime(*t)
+}
+
+func chirpRows(chirps []Chirp) [][]string {
+	rows := [][]string{}
+	for _, c := range chirps {
+		rows = append(rows, []string{c.ID.String(), c.Body, formatTime(c.CreatedAt), formatTime(c.UpdatedAt)})
+	}
+	return rows
+}
+
+func sessionRows(sessions []Session) [][]string {
+	rows := [][]string{}
+	for _, s := range sessions {
+		rows = append(rows, []string{formatTime(s.CreatedAt), formatTime(s.ExpiresAt), formatOptionalTime(s.RevokedAt), s.ClientID})
+	}
+	return rows
+}
+
+func tokenRows(tokens []PersonalAccessToken) [][]string {
+	rows := [][]string{}
+	for _, t := range tokens {
+		rows = append(rows, []string{t.Name, strings.Join(t.Scopes, " "), formatTime(t.CreatedAt),
+			formatOptionalTime(t.ExpiresAt), formatOptionalTime(t.LastUsedAt), formatOptionalTime(t.RevokedAt)})
+	}
+	return rows
+}
+
+func identityRows(identities []Identity) [][]string {
+	rows := [][]string{}
+	for _, i := range identities {
+		rows = append(rows, []string{i.Issuer, i.Subject, i.Email, formatTime(i.CreatedAt)})
+	}
+	return rows
+}
+
+func loginAttemptRows(attempts []LoginAttempt) [][]string {
+	rows := [][]string{}
+	for _, a := range attempts {
+		rows = append(rows, []string{a.IPAddress, strconv.FormatBool(a.Success), a.Reason, formatTime(a.CreatedAt)})
+	}
+	return rows
+}
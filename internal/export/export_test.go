@@ -0,0 +1,59 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestWriteArchive(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	data := Data{
+		GeneratedAt: now,
+		Profile:     Profile{ID: uuid.New(), Email: "user@example.com", CreatedAt: now},
+		Chirps: []Chirp{
+			{ID: uuid.New(), Body: "hello, \"world\"", CreatedAt: now, UpdatedAt: now},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, data); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	for _, name := range []string{"profile.json", "export.json", "chirps.json", "chirps.csv", "sessions.csv", "login_attempts.json"} {
+		if files[name] == nil {
+			t.Errorf("archive is missing %s", name)
+		}
+	}
+
+	f, _ := files["chirps.csv"].Open()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1][1] != "hello, \"world\"" || records[1][2] != "2025-01-02T03:04:05Z" {
+		t.Errorf("unexpected chirps.csv %q", records)
+	}
+
+	f, _ = files["profile.json"].Open()
+	profile := Profile{}
+	if err := json.NewDecoder(f).Decode(&profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.Email != "user@example.com" {
+		t.Errorf("unexpected profile %+v", profile)
+	}
+}
@@ -0,0 +1,329 @@
+// Package jobs is a durable background job queue. Jobs are rows in Postgres,
+// claimed with FOR UPDATE SKIP LOCKED so any number of server replicas can
+// work the same queue. A failed job is retried with exponential backoff and
+// moves to the dead state once it runs out of attempts, where an admin can
+// requeue it.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Job states.
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+const (
+	DefaultMaxAttempts = 5
+	defaultTimeout     = 5 * time.Minute
+)
+
+type Job struct {
+	ID          uuid.UUID
+	Kind        string
+	Payload     json.RawMessage
+	Attempts    int32
+	MaxAttempts int32
+	RunAt       time.Time
+}
+
+// LastAttempt reports whether a failure of the current run makes the job dead.
+func (j Job) LastAttempt() bool {
+	return j.Attempts >= j.MaxAttempts
+}
+
+type Options struct {
+	// RunAt delays the job, the zero time runs it as soon as possible
+	RunAt time.Time
+	// MaxAttempts defaults to DefaultMaxAttempts
+	MaxAttempts int32
+	// UniqueKey makes enqueuing a no-op while another job with the same key
+	// is pending or running
+	UniqueKey string
+}
+
+// ErrLeaseLost means a job ran past its lock and was claimed again, its
+// outcome is left to the worker that holds it now.
+var ErrLeaseLost = errors.New("job was claimed again by another worker")
+
+// Store persists jobs. Claim marks the returned jobs running until
+// lockedUntil and counts an attempt. A running job whose lock has expired,
+// because its worker crashed, is claimed again, or moved to dead if that was
+// its last attempt. Complete, Retry and Kill
+// only change the job while it is still the claimed attempt, otherwise they
+// return ErrLeaseLost.
+type Store interface {
+	Enqueue(ctx context.Context, kind string, payload any, opts Options) (bool, error)
+	Claim(ctx context.Context, kind string, now, lockedUntil time.Time, limit int32) ([]Job, error)
+	Complete(ctx context.Context, job Job, at time.Time) error
+	Retry(ctx context.Context, job Job, reason string, runAt time.Time) error
+	Kill(ctx context.Context, job Job, reason string, at time.Time) error
+}
+
+type permanentError struct {
+	err error
+}
+
+func (p permanentError) Error() string { return p.err.Error() }
+func (p permanentError) Unwrap() error { return p.err }
+
+// Permanent marks an error that retrying cannot fix, the job goes straight
+// to dead.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+type KindOptions struct {
+	// Concurrency limits how many jobs of the kind run at once in this
+	// process, zero leaves only the Worker's limit
+	Concurrency int
+	// Timeout bounds one run and is how long the job stays locked, a job
+	// still running after it may be picked up by another worker
+	Timeout time.Duration
+}
+
+type kind struct {
+	opts    KindOptions
+	handle  func(ctx context.Context, job Job) error
+	every   time.Duration
+	running int
+}
+
+func (k *kind) timeout() time.Duration {
+	if k.opts.Timeout > 0 {
+		return k.opts.Timeout
+	}
+	return defaultTimeout
+}
+
+// Worker runs the registered kinds. Concurrency limits how many jobs run at
+// once in this process.
+type Worker struct {
+	Store        Store
+	Concurrency  int
+	PollInterval time.Duration
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+
+	mu      sync.Mutex
+	kinds   map[string]*kind
+	names   []string
+	running int
+	wg      sync.WaitGroup
+}
+
+// Register adds a handler for a kind. The payload is decoded into T, a
+// payload that does not decode makes the job dead.
+func Register[T any](w *Worker, name string, opts KindOptions, fn func(ctx context.Context, job Job, payload T) error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.kinds == nil {
+		w.kinds = map[string]*kind{}
+	}
+	if _, exists := w.kinds[name]; !exists {
+		w.names = append(w.names, name)
+		slices.Sort(w.names)
+	}
+	w.kinds[name] = &kind{
+		opts: opts,
+		handle: func(ctx context.Context, job Job) error {
+			var payload T
+			if err := json.Unmarshal(job.Payload, &payload); err != nil {
+				return Permanent(fmt.Errorf("decoding payload: %w", err))
+			}
+			return fn(ctx, job, payload)
+		},
+	}
+}
+
+// Schedule makes a registered kind recurring: a job runs every interval
+// after the previous run finished. Replicas share the schedule, only one job
+// of the kind is queued at a time.
+func (w *Worker) Schedule(name string, every time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	k, ok := w.kinds[name]
+	if !ok {
+		panic("jobs: Schedule of unregistered kind " + name)
+	}
+	k.every = every
+}
+
+func scheduleKey(name string) string {
+	return "schedule:" + name
+}
+
+// EnsureScheduled queues the next run of every recurring kind that has none
+// queued, for example after its last run went dead.
+func (w *Worker) EnsureScheduled(ctx context.Context, now time.Time) error {
+	w.mu.Lock()
+	due := map[string]time.Duration{}
+	for name, k := range w.kinds {
+		if k.every > 0 {
+			due[name] = k.every
+		}
+	}
+	w.mu.Unlock()
+
+	var err error
+	for name := range due {
+		_, errEnqueue := w.Store.Enqueue(ctx, name, struct{}{}, Options{RunAt: now, UniqueKey: scheduleKey(name)})
+		err = errors.Join(err, errEnqueue)
+	}
+	return err
+}
+
+// capacity returns how many more jobs of k may start now.
+func (w *Worker) capacity(k *kind) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	free := w.Concurrency - w.running
+	if k.opts.Concurrency > 0 {
+		free = min(free, k.opts.Concurrency-k.running)
+	}
+	return max(free, 0)
+}
+
+// RunOnce claims due jobs of every kind with free capacity and starts them.
+// It returns how many jobs it started, Wait blocks until they are done.
+func (w *Worker) RunOnce(ctx context.Context, now time.Time) (int, error) {
+	w.mu.Lock()
+	names := slices.Clone(w.names)
+	kinds := map[string]*kind{}
+	for _, name := range names {
+		kinds[name] = w.kinds[name]
+	}
+	w.mu.Unlock()
+
+	started := 0
+	var err error
+	for _, name := range names {
+		k := kinds[name]
+		limit := w.capacity(k)
+		if limit == 0 {
+			continue
+		}
+		claimed, errClaim := w.Store.Claim(ctx, name, now, now.Add(k.timeout()), int32(limit))
+		if errClaim != nil {
+			err = errors.Join(err, errClaim)
+			continue
+		}
+		for _, job := range claimed {
+			w.start(k, job)
+			started++
+		}
+	}
+	return started, err
+}
+
+func (w *Worker) start(k *kind, job Job) {
+	w.mu.Lock()
+	w.running++
+	k.running++
+	w.mu.Unlock()
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer func() {
+			w.mu.Lock()
+			w.running--
+			k.running--
+			w.mu.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), k.timeout())
+		err := run(ctx, k, job)
+		cancel()
+
+		//the run may have used up its timeout, recording the outcome gets its own
+		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		w.finish(ctx, k, job, err)
+	}()
+}
+
+func run(ctx context.Context, k *kind, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return k.handle(ctx, job)
+}
+
+func (w *Worker) retryDelay(attempts int32) time.Duration {
+	d := w.BaseDelay
+	for i := int32(1); i < attempts && d < w.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, w.MaxDelay)
+}
+
+func (w *Worker) finish(ctx context.Context, k *kind, job Job, err error) {
+	now := time.Now()
+	var errStore error
+	switch {
+	case err == nil:
+		errStore = w.Store.Complete(ctx, job, now)
+		if errStore == nil && k.every > 0 {
+			_, errStore = w.Store.Enqueue(ctx, job.Kind, struct{}{}, Options{RunAt: now.Add(k.every), UniqueKey: scheduleKey(job.Kind)})
+		}
+	case errors.As(err, new(permanentError)) || job.LastAttempt():
+		log.Printf("Job %s %v is dead after %d attempts: %v", job.Kind, job.ID, job.Attempts, err)
+		errStore = w.Store.Kill(ctx, job, err.Error(), now)
+	default:
+		log.Printf("Job %s %v failed, attempt %d of %d: %v", job.Kind, job.ID, job.Attempts, job.MaxAttempts, err)
+		errStore = w.Store.Retry(ctx, job, err.Error(), now.Add(w.retryDelay(job.Attempts)))
+	}
+	if errors.Is(errStore, ErrLeaseLost) {
+		log.Printf("Job %s %v ran past its lock, its outcome is discarded: %v", job.Kind, job.ID, errStore)
+		return
+	}
+	if errStore != nil {
+		log.Printf("Error on database: %v", errStore)
+	}
+}
+
+// Wait blocks until every started job has finished.
+func (w *Worker) Wait() {
+	w.wg.Wait()
+}
+
+// Run works the queue until ctx is done, then waits for running jobs.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+	lastEnsure := time.Time{}
+	for {
+		if time.Since(lastEnsure) > time.Minute {
+			lastEnsure = time.Now()
+			if err := w.EnsureScheduled(ctx, lastEnsure); err != nil {
+				log.Printf("Error scheduling recurring jobs: %v", err)
+			}
+		}
+		_, err := w.RunOnce(ctx, time.Now())
+		if err != nil {
+			log.Printf("Error claiming jobs: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			w.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type memJob struct {
+	Job
+	status    string
+	runAt     time.Time
+	lastError string
+	uniqueKey string
+}
+
+// memStore is a single process Store for tests.
+type memStore struct {
+	mu   sync.Mutex
+	jobs []*memJob
+}
+
+func (m *memStore) Enqueue(ctx context.Context, kind string, payload any, opts Options) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return false, err
+	}
+	if opts.UniqueKey != "" {
+		for _, j := range m.jobs {
+			if j.uniqueKey == opts.UniqueKey && (j.status == StatusPending || j.status == StatusRunning) {
+				return false, nil
+			}
+		}
+	}
+	if opts.MaxAttempts == 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	m.jobs = append(m.jobs, &memJob{
+		Job:       Job{ID: uuid.New(), Kind: kind, Payload: raw, MaxAttempts: opts.MaxAttempts},
+		status:    StatusPending,
+		runAt:     opts.RunAt,
+		uniqueKey: opts.UniqueKey,
+	})
+	return true, nil
+}
+
+func (m *memStore) Claim(ctx context.Context, kind string, now, lockedUntil time.Time, limit int32) ([]Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	claimed := []Job{}
+	for _, j := range m.jobs {
+		if len(claimed) == int(limit) {
+			break
+		}
+		if j.Kind == kind && j.status == StatusPending && !j.runAt.After(now) {
+			j.status = StatusRunning
+			j.Attempts++
+			claimed = append(claimed, j.Job)
+		}
+	}
+	return claimed, nil
+}
+
+func (m *memStore) find(id uuid.UUID) *memJob {
+	for _, j := range m.jobs {
+		if j.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+// leased returns the stored job if job is still its current attempt.
+func (m *memStore) leased(job Job) (*memJob, error) {
+	j := m.find(job.ID)
+	if j == nil || j.status != StatusRunning || j.Attempts != job.Attempts {
+		return nil, ErrLeaseLost
+	}
+	return j, nil
+}
+
+func (m *memStore) Complete(ctx context.Context, job Job, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, err := m.leased(job)
+	if err != nil {
+		return err
+	}
+	j.status = StatusSucceeded
+	return nil
+}
+
+func (m *memStore) Retry(ctx context.Context, job Job, reason string, runAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, err := m.leased(job)
+	if err != nil {
+		return err
+	}
+	j.status, j.lastError, j.runAt = StatusPending, reason, runAt
+	return nil
+}
+
+func (m *memStore) Kill(ctx context.Context, job Job, reason string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, err := m.leased(job)
+	if err != nil {
+		return err
+	}
+	j.status, j.lastError = StatusDead, reason
+	return nil
+}
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+func TestWorkerRetriesThenDies(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{}
+	w := &Worker{Store: store, Concurrency: 4, BaseDelay: time.Minute, MaxDelay: time.Hour}
+
+	var got []string
+	Register(w, "greet", KindOptions{}, func(ctx context.Context, job Job, p greeting) error {
+		got = append(got, p.Name)
+		return errors.New("smtp down")
+	})
+	store.Enqueue(ctx, "greet", greeting{Name: "walt"}, Options{MaxAttempts: 2})
+
+	now := time.Now()
+	if n, err := w.RunOnce(ctx, now); n != 1 || err != nil {
+		t.Fatalf("RunOnce() = %d, %v", n, err)
+	}
+	w.Wait()
+	job := store.jobs[0]
+	if job.status != StatusPending || job.lastError != "smtp down" {
+		t.Fatalf("after first failure: status %s, error %q", job.status, job.lastError)
+	}
+	if wait := job.runAt.Sub(now); wait < time.Minute || wait > time.Minute+time.Second {
+		t.Errorf("expected retry after BaseDelay, got %v", wait)
+	}
+
+	//not due yet
+	if n, _ := w.RunOnce(ctx, now); n != 0 {
+		t.Errorf("job ran before its retry time")
+	}
+	w.RunOnce(ctx, now.Add(2*time.Minute))
+	w.Wait()
+	if job.status != StatusDead {
+		t.Errorf("expected dead after max attempts, got %s", job.status)
+	}
+	if len(got) != 2 || got[0] != "walt" {
+		t.Errorf("handler calls = %v", got)
+	}
+}
+
+func TestWorkerPermanentAndBadPayload(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{}
+	w := &Worker{Store: store, Concurrency: 4, BaseDelay: time.Minute, MaxDelay: time.Hour}
+
+	Register(w, "greet", KindOptions{}, func(ctx context.Context, job Job, p greeting) error {
+		return Permanent(errors.New("no such user"))
+	})
+	store.Enqueue(ctx, "greet", greeting{Name: "walt"}, Options{})
+	store.Enqueue(ctx, "greet", "not an object", Options{})
+
+	w.RunOnce(ctx, time.Now())
+	w.Wait()
+	for _, job := range store.jobs {
+		if job.status != StatusDead || job.Attempts != 1 {
+			t.Errorf("expected dead after one attempt, got %s after %d (%s)", job.status, job.Attempts, job.lastError)
+		}
+	}
+}
+
+func TestWorkerConcurrencyLimits(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{}
+	w := &Worker{Store: store, Concurrency: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}
+
+	release := make(chan struct{})
+	Register(w, "export", KindOptions{Concurrency: 1}, func(ctx context.Context, job Job, p struct{}) error {
+		<-release
+		return nil
+	})
+	Register(w, "mail", KindOptions{}, func(ctx context.Context, job Job, p struct{}) error {
+		<-release
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		store.Enqueue(ctx, "export", struct{}{}, Options{})
+		store.Enqueue(ctx, "mail", struct{}{}, Options{})
+	}
+
+	//one export (kind limit) and two mails (worker limit)
+	n, _ := w.RunOnce(ctx, time.Now())
+	if n != 3 {
+		t.Errorf("expected 3 jobs started, got %d", n)
+	}
+	if n, _ := w.RunOnce(ctx, time.Now()); n != 0 {
+		t.Errorf("expected no capacity left, started %d", n)
+	}
+	close(release)
+	w.Wait()
+
+	n, _ = w.RunOnce(ctx, time.Now())
+	w.Wait()
+	if n != 2 {
+		t.Errorf("expected the remaining export and mail, started %d", n)
+	}
+}
+
+func TestWorkerSchedule(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{}
+	w := &Worker{Store: store, Concurrency: 1}
+
+	runs := 0
+	Register(w, "purge", KindOptions{}, func(ctx context.Context, job Job, p struct{}) error {
+		runs++
+		return nil
+	})
+	w.Schedule("purge", time.Hour)
+
+	now := time.Now()
+	w.EnsureScheduled(ctx, now)
+	w.EnsureScheduled(ctx, now)
+	if len(store.jobs) != 1 {
+		t.Fatalf("expected one queued run, got %d", len(store.jobs))
+	}
+
+	w.RunOnce(ctx, now)
+	w.Wait()
+	if runs != 1 || len(store.jobs) != 2 {
+		t.Fatalf("expected one run and the next queued, got %d runs and %d jobs", runs, len(store.jobs))
+	}
+	if next := store.jobs[1].runAt; next.Sub(now) < time.Hour {
+		t.Errorf("next run at %v, expected an hour later", next)
+	}
+}
+
+func TestWorkerLostLease(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{}
+	w := &Worker{Store: store, Concurrency: 1, BaseDelay: time.Minute, MaxDelay: time.Hour}
+
+	Register(w, "export", KindOptions{}, func(ctx context.Context, job Job, p struct{}) error {
+		//the lock expired and another worker claimed the job again
+		store.mu.Lock()
+		store.jobs[0].Attempts++
+		store.mu.Unlock()
+		return errors.New("slow export")
+	})
+	store.Enqueue(ctx, "export", struct{}{}, Options{})
+
+	w.RunOnce(ctx, time.Now())
+	w.Wait()
+	if job := store.jobs[0]; job.status != StatusRunning || job.lastError != "" {
+		t.Errorf("stale run changed the job to %s (%s), want it left to the new claim", job.status, job.lastError)
+	}
+}
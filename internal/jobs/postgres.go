@@ -0,0 +1,123 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Enqueue adds a job. Pass the Queries of a transaction to enqueue together
+// with the change that needs the work. It returns false if opts.UniqueKey is
+// already queued.
+func Enqueue(ctx context.Context, q *database.Queries, kind string, payload any, opts Options) (bool, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if opts.RunAt.IsZero() {
+		opts.RunAt = now
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	rows, err := q.CreateJob(ctx, database.CreateJobParams{
+		ID:          uuid.New(),
+		Kind:        kind,
+		Payload:     raw,
+		MaxAttempts: opts.MaxAttempts,
+		RunAt:       opts.RunAt,
+		UniqueKey:   sql.NullString{String: opts.UniqueKey, Valid: opts.UniqueKey != ""},
+		CreatedAt:   now,
+	})
+	return rows > 0, err
+}
+
+// PostgresStore keeps jobs in the jobs table.
+type PostgresStore struct {
+	Db *database.Queries
+}
+
+func (p *PostgresStore) Enqueue(ctx context.Context, kind string, payload any, opts Options) (bool, error) {
+	return Enqueue(ctx, p.Db, kind, payload, opts)
+}
+
+func (p *PostgresStore) Claim(ctx context.Context, kind string, now, lockedUntil time.Time, limit int32) ([]Job, error) {
+	//a job whose last attempt never finished, e.g. because it crashed the
+	//process, must not be claimed again forever
+	dead, err := p.Db.KillExpiredJobs(ctx, database.KillExpiredJobsParams{
+		Now:  now,
+		Kind: kind,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dead > 0 {
+		log.Printf("%d %s jobs are dead, their last attempt did not finish before its lock expired", dead, kind)
+	}
+
+	rows, err := p.Db.ClaimJobs(ctx, database.ClaimJobsParams{
+		LockedUntil: lockedUntil,
+		Now:         now,
+		Kind:        kind,
+		Limit:       limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	claimed := []Job{}
+	for _, row := range rows {
+		claimed = append(claimed, Job{
+			ID:          row.ID,
+			Kind:        row.Kind,
+			Payload:     row.Payload,
+			Attempts:    row.Attempts,
+			MaxAttempts: row.MaxAttempts,
+			RunAt:       row.RunAt,
+		})
+	}
+	return claimed, nil
+}
+
+func (p *PostgresStore) Complete(ctx context.Context, job Job, at time.Time) error {
+	rows, err := p.Db.CompleteJob(ctx, database.CompleteJobParams{
+		UpdatedAt: at,
+		ID:        job.ID,
+		Attempts:  job.Attempts,
+	})
+	return leaseHeld(rows, err)
+}
+
+func (p *PostgresStore) Retry(ctx context.Context, job Job, reason string, runAt time.Time) error {
+	rows, err := p.Db.RescheduleJob(ctx, database.RescheduleJobParams{
+		RunAt:     runAt,
+		LastError: sql.NullString{String: reason, Valid: true},
+		UpdatedAt: time.Now(),
+		ID:        job.ID,
+		Attempts:  job.Attempts,
+	})
+	return leaseHeld(rows, err)
+}
+
+func (p *PostgresStore) Kill(ctx context.Context, job Job, reason string, at time.Time) error {
+	rows, err := p.Db.KillJob(ctx, database.KillJobParams{
+		LastError: sql.NullString{String: reason, Valid: true},
+		UpdatedAt: at,
+		ID:        job.ID,
+		Attempts:  job.Attempts,
+	})
+	return leaseHeld(rows, err)
+}
+
+// leaseHeld turns an update that matched no running attempt into ErrLeaseLost.
+func leaseHeld(rows int64, err error) error {
+	if err == nil && rows == 0 {
+		return ErrLeaseLost
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package jobs
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestPostgresStoreLostLease(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := &PostgresStore{Db: database.New(db)}
+	job := Job{ID: uuid.New(), Kind: "export", Attempts: 2, MaxAttempts: 5}
+	now := time.Now()
+
+	//the updates only match the running attempt that was claimed
+	tests := []struct {
+		name string
+		args []driver.Value
+		call func() error
+	}{
+		{"complete", []driver.Value{now, job.ID, job.Attempts}, func() error {
+			return store.Complete(context.Background(), job, now)
+		}},
+		{"retry", []driver.Value{now, "failed", sqlmock.AnyArg(), job.ID, job.Attempts}, func() error {
+			return store.Retry(context.Background(), job, "failed", now)
+		}},
+		{"kill", []driver.Value{"failed", now, job.ID, job.Attempts}, func() error {
+			return store.Kill(context.Background(), job, "failed", now)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock.ExpectExec("UPDATE jobs").WithArgs(tt.args...).WillReturnResult(sqlmock.NewResult(0, 1))
+			if err := tt.call(); err != nil {
+				t.Errorf("lease held: %v", err)
+			}
+			mock.ExpectExec("UPDATE jobs").WithArgs(tt.args...).WillReturnResult(sqlmock.NewResult(0, 0))
+			if err := tt.call(); !errors.Is(err, ErrLeaseLost) {
+				t.Errorf("lease lost: %v, want ErrLeaseLost", err)
+			}
+		})
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostgresStoreClaimKillsExpiredLastAttempts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := &PostgresStore{Db: database.New(db)}
+	now := time.Now()
+
+	//expired jobs without attempts left go dead before the claim, which skips them
+	mock.ExpectExec(regexp.QuoteMeta("SET status = 'dead'")).WithArgs(now, "export").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("locked_until < $2 AND attempts < max_attempts")).
+		WithArgs(now.Add(time.Minute), now, "export", int32(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "payload", "status", "attempts", "max_attempts", "run_at",
+			"locked_until", "last_error", "unique_key", "created_at", "updated_at", "finished_at"}))
+
+	claimed, err := store.Claim(context.Background(), "export", now, now.Add(time.Minute), 10)
+	if err != nil || len(claimed) != 0 {
+		t.Errorf("Claim() = %v, %v", claimed, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,124 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Record is the failure history of one key, e.g. an account or an IP address.
+type Record struct {
+	Failures    int32
+	LastFailure time.Time
+}
+
+// Store persists failure records. Fail must increment atomically so that
+// replicas sharing a store see each other's failures.
+type Store interface {
+	Get(ctx context.Context, key string) (Record, error)
+	// Fail records a failure at now. Failures older than the window are
+	// forgotten and counting restarts at one.
+	Fail(ctx context.Context, key string, now time.Time, window time.Duration) (Record, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// Limiter applies exponential backoff once a key has used up its free
+// attempts: BaseDelay after the first extra failure, doubling up to MaxDelay,
+// which acts as a temporary lockout.
+type Limiter struct {
+	Store        Store
+	FreeAttempts int32
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Window       time.Duration
+}
+
+func (l *Limiter) delay(failures int32) time.Duration {
+	if failures < l.FreeAttempts {
+		return 0
+	}
+	d := l.BaseDelay
+	for i := l.FreeAttempts; i < failures && d < l.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, l.MaxDelay)
+}
+
+// RetryAfter returns how long key must wait before its next attempt, zero if
+// it may try now.
+func (l *Limiter) RetryAfter(ctx context.Context, key string, now time.Time) (time.Duration, error) {
+	rec, err := l.Store.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if rec.Failures == 0 || now.Sub(rec.LastFailure) > l.Window {
+		return 0, nil
+	}
+	wait := rec.LastFailure.Add(l.delay(rec.Failures)).Sub(now)
+	if wait < 0 {
+		return 0, nil
+	}
+	return wait, nil
+}
+
+// Fail records a failed attempt and returns the resulting wait time.
+func (l *Limiter) Fail(ctx context.Context, key string, now time.Time) (time.Duration, error) {
+	rec, err := l.Store.Fail(ctx, key, now, l.Window)
+	if err != nil {
+		return 0, err
+	}
+	return l.delay(rec.Failures), nil
+}
+
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.Store.Reset(ctx, key)
+}
+
+// MemoryStore keeps records in process memory. It is only suitable for a
+// single server instance, use PostgresStore when running replicas.
+type MemoryStore struct {
+	mu        sync.Mutex
+	records   map[string]Record
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+func (m *MemoryStore) Get(ctx context.Context, key string) (Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.records[key], nil
+}
+
+func (m *MemoryStore) Fail(ctx context.Context, key string, now time.Time, window time.Duration) (Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	//drop expired records now and then so the map doesn't grow forever
+	if now.Sub(m.lastSweep) > window {
+		for k, rec := range m.records {
+			if now.Sub(rec.LastFailure) > window {
+				delete(m.records, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	rec := m.records[key]
+	if now.Sub(rec.LastFailure) > window {
+		rec.Failures = 0
+	}
+	rec.Failures++
+	rec.LastFailure = now
+	m.records[key] = rec
+	return rec, nil
+}
+
+func (m *MemoryStore) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, key)
+	return nil
+}
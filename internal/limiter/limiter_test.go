@@ -0,0 +1,57 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterBackoff(t *testing.T) {
+	ctx := context.Background()
+	l := &Limiter{
+		Store:        NewMemoryStore(),
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     10 * time.Second,
+		Window:       time.Hour,
+	}
+	now := time.Now()
+
+	expected := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, want := range expected {
+		got, err := l.Fail(ctx, "account:walt@example.com", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("failure %d: expected delay %v, got %v", i+1, want, got)
+		}
+	}
+
+	wait, err := l.RetryAfter(ctx, "account:walt@example.com", now.Add(4*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait != 6*time.Second {
+		t.Errorf("expected 6s remaining lockout, got %v", wait)
+	}
+
+	wait, _ = l.RetryAfter(ctx, "ip:127.0.0.1", now)
+	if wait != 0 {
+		t.Errorf("unrelated key should not be limited, got %v", wait)
+	}
+
+	// failures outside the window are forgotten
+	later := now.Add(2 * time.Hour)
+	if wait, _ := l.RetryAfter(ctx, "account:walt@example.com", later); wait != 0 {
+		t.Errorf("expected no wait after window, got %v", wait)
+	}
+	if got, _ := l.Fail(ctx, "account:walt@example.com", later); got != 0 {
+		t.Errorf("expected counting to restart after window, got %v", got)
+	}
+
+	l.Reset(ctx, "account:walt@example.com")
+	if wait, _ := l.RetryAfter(ctx, "account:walt@example.com", later); wait != 0 {
+		t.Errorf("expected no wait after reset, got %v", wait)
+	}
+}
@@ -0,0 +1,41 @@
+package limiter
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/database"
+)
+
+// PostgresStore shares failure records between server replicas.
+type PostgresStore struct {
+	Db *database.Queries
+}
+
+func (p *PostgresStore) Get(ctx context.Context, key string) (Record, error) {
+	row, err := p.Db.GetLoginThrottle(ctx, key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Record{}, nil
+		}
+		return Record{}, err
+	}
+	return Record{Failures: row.Failures, LastFailure: row.LastFailureAt}, nil
+}
+
+func (p *PostgresStore) Fail(ctx context.Context, key string, now time.Time, window time.Duration) (Record, error) {
+	row, err := p.Db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Key:         key,
+		FailedAt:    now,
+		WindowStart: now.Add(-window),
+	})
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{Failures: row.Failures, LastFailure: row.LastFailureAt}, nil
+}
+
+func (p *PostgresStore) Reset(ctx context.Context, key string) error {
+	return p.Db.DeleteLoginThrottle(ctx, key)
+}
@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: dir, From: "chirpy@localhost"}
+	err := m.Send(context.Background(), Message{
+		To:      "walt@example.com\r\nBcc: victim@example.com",
+		Subject: "Reset your password",
+		Body:    "line one\nline two",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(entries))
+	}
+	data, err := os.ReadFile(dir + "/" + entries[0].Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(data)
+	if strings.Contains(msg, "\r\nBcc:") {
+		t.Error("header injection was not stripped")
+	}
+	if !strings.Contains(msg, "Subject: Reset your password\r\n") {
+		t.Error("missing subject header")
+	}
+	if !strings.Contains(msg, "line one\r\nline two") {
+		t.Error("body line endings not normalized")
+	}
+}
@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/models"
+)
+
+// Requirement declares what a route needs from the caller. The zero value
+// accepts any authenticated caller.
+type Requirement struct {
+	// Scopes must all be granted, interactive sessions have every scope
+	Scopes []string
+	Roles  []string
+	// SessionOnly rejects personal access tokens, e.g. for managing tokens
+	SessionOnly bool
+	// AllowPendingDeletion admits accounts scheduled for deletion, which can
+	// otherwise only view, restore and export the account
+	AllowPendingDeletion bool
+}
+
+var RequireSession = Requirement{SessionOnly: true}
+
+// RequireAdmin guards /admin routes. Personal access tokens never carry the
+// admin role, so admin actions always need an interactive login.
+var RequireAdmin = Requirement{Roles: []string{auth.RoleAdmin}, SessionOnly: true}
+
+// RequireAccountSession is RequireSession for the routes an account scheduled
+// for deletion can still use.
+var RequireAccountSession = Requirement{SessionOnly: true, AllowPendingDeletion: true}
+
+func RequireScopes(scopes ...string) Requirement {
+	return Requirement{Scopes: scopes}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(models.ErrorBody{Error: message, Code: code})
+	if err != nil {
+		log.Printf("Error marshalling JSON: %s", err)
+	}
+}
+
+// Require authenticates the request, checks it against req and runs next
+// with the principal in the request context. Handlers behind Require never
+// see unauthenticated or unauthorized requests.
+func (cfg *ApiConfig) Require(req Requirement, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := cfg.Authenticate(r)
+		if errors.Is(err, ErrCSRF) {
+			writeJSONError(w, http.StatusForbidden, "csrf_failed", "missing or invalid "+CSRFHeader+" header")
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized", "invalid token")
+			return
+		}
+
+		if principal.PendingDeletion && !req.AllowPendingDeletion {
+			writeJSONError(w, http.StatusForbidden, "account_pending_deletion", "account is scheduled for deletion, restore it first")
+			return
+		}
+		if req.SessionOnly && principal.Method != auth.MethodSession {
+			writeJSONError(w, http.StatusForbidden, "session_required", "this endpoint requires a login session")
+			return
+		}
+		for _, scope := range req.Scopes {
+			if !principal.HasScope(scope) {
+				writeJSONError(w, http.StatusForbidden, "insufficient_scope", "token lacks the "+scope+" scope")
+				return
+			}
+		}
+		//roles are only looked up for routes that need them, so a role change
+		//applies on the next request without revoking the user's sessions
+		if len(req.Roles) > 0 && principal.Method == auth.MethodSession {
+			role, err := cfg.Db.GetUserRole(r.Context(), principal.UserID)
+			if err != nil {
+				log.Printf("Error loading role for user %v: %v", principal.UserID, err)
+				writeJSONError(w, http.StatusInternalServerError, "", "database error reported")
+				return
+			}
+			principal.Roles = auth.RolesFor(role)
+		}
+		for _, role := range req.Roles {
+			if !principal.HasRole(role) {
+				writeJSONError(w, http.StatusForbidden, "forbidden", "insufficient permissions")
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// Authenticate resolves the bearer token of r: an access token from an
+// interactive login or an OAuth client, or a personal access token. Browsers
+// in cookie session mode send the access token as a cookie instead.
+func (cfg *ApiConfig) Authenticate(r *http.Request) (*auth.Principal, error) {
+	tokenString, fromCookie, err := SessionCookie(r, AccessCookie)
+	if err != nil {
+		return nil, err
+	}
+	if !fromCookie {
+		tokenString, err = auth.GetBearerToken(r.Header)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if auth.IsPersonalAccessToken(tokenString) {
+		return cfg.authenticatePersonalAccessToken(r, tokenString)
+	}
+
+	claims, err := auth.ValidateJWT(tokenString, cfg.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	//token versions are bumped on password change and session revocation
+	currentVersion, err := cfg.TokenVersions.Get(r.Context(), claims.UserID)
+	if err != nil {
+		log.Printf("Error loading token version for user %v: %v", claims.UserID, err)
+		return nil, err
+	}
+	if claims.TokenVersion != currentVersion {
+		return nil, errors.New("token has been revoked")
+	}
+
+	//third-party clients only get the scopes the user consented to
+	if claims.ClientID != "" {
+		//tokens of a deleted client stop working before they expire
+		_, err := cfg.Db.GetOAuthClient(r.Context(), claims.ClientID)
+		if err != nil {
+			if err != sql.ErrNoRows {
+				log.Printf("Error loading OAuth client %v: %v", claims.ClientID, err)
+			}
+			return nil, err
+		}
+		return &auth.Principal{
+			UserID:       claims.UserID,
+			Roles:        []string{auth.RoleUser},
+			Scopes:       auth.SplitScopes(claims.Scope),
+			Method:       auth.MethodOAuth,
+			ClientID:     claims.ClientID,
+			TokenVersion: claims.TokenVersion,
+		}, nil
+	}
+
+	return &auth.Principal{
+		UserID:          claims.UserID,
+		Roles:           []string{auth.RoleUser},
+		Scopes:          auth.AllScopes,
+		Method:          auth.MethodSession,
+		PendingDeletion: claims.PendingDeletion,
+		TokenVersion:    claims.TokenVersion,
+	}, nil
+}
+
+func (cfg *ApiConfig) authenticatePersonalAccessToken(r *http.Request, tokenString string) (*auth.Principal, error) {
+	pat, err := cfg.Db.GetPersonalAccessTokenByHash(r.Context(), auth.HashToken(tokenString))
+	if err != nil {
+		return nil, err
+	}
+	if pat.RevokedAt.Valid || (pat.ExpiresAt.Valid && time.Now().After(pat.ExpiresAt.Time)) {
+		return nil, errors.New("personal access token revoked or expired")
+	}
+
+	//last_used_at is informational, don't write on every request
+	if !pat.LastUsedAt.Valid || time.Since(pat.LastUsedAt.Time) > time.Minute {
+		err = cfg.Db.TouchPersonalAccessToken(r.Context(), database.TouchPersonalAccessTokenParams{
+			LastUsedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			ID:         pat.ID,
+		})
+		if err != nil {
+			log.Printf("Error updating personal access token last use: %v", err)
+		}
+	}
+
+	//revoking all sessions revokes the token too, long-lived connections
+	//notice it by the token version
+	version, err := cfg.TokenVersions.Get(r.Context(), pat.UserID)
+	if err != nil {
+		log.Printf("Error loading token version for user %v: %v", pat.UserID, err)
+		return nil, err
+	}
+
+	return &auth.Principal{
+		UserID:       pat.UserID,
+		Roles:        []string{auth.RoleUser},
+		Scopes:       auth.SplitScopes(pat.Scopes),
+		Method:       auth.MethodPersonalAccessToken,
+		TokenVersion: version,
+	}, nil
+}
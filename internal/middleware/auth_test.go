@@ -0,0 +1,286 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const testSecret = "test-secret"
+
+// newTestConfig returns a config whose database is a sqlmock and whose token
+// versions come from versions, 0 for users not in it.
+func newTestConfig(t *testing.T, versions map[uuid.UUID]int32) (*ApiConfig, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	lookup := func(ctx context.Context, userID uuid.UUID) (int32, error) {
+		return versions[userID], nil
+	}
+	return &ApiConfig{
+		Db:            database.New(db),
+		Token:         testSecret,
+		TokenVersions: auth.NewVersionCache(time.Minute, lookup),
+	}, mock
+}
+
+var patColumns = []string{"id", "user_id", "name", "token_hash", "scopes", "created_at", "expires_at", "last_used_at", "revoked_at"}
+
+func patRows(pat database.PersonalAccessToken) *sqlmock.Rows {
+	value := func(t sql.NullTime) any {
+		if !t.Valid {
+			return nil
+		}
+		return t.Time
+	}
+	return sqlmock.NewRows(patColumns).AddRow(pat.ID.String(), pat.UserID.String(), pat.Name, pat.TokenHash, pat.Scopes,
+		pat.CreatedAt, value(pat.ExpiresAt), value(pat.LastUsedAt), value(pat.RevokedAt))
+}
+
+func bearerRequest(method, token string) *http.Request {
+	r := httptest.NewRequest(method, "/api/chirps", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func TestAuthenticatePersonalAccessToken(t *testing.T) {
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	now := time.Now()
+	past := sql.NullTime{Time: now.Add(-time.Hour), Valid: true}
+	recent := sql.NullTime{Time: now.Add(-time.Second), Valid: true}
+
+	tests := []struct {
+		name    string
+		pat     database.PersonalAccessToken
+		lookup  error
+		touch   bool
+		wantErr bool
+	}{
+		{
+			name:  "active token is used for the first time",
+			pat:   database.PersonalAccessToken{Scopes: "chirps:read chirps:write"},
+			touch: true,
+		},
+		{
+			name: "recently used token is not touched again",
+			pat:  database.PersonalAccessToken{Scopes: "chirps:read chirps:write", LastUsedAt: recent},
+		},
+		{
+			name:    "revoked token",
+			pat:     database.PersonalAccessToken{Scopes: "chirps:read chirps:write", RevokedAt: past},
+			wantErr: true,
+		},
+		{
+			name:    "expired token",
+			pat:     database.PersonalAccessToken{Scopes: "chirps:read chirps:write", ExpiresAt: past},
+			wantErr: true,
+		},
+		{
+			//the query hides tokens of locked accounts and accounts pending deletion
+			name:    "unknown token or blocked owner",
+			lookup:  sql.ErrNoRows,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t, nil)
+			tt.pat.ID, tt.pat.UserID, tt.pat.TokenHash, tt.pat.CreatedAt = uuid.New(), userID, auth.HashToken(token), now
+			query := mock.ExpectQuery("FROM personal_access_tokens").WithArgs(auth.HashToken(token))
+			if tt.lookup != nil {
+				query.WillReturnError(tt.lookup)
+			} else {
+				query.WillReturnRows(patRows(tt.pat))
+			}
+			if tt.touch {
+				mock.ExpectExec("UPDATE personal_access_tokens").
+					WithArgs(sqlmock.AnyArg(), tt.pat.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			principal, err := cfg.Authenticate(bearerRequest(http.MethodGet, token))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Authenticate() = %+v, want an error", principal)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if principal.UserID != userID || principal.Method != auth.MethodPersonalAccessToken {
+				t.Errorf("principal = %+v", principal)
+			}
+			if !slices.Equal(principal.Scopes, []string{auth.ScopeChirpsRead, auth.ScopeChirpsWrite}) {
+				t.Errorf("scopes = %q", principal.Scopes)
+			}
+			if principal.HasRole(auth.RoleAdmin) {
+				t.Error("personal access token carries the admin role")
+			}
+		})
+	}
+}
+
+func TestRequire(t *testing.T) {
+	userID := uuid.New()
+	versions := map[uuid.UUID]int32{userID: 2}
+	session := func(version int32) string {
+		token, err := auth.MakeJWT(userID, version, testSecret, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	pendingDeletion, err := auth.MakePendingDeletionJWT(userID, 2, testSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := auth.MakeClientJWT(userID, 2, "client-1", []string{auth.ScopeChirpsRead}, testSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pat, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPAT := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("FROM personal_access_tokens").WillReturnRows(patRows(database.PersonalAccessToken{
+			ID: uuid.New(), UserID: userID, Scopes: auth.ScopeChirpsRead, LastUsedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		}))
+	}
+	expectClient := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("FROM oauth_clients").WithArgs("client-1").WillReturnRows(
+			sqlmock.NewRows([]string{"id", "owner_id", "name", "secret_hash", "redirect_uris", "scopes", "created_at"}).
+				AddRow("client-1", uuid.NewString(), "app", nil, "https://app.example.com/callback", auth.ScopeChirpsRead, time.Now()))
+	}
+	deletedClient := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("FROM oauth_clients").WithArgs("client-1").WillReturnError(sql.ErrNoRows)
+	}
+	expectRole := func(role string) func(sqlmock.Sqlmock) {
+		return func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery("SELECT role").WithArgs(userID).WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(role))
+		}
+	}
+	withCookies := func(r *http.Request, access, csrf string) *http.Request {
+		r.AddCookie(&http.Cookie{Name: AccessCookie, Value: access})
+		r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: "csrf-token"})
+		if csrf != "" {
+			r.Header.Set(CSRFHeader, csrf)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		req    Requirement
+		r      *http.Request
+		expect func(sqlmock.Sqlmock)
+		status int
+		code   string
+	}{
+		{"no token", Requirement{}, httptest.NewRequest(http.MethodGet, "/api/chirps", nil), nil, http.StatusUnauthorized, "unauthorized"},
+		{"malformed token", Requirement{}, bearerRequest(http.MethodGet, "not-a-jwt"), nil, http.StatusUnauthorized, "unauthorized"},
+		{"session", RequireScopes(auth.ScopeChirpsWrite), bearerRequest(http.MethodPost, session(2)), nil, http.StatusOK, ""},
+		{"token version bumped since issue", Requirement{}, bearerRequest(http.MethodGet, session(1)), nil, http.StatusUnauthorized, "unauthorized"},
+		{"session on a session-only route", RequireSession, bearerRequest(http.MethodGet, session(2)), nil, http.StatusOK, ""},
+
+		{"personal access token with the scope", RequireScopes(auth.ScopeChirpsRead), bearerRequest(http.MethodGet, pat), expectPAT, http.StatusOK, ""},
+		{"personal access token lacks the scope", RequireScopes(auth.ScopeChirpsWrite), bearerRequest(http.MethodPost, pat), expectPAT, http.StatusForbidden, "insufficient_scope"},
+		{"personal access token on a session-only route", RequireSession, bearerRequest(http.MethodGet, pat), expectPAT, http.StatusForbidden, "session_required"},
+		{"personal access token on an admin route", RequireAdmin, bearerRequest(http.MethodGet, pat), expectPAT, http.StatusForbidden, "session_required"},
+
+		{"OAuth token with the scope", RequireScopes(auth.ScopeChirpsRead), bearerRequest(http.MethodGet, client), expectClient, http.StatusOK, ""},
+		{"OAuth token lacks the scope", RequireScopes(auth.ScopeProfileWrite), bearerRequest(http.MethodPut, client), expectClient, http.StatusForbidden, "insufficient_scope"},
+		{"OAuth token on a session-only route", RequireSession, bearerRequest(http.MethodGet, client), expectClient, http.StatusForbidden, "session_required"},
+		{"OAuth token of a deleted client", RequireScopes(auth.ScopeChirpsRead), bearerRequest(http.MethodGet, client), deletedClient, http.StatusUnauthorized, "unauthorized"},
+
+		{"account pending deletion", RequireScopes(auth.ScopeChirpsWrite), bearerRequest(http.MethodPost, pendingDeletion), nil, http.StatusForbidden, "account_pending_deletion"},
+		{"account pending deletion on a session-only route", RequireSession, bearerRequest(http.MethodGet, pendingDeletion), nil, http.StatusForbidden, "account_pending_deletion"},
+		{"account pending deletion restores", RequireAccountSession, bearerRequest(http.MethodPost, pendingDeletion), nil, http.StatusOK, ""},
+		{"session on an account route", RequireAccountSession, bearerRequest(http.MethodPost, session(2)), nil, http.StatusOK, ""},
+
+		{"admin", RequireAdmin, bearerRequest(http.MethodGet, session(2)), expectRole(auth.RoleAdmin), http.StatusOK, ""},
+		{"user on an admin route", RequireAdmin, bearerRequest(http.MethodGet, session(2)), expectRole(auth.RoleUser), http.StatusForbidden, "forbidden"},
+
+		{"cookie session", Requirement{}, withCookies(httptest.NewRequest(http.MethodGet, "/api/chirps", nil), session(2), ""), nil, http.StatusOK, ""},
+		{"cookie session without CSRF header", Requirement{}, withCookies(httptest.NewRequest(http.MethodPost, "/api/chirps", nil), session(2), ""), nil, http.StatusForbidden, "csrf_failed"},
+		{"cookie session with wrong CSRF header", Requirement{}, withCookies(httptest.NewRequest(http.MethodPost, "/api/chirps", nil), session(2), "other"), nil, http.StatusForbidden, "csrf_failed"},
+		{"cookie session with CSRF header", Requirement{}, withCookies(httptest.NewRequest(http.MethodPost, "/api/chirps", nil), session(2), "csrf-token"), nil, http.StatusOK, ""},
+		{
+			//a revoked cookie must not shadow a valid bearer token, nor the other way round
+			name:   "header wins over cookie",
+			r:      withCookies(bearerRequest(http.MethodPost, session(2)), session(1), ""),
+			status: http.StatusOK,
+		},
+		{
+			name:   "revoked header is not rescued by a valid cookie",
+			r:      withCookies(bearerRequest(http.MethodGet, session(1)), session(2), ""),
+			status: http.StatusUnauthorized,
+			code:   "unauthorized",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t, versions)
+			if tt.expect != nil {
+				tt.expect(mock)
+			}
+			var got *auth.Principal
+			handler := cfg.Require(tt.req, func(w http.ResponseWriter, r *http.Request) {
+				got, _ = auth.PrincipalFrom(r.Context())
+			})
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, tt.r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.code != "" && !strings.Contains(w.Body.String(), `"code":"`+tt.code+`"`) {
+				t.Errorf("body = %s, want code %s", w.Body, tt.code)
+			}
+			if tt.status == http.StatusOK && (got == nil || got.UserID != userID) {
+				t.Errorf("handler saw principal %+v", got)
+			}
+		})
+	}
+}
+
+func TestRequireAdminLooksUpCurrentRole(t *testing.T) {
+	userID := uuid.New()
+	cfg, mock := newTestConfig(t, nil)
+	mock.ExpectQuery("SELECT role").WithArgs(userID).WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(auth.RoleAdmin))
+	token, _ := auth.MakeJWT(userID, 0, testSecret, time.Hour)
+
+	var got *auth.Principal
+	handler := cfg.Require(RequireAdmin, func(w http.ResponseWriter, r *http.Request) {
+		got, _ = auth.PrincipalFrom(r.Context())
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), bearerRequest(http.MethodGet, token))
+
+	if got == nil || !got.HasRole(auth.RoleAdmin) || !got.HasRole(auth.RoleUser) {
+		t.Errorf("principal = %+v, want the admin and user roles", got)
+	}
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Cookie session mode keeps tokens out of reach of the web app's JavaScript.
+// Only the CSRF cookie is readable by scripts, which echo it back in the
+// CSRF header on state-changing requests (double-submit).
+const (
+	AccessCookie  = "chirpy_access"
+	RefreshCookie = "chirpy_refresh"
+	CSRFCookie    = "chirpy_csrf"
+	CSRFHeader    = "X-CSRF-Token"
+	// OIDCStateCookie binds a single sign-on callback to the browser that
+	// started the login
+	OIDCStateCookie = "chirpy_oidc_state"
+)
+
+var ErrCSRF = errors.New("missing or invalid CSRF token")
+
+func (cfg *ApiConfig) setCookie(w http.ResponseWriter, name, value, path string, httpOnly bool, ttl time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: httpOnly,
+		Secure:   cfg.CookieSecure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// SetSessionCookies starts a cookie session with a fresh CSRF token.
+func (cfg *ApiConfig) SetSessionCookies(w http.ResponseWriter, accessToken string, accessTTL time.Duration, refreshToken string, refreshTTL time.Duration) error {
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		return err
+	}
+	cfg.SetAccessCookie(w, accessToken, accessTTL)
+	cfg.setCookie(w, RefreshCookie, refreshToken, "/api", true, refreshTTL)
+	//readable by scripts on purpose, it lives as long as the refresh token
+	cfg.setCookie(w, CSRFCookie, hex.EncodeToString(seed), "/", false, refreshTTL)
+	return nil
+}
+
+func (cfg *ApiConfig) SetAccessCookie(w http.ResponseWriter, accessToken string, ttl time.Duration) {
+	cfg.setCookie(w, AccessCookie, accessToken, "/api", true, ttl)
+}
+
+func (cfg *ApiConfig) ClearSessionCookies(w http.ResponseWriter) {
+	cfg.setCookie(w, AccessCookie, "", "/api", true, -time.Second)
+	cfg.setCookie(w, RefreshCookie, "", "/api", true, -time.Second)
+	cfg.setCookie(w, CSRFCookie, "", "/", false, -time.Second)
+}
+
+// SetOIDCStateCookie is SameSite=Lax, Strict cookies are not sent on the
+// provider's redirect back to the callback.
+func (cfg *ApiConfig) SetOIDCStateCookie(w http.ResponseWriter, state string, ttl time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     OIDCStateCookie,
+		Value:    state,
+		Path:     "/api/oidc",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (cfg *ApiConfig) ClearOIDCStateCookie(w http.ResponseWriter) {
+	cfg.SetOIDCStateCookie(w, "", -time.Second)
+}
+
+// CheckCSRF verifies the double-submit token for cookie authenticated
+// requests. Safe methods don't change state and are not checked.
+func CheckCSRF(r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	cookie, err := r.Cookie(CSRFCookie)
+	if err != nil || cookie.Value == "" {
+		return ErrCSRF
+	}
+	if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.Header.Get(CSRFHeader))) != 1 {
+		return ErrCSRF
+	}
+	return nil
+}
+
+// SessionCookie returns the named cookie of a cookie session, after checking
+// CSRF. ok is false when the request doesn't use cookies, e.g. because it
+// sends an Authorization header, which always takes precedence.
+func SessionCookie(r *http.Request, name string) (value string, ok bool, err error) {
+	if r.Header.Get("Authorization") != "" {
+		return "", false, nil
+	}
+	cookie, errCookie := r.Cookie(name)
+	if errCookie != nil || cookie.Value == "" {
+		return "", false, nil
+	}
+	if err := CheckCSRF(r); err != nil {
+		return "", true, err
+	}
+	return cookie.Value, true, nil
+}
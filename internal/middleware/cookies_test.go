@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckCSRF(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		cookie  string
+		header  string
+		wantErr bool
+	}{
+		{"safe method without token", http.MethodGet, "", "", false},
+		{"head without token", http.MethodHead, "", "", false},
+		{"matching token", http.MethodPost, "abc123", "abc123", false},
+		{"matching token on delete", http.MethodDelete, "abc123", "abc123", false},
+		{"missing header", http.MethodPost, "abc123", "", true},
+		{"missing cookie", http.MethodPut, "", "abc123", true},
+		{"both empty", http.MethodPost, "", "", true},
+		{"different token", http.MethodPost, "abc123", "abc124", true},
+		{"prefix of the token", http.MethodPost, "abc123", "abc", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/chirps", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set(CSRFHeader, tt.header)
+			}
+			err := CheckCSRF(r)
+			if tt.wantErr != errors.Is(err, ErrCSRF) {
+				t.Errorf("CheckCSRF() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	tests := []struct {
+		name      string
+		bearer    bool
+		cookie    bool
+		csrf      string
+		wantValue string
+		wantOK    bool
+		wantErr   bool
+	}{
+		{name: "no cookie", wantOK: false},
+		{name: "cookie with CSRF header", cookie: true, csrf: "csrf", wantValue: "access", wantOK: true},
+		{name: "cookie without CSRF header", cookie: true, wantOK: true, wantErr: true},
+		{name: "Authorization header wins", bearer: true, cookie: true, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+			if tt.bearer {
+				r.Header.Set("Authorization", "Bearer token")
+			}
+			if tt.cookie {
+				r.AddCookie(&http.Cookie{Name: AccessCookie, Value: "access"})
+				r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: "csrf"})
+			}
+			if tt.csrf != "" {
+				r.Header.Set(CSRFHeader, tt.csrf)
+			}
+			value, ok, err := SessionCookie(r, AccessCookie)
+			if value != tt.wantValue || ok != tt.wantOK || (err != nil) != tt.wantErr {
+				t.Errorf("SessionCookie() = %q, %v, %v", value, ok, err)
+			}
+		})
+	}
+}
+
+func TestSessionCookies(t *testing.T) {
+	cfg := &ApiConfig{CookieSecure: true}
+	w := httptest.NewRecorder()
+	if err := cfg.SetSessionCookies(w, "access", time.Hour, "refresh", 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	cookies := map[string]*http.Cookie{}
+	for _, c := range w.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+
+	for _, name := range []string{AccessCookie, RefreshCookie} {
+		c := cookies[name]
+		if c == nil || !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteStrictMode {
+			t.Errorf("%s = %+v, want HttpOnly, Secure and SameSite=Strict", name, c)
+		}
+	}
+	csrf := cookies[CSRFCookie]
+	if csrf == nil || csrf.HttpOnly || len(csrf.Value) != 64 {
+		t.Fatalf("%s = %+v, want a random token readable by scripts", CSRFCookie, csrf)
+	}
+	if cookies[AccessCookie].MaxAge != 3600 || csrf.MaxAge != cookies[RefreshCookie].MaxAge {
+		t.Errorf("cookie lifetimes: access %d, refresh %d, csrf %d", cookies[AccessCookie].MaxAge, cookies[RefreshCookie].MaxAge, csrf.MaxAge)
+	}
+
+	w = httptest.NewRecorder()
+	cfg.ClearSessionCookies(w)
+	for _, c := range w.Result().Cookies() {
+		if c.MaxAge >= 0 || c.Value != "" {
+			t.Errorf("%s not cleared: %+v", c.Name, c)
+		}
+	}
+	if n := len(w.Result().Cookies()); n != 3 {
+		t.Errorf("cleared %d cookies, want 3", n)
+	}
+}
@@ -2,19 +2,76 @@ package middleware
 
 import (
 	"bytes"
+	"database/sql"
 	"log"
 	"net/http"
+	"sync"
 	"sync/atomic"
 	"text/template"
+	"time"
 
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/billing"
 	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/entitlements"
+	"github.com/Walther-Knight/chirpy/internal/jobs"
+	"github.com/Walther-Knight/chirpy/internal/limiter"
+	"github.com/Walther-Knight/chirpy/internal/mailer"
+	"github.com/Walther-Knight/chirpy/internal/oidc"
+	"github.com/Walther-Knight/chirpy/internal/outbox"
+	"github.com/Walther-Knight/chirpy/internal/realtime"
+	"github.com/Walther-Knight/chirpy/internal/webhooks"
 )
 
 type ApiConfig struct {
 	FileserverHits atomic.Int32
 	Db             *database.Queries
 	Token          string
-	PolkaSecret    string
+	// Billing holds the payment providers by name, each receives webhooks at /api/{name}/webhooks
+	Billing map[string]billing.Provider
+	// CheckoutProvider names the provider new subscriptions are paid with
+	CheckoutProvider string
+	TokenVersions    *auth.VersionCache
+	Hasher           *auth.Hasher
+	PasswordPolicy   auth.PasswordPolicy
+	Mailer           mailer.Mailer
+	// BaseURL is used to build links sent by email
+	BaseURL          string
+	PasswordResetTTL time.Duration
+	EmailVerifyTTL   time.Duration
+	// RequireVerifiedEmail blocks posting chirps until the email is verified
+	RequireVerifiedEmail bool
+	// login brute-force protection, per account and per client IP
+	AccountLimiter *limiter.Limiter
+	IPLimiter      *limiter.Limiter
+	// TrustProxyHeaders uses X-Forwarded-For as the client IP, only enable behind a proxy
+	TrustProxyHeaders bool
+	// Platform "dev" enables destructive admin endpoints such as Reset
+	Platform string
+	// CookieSecure sets the Secure attribute on session cookies, only disable for plain http development
+	CookieSecure bool
+	// OIDC is the external identity provider for single sign-on, nil when disabled
+	OIDC *oidc.Provider
+	// DeletionGracePeriod is how long a deleted account can still be restored
+	DeletionGracePeriod time.Duration
+	// SubscriptionPeriod is the billing period assumed when a Polka event has no current_period_end
+	SubscriptionPeriod time.Duration
+	// Entitlements answers which paid features a user has
+	Entitlements *entitlements.Checker
+	// Webhooks sends outgoing webhook deliveries and schedules their retries
+	Webhooks *webhooks.Sender
+	// Pool is the connection pool behind Db, used to begin transactions
+	Pool *sql.DB
+	// Outbox publishes the events recorded with outbox.Record
+	Outbox *outbox.Relay
+	// Bus receives every published event in this process
+	Bus *outbox.Bus
+	// Jobs works the background job queue
+	Jobs *jobs.Worker
+	// Listener feeds Bus with the events relayed by every server
+	Listener *outbox.Listener
+	// RealtimeConns limits open WebSocket connections per user
+	RealtimeConns *realtime.ConnLimiter
 }
 
 func (cfg *ApiConfig) MiddlewareMetricsInc(next http.Handler) http.Handler {
@@ -29,7 +86,11 @@ type hitVariables struct {
 	HitTotal int32
 }
 
-var metricsTemplate = template.Must(template.ParseFiles("./static/templates/admin/metrics.html"))
+// metricsTemplate is parsed on first use, the path is relative to the
+// working directory of the server rather than of tests importing this package
+var metricsTemplate = sync.OnceValues(func() (*template.Template, error) {
+	return template.ParseFiles("./static/templates/admin/metrics.html")
+})
 
 func (cfg *ApiConfig) HitTotal(w http.ResponseWriter, r *http.Request) {
 	hits := hitVariables{
@@ -38,8 +99,14 @@ func (cfg *ApiConfig) HitTotal(w http.ResponseWriter, r *http.Request) {
 	log.Printf("HitTotal endpoint hit. Total Hits: %d\n", hits)
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
+	tmpl, err := metricsTemplate()
+	if err != nil {
+		log.Printf("Error with template: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 	var buf bytes.Buffer
-	err := metricsTemplate.Execute(&buf, hits)
+	err = tmpl.Execute(&buf, hits)
 	if err != nil {
 		log.Printf("Error with template: %v\n", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -51,6 +118,11 @@ func (cfg *ApiConfig) HitTotal(w http.ResponseWriter, r *http.Request) {
 }
 
 func (cfg *ApiConfig) Reset(w http.ResponseWriter, r *http.Request) {
+	//server.Start only registers Reset in dev, this guards against miswiring
+	if cfg.Platform != "dev" {
+		writeJSONError(w, http.StatusForbidden, "forbidden", "reset is only available in dev mode")
+		return
+	}
 	cfg.FileserverHits.Store(0)
 	log.Println("HitTotal Reset endpoint hit.")
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,23 +13,198 @@ type User struct {
 	UpdatedAt      time.Time `json:"updated_at"`
 	Email          string    `json:"email"`
 	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	EmailVerified  bool      `json:"email_verified"`
+	TOTPEnabled    bool      `json:"totp_enabled"`
+	PendingEmail   string    `json:"pending_email,omitempty"`
+	Role           string    `json:"role"`
 	HashedPassword string    `json:"password"`
 	Token          string    `json:"token"`
 	RefreshToken   string    `json:"refresh_token"`
+
+	// DeletionScheduledAt is set while the account is in its deletion grace period
+	DeletionScheduledAt *time.Time    `json:"deletion_scheduled_at,omitempty"`
+	Subscription        *Subscription `json:"subscription,omitempty"`
+	// Entitlements lists the paid features of the user's plan
+	Entitlements []string `json:"entitlements,omitempty"`
+}
+
+// Subscription is the user's Chirpy Red subscription. is_chirpy_red stays
+// true until current_period_end even when it was cancelled.
+type Subscription struct {
+	Plan             string     `json:"plan"`
+	Status           string     `json:"status"`
+	CurrentPeriodEnd time.Time  `json:"current_period_end"`
+	CancelledAt      *time.Time `json:"cancelled_at"`
+}
+
+// MFAChallenge is returned by login instead of a User when the account has
+// two-factor authentication enabled.
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
 }
 
 type ErrorBody struct {
 	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
 }
 
 type Chirp struct {
-	ID        string    `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    string    `json:"user_id"`
+	ID          string    `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	PublishedAt time.Time `json:"published_at"`
+	Body        string    `json:"body"`
+	UserID      string    `json:"user_id"`
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// DataExport is the status of an account export built in the background.
+type DataExport struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
 }
 
 type Token struct {
 	Token string `json:"token"`
 }
+
+type OAuthClient struct {
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// OAuthConsent describes an authorization request for the consent screen.
+type OAuthConsent struct {
+	ClientID    string   `json:"client_id"`
+	ClientName  string   `json:"client_name"`
+	RedirectURI string   `json:"redirect_uri"`
+	Scopes      []string `json:"scopes"`
+}
+
+type OAuthRedirect struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// OAuthToken is the RFC 6749 token response.
+type OAuthToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// OAuthError is the RFC 6749 error response of the token endpoint.
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// WebhookEvent is an incoming webhook delivery as stored for deduplication.
+type WebhookEvent struct {
+	ID          uuid.UUID       `json:"id"`
+	Provider    string          `json:"provider"`
+	EventID     string          `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	Attempts    int32           `json:"attempts"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	ProcessedAt *time.Time      `json:"processed_at"`
+}
+
+type Checkout struct {
+	CheckoutURL string `json:"checkout_url"`
+}
+
+// WebhookSubscription is an outgoing webhook registered by a user. Secret is
+// only returned when the subscription is created.
+type WebhookSubscription struct {
+	ID         uuid.UUID  `json:"id"`
+	URL        string     `json:"url"`
+	Events     []string   `json:"events"`
+	AllUsers   bool       `json:"all_users"`
+	Secret     string     `json:"secret,omitempty"`
+	Disabled   bool       `json:"disabled"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// WebhookDelivery is one entry of a subscription's delivery log.
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	ResponseStatus *int32          `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// Job is a background job as shown to admins.
+type Job struct {
+	ID          uuid.UUID       `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int32           `json:"attempts"`
+	MaxAttempts int32           `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+// RealtimeCommand is a message from a WebSocket client.
+type RealtimeCommand struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	// ID is echoed in the reply
+	ID string `json:"id,omitempty"`
+}
+
+// RealtimeMessage is a message to a WebSocket client: a reply to a command,
+// or an event on a subscribed channel.
+type RealtimeMessage struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Channel string          `json:"channel,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	EventID *uuid.UUID      `json:"event_id,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Code    string          `json:"code,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
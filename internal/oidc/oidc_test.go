@@ -0,0 +1,135 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// stubIssuer is a minimal OpenID provider: discovery, JWKS and a token
+// endpoint that issues an ID token for the last authorization request.
+type stubIssuer struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newStubIssuer(t *testing.T) *stubIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 s.URL,
+			"authorization_endpoint": s.URL + "/authorize",
+			"token_endpoint":         s.URL + "/token",
+			"jwks_uri":               s.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if r.PostFormValue("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != s.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":            s.URL,
+			"sub":            "user-1",
+			"aud":            "chirpy",
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"email":          "sso@example.com",
+			"email_verified": true,
+			"nonce":          s.nonce,
+		}
+		for k, v := range s.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubIssuer) login(t *testing.T, p *Provider, verifier string) (*Claims, error) {
+	ctx := context.Background()
+	sum := sha256.Sum256([]byte(verifier))
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce-1", base64.RawURLEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	s.challenge = u.Query().Get("code_challenge")
+	s.nonce = u.Query().Get("nonce")
+
+	tokens, err := p.Exchange(ctx, "good-code", verifier)
+	if err != nil {
+		return nil, err
+	}
+	return p.VerifyIDToken(ctx, tokens.IDToken, "nonce-1")
+}
+
+func TestProvider(t *testing.T) {
+	issuer := newStubIssuer(t)
+	p := NewProvider(Config{Issuer: issuer.URL, ClientID: "chirpy", RedirectURL: "http://localhost/cb"})
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	claims, err := issuer.login(t, p, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "sso@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	cases := map[string]jwt.MapClaims{
+		"wrong audience": {"aud": "someone-else"},
+		"wrong issuer":   {"iss": "https://evil.example.com"},
+		"expired":        {"exp": time.Now().Add(-time.Hour).Unix()},
+		"wrong nonce":    {"nonce": "replayed"},
+	}
+	for name, override := range cases {
+		issuer.claims = override
+		if _, err := issuer.login(t, p, verifier); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestExchangeRequiresVerifier(t *testing.T) {
+	issuer := newStubIssuer(t)
+	p := NewProvider(Config{Issuer: issuer.URL, ClientID: "chirpy", RedirectURL: "http://localhost/cb"})
+	issuer.challenge = "not-the-challenge"
+	if _, err := p.Exchange(context.Background(), "good-code", "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); err == nil {
+		t.Error("exchange succeeded with a mismatched code_verifier")
+	}
+}
@@ -0,0 +1,70 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+)
+
+// Bus fans published events out to subscribers in this process. It is meant
+// for live consumers: a subscriber that falls behind its buffer is cut off,
+// its channel closed, instead of holding up the relay. It can then catch up
+// from the database and subscribe again.
+type Bus struct {
+	mu     sync.Mutex
+	nextID int
+	subs   map[int]chan Event
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[int]chan Event{}}
+}
+
+func (b *Bus) Name() string {
+	return "bus"
+}
+
+func (b *Bus) Publish(ctx context.Context, e Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subs, id)
+			close(ch)
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a channel receiving every event published after the
+// call, and a function that ends the subscription. The channel is closed when
+// the subscription ends, by the function or because the subscriber fell
+// behind.
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextID
+	b.nextID++
+	ch := make(chan Event, buffer)
+	b.subs[id] = ch
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[id]; ok {
+			delete(b.subs, id)
+			close(ch)
+		}
+	}
+}
+
+// Reset ends every subscription, for when events may have been missed.
+func (b *Bus) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, ch := range b.subs {
+		delete(b.subs, id)
+		close(ch)
+	}
+}
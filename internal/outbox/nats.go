@@ -0,0 +1,153 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/webhooks"
+)
+
+// NATSSink publishes events to a NATS compatible broker using the plain text
+// client protocol, subject SubjectPrefix.<event type>. Every publish is
+// followed by a PING and waits for the PONG, so a nil error means the broker
+// has processed the message. TLS is not supported.
+type NATSSink struct {
+	// URL is nats://[user:password@]host:port
+	URL           string
+	SubjectPrefix string
+	Timeout       time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (n *NATSSink) Name() string {
+	return "nats"
+}
+
+func (n *NATSSink) Publish(ctx context.Context, e Event) error {
+	body, err := webhooks.NewEnvelope(e.ID, e.Type, e.Data, e.CreatedAt)
+	if err != nil {
+		return err
+	}
+	subject := e.Type
+	if n.SubjectPrefix != "" {
+		subject = n.SubjectPrefix + "." + e.Type
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	err = n.publish(ctx, subject, body)
+	if err != nil && n.conn != nil {
+		//the connection state is unknown after an error, reconnect next time
+		n.conn.Close()
+		n.conn = nil
+	}
+	return err
+}
+
+// Close drops the connection, the next Publish reconnects.
+func (n *NATSSink) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	n.conn = nil
+	return err
+}
+
+func (n *NATSSink) publish(ctx context.Context, subject string, body []byte) error {
+	deadline := time.Now().Add(n.timeout())
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if n.conn == nil {
+		err := n.connect(ctx, deadline)
+		if err != nil {
+			return err
+		}
+	}
+	n.conn.SetDeadline(deadline)
+
+	_, err := fmt.Fprintf(n.conn, "PUB %s %d\r\n%s\r\nPING\r\n", subject, len(body), body)
+	if err != nil {
+		return err
+	}
+	return n.awaitPong()
+}
+
+func (n *NATSSink) connect(ctx context.Context, deadline time.Time) error {
+	u, err := url.Parse(n.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid NATS URL %q", n.URL)
+	}
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(deadline)
+	n.conn = conn
+	n.r = bufio.NewReader(conn)
+
+	//the server greets with INFO before anything else
+	line, err := n.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected greeting from NATS server: %q", strings.TrimSpace(line))
+	}
+
+	options := map[string]any{"verbose": false, "pedantic": false, "name": "chirpy-outbox", "lang": "go"}
+	if u.User != nil {
+		options["user"] = u.User.Username()
+		options["pass"], _ = u.User.Password()
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(conn, "CONNECT %s\r\n", connect)
+	return err
+}
+
+// awaitPong reads until the PONG answering our PING. Errors reported by the
+// server before it, such as a failed authorization, are returned.
+func (n *NATSSink) awaitPong() error {
+	for {
+		line, err := n.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("NATS server: " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (n *NATSSink) timeout() time.Duration {
+	if n.Timeout > 0 {
+		return n.Timeout
+	}
+	return 5 * time.Second
+}
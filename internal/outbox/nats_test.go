@@ -0,0 +1,100 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/webhooks"
+	"github.com/google/uuid"
+)
+
+type natsMessage struct {
+	subject string
+	body    []byte
+}
+
+// fakeNATS speaks enough of the NATS protocol for one client connection.
+func fakeNATS(t *testing.T, reject string) (string, <-chan natsMessage) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	messages := make(chan natsMessage, 10)
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "INFO {\"server_id\":\"test\"}\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			switch {
+			case len(fields) == 3 && fields[0] == "PUB":
+				var size int
+				fmt.Sscan(fields[2], &size)
+				body := make([]byte, size+2)
+				if _, err := io.ReadFull(r, body); err != nil {
+					return
+				}
+				if reject != "" {
+					fmt.Fprintf(conn, "-ERR '%s'\r\n", reject)
+					continue
+				}
+				messages <- natsMessage{subject: fields[1], body: body[:size]}
+			case len(fields) == 1 && fields[0] == "PING":
+				fmt.Fprint(conn, "PONG\r\n")
+			}
+		}
+	}()
+	return "nats://" + ln.Addr().String(), messages
+}
+
+func TestNATSSinkPublish(t *testing.T) {
+	url, messages := fakeNATS(t, "")
+	sink := &NATSSink{URL: url, SubjectPrefix: "chirpy", Timeout: time.Second}
+	defer sink.Close()
+
+	e := Event{ID: uuid.New(), Type: "chirp.created", Data: json.RawMessage(`{"body":"hello"}`), CreatedAt: time.Now()}
+	for i := 0; i < 2; i++ {
+		if err := sink.Publish(context.Background(), e); err != nil {
+			t.Fatalf("Publish() = %v", err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		msg := <-messages
+		if msg.subject != "chirpy.chirp.created" {
+			t.Errorf("subject = %q", msg.subject)
+		}
+		envelope := webhooks.Envelope{}
+		if err := json.Unmarshal(msg.body, &envelope); err != nil || envelope.ID != e.ID || string(envelope.Data) != `{"body":"hello"}` {
+			t.Errorf("unexpected message %s: %v", msg.body, err)
+		}
+	}
+}
+
+func TestNATSSinkServerError(t *testing.T) {
+	url, _ := fakeNATS(t, "Permissions Violation")
+	sink := &NATSSink{URL: url, Timeout: time.Second}
+	defer sink.Close()
+
+	err := sink.Publish(context.Background(), Event{ID: uuid.New(), Type: "chirp.created", Data: json.RawMessage(`{}`)})
+	if err == nil || !strings.Contains(err.Error(), "Permissions Violation") {
+		t.Errorf("Publish() = %v, want the server error", err)
+	}
+}
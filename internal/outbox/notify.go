@@ -0,0 +1,97 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// NotifyChannel is the Postgres channel relayed events are announced on.
+const NotifyChannel = "chirpy_events"
+
+// NotifySink announces events to every server with Postgres NOTIFY. The
+// notification carries only the event ID, payloads are limited to 8000
+// bytes, and the Listener reads the event itself from outbox_events.
+type NotifySink struct {
+	Db *database.Queries
+}
+
+func (s *NotifySink) Name() string {
+	return "notify"
+}
+
+func (s *NotifySink) Publish(ctx context.Context, e Event) error {
+	return s.Db.NotifyOutboxEvent(ctx, database.NotifyOutboxEventParams{
+		Channel: NotifyChannel,
+		Payload: e.ID.String(),
+	})
+}
+
+// Listener receives the NotifySink's notifications and publishes the events
+// to Bus, so live consumers on this server see events relayed by any server.
+type Listener struct {
+	URL string
+	Db  *database.Queries
+	Bus *Bus
+}
+
+// Run listens until ctx is done or the first connection fails. Lost
+// connections are reestablished, and as notifications sent meanwhile are
+// gone every Bus subscription is ended so subscribers catch up.
+func (l *Listener) Run(ctx context.Context) error {
+	conn := pq.NewListener(l.URL, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Error on event listener: %v", err)
+		}
+	})
+	defer conn.Close()
+	err := conn.Listen(NotifyChannel)
+	if err != nil {
+		return err
+	}
+
+	ping := time.NewTicker(time.Minute)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case n := <-conn.Notify:
+			if n == nil {
+				l.Bus.Reset()
+				continue
+			}
+			l.deliver(ctx, n.Extra)
+		case <-ping.C:
+			//notices a dead connection even when no events arrive
+			go conn.Ping()
+		}
+	}
+}
+
+func (l *Listener) deliver(ctx context.Context, payload string) {
+	id, err := uuid.Parse(payload)
+	if err != nil {
+		log.Printf("Error on event listener: unexpected notification %q", payload)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	row, err := l.Db.GetOutboxEvent(ctx, id)
+	if err != nil {
+		log.Printf("Error on database: %v", err)
+		return
+	}
+	l.Bus.Publish(ctx, Event{
+		ID:        row.ID,
+		Type:      row.EventType,
+		UserID:    row.UserID,
+		Data:      row.Payload,
+		Attempts:  row.Attempts,
+		CreatedAt: row.CreatedAt,
+	})
+}
@@ -0,0 +1,91 @@
+// Package outbox implements the transactional outbox. Handlers record domain
+// events in the same transaction as the change they describe, and the Relay
+// later publishes them to every Sink. An event is published at least once:
+// after a crash or a sink failure it is sent again, so consumers deduplicate
+// by Event.ID.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event is a domain event. UserID is the user the event is about, it decides
+// which webhook subscriptions receive it.
+type Event struct {
+	ID        uuid.UUID
+	Type      string
+	UserID    uuid.UUID
+	Data      json.RawMessage
+	Attempts  int32
+	CreatedAt time.Time
+}
+
+// Sink is a destination of published events. Publish must not return before
+// the event is safely handed over, the relay treats a nil error as delivered.
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, e Event) error
+}
+
+// Store holds the outbox. Claim must hide the returned events from other
+// relays until leaseUntil, so replicas can relay concurrently and an event
+// claimed by a crashed relay is picked up once the lease runs out.
+type Store interface {
+	Claim(ctx context.Context, now, leaseUntil time.Time, limit int32) ([]Event, error)
+	MarkPublished(ctx context.Context, id uuid.UUID, at time.Time) error
+	MarkFailed(ctx context.Context, id uuid.UUID, reason string, retryAt time.Time) error
+}
+
+// Relay moves events from the Store to the Sinks. A failed event is retried
+// after BaseDelay, doubling up to MaxDelay, and goes to every sink again.
+type Relay struct {
+	Store     Store
+	Sinks     []Sink
+	BatchSize int32
+	Lease     time.Duration
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+func (r *Relay) retryDelay(attempts int32) time.Duration {
+	d := r.BaseDelay
+	for i := int32(1); i < attempts && d < r.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, r.MaxDelay)
+}
+
+// RelayOnce publishes one batch of due events and returns how many it
+// claimed. Events within a batch are published in order.
+func (r *Relay) RelayOnce(ctx context.Context, now time.Time) (int, error) {
+	events, err := r.Store.Claim(ctx, now, now.Add(r.Lease), r.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range events {
+		errPublish := r.publish(ctx, e)
+		if errPublish != nil {
+			retryAt := time.Now().Add(r.retryDelay(e.Attempts + 1))
+			err = errors.Join(err, r.Store.MarkFailed(ctx, e.ID, errPublish.Error(), retryAt))
+			continue
+		}
+		err = errors.Join(err, r.Store.MarkPublished(ctx, e.ID, time.Now()))
+	}
+	return len(events), err
+}
+
+func (r *Relay) publish(ctx context.Context, e Event) error {
+	var err error
+	for _, sink := range r.Sinks {
+		if errSink := sink.Publish(ctx, e); errSink != nil {
+			err = errors.Join(err, fmt.Errorf("%s: %w", sink.Name(), errSink))
+		}
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type memStore struct {
+	pending   []Event
+	published []uuid.UUID
+	failed    map[uuid.UUID]time.Time
+}
+
+func (m *memStore) Claim(ctx context.Context, now, leaseUntil time.Time, limit int32) ([]Event, error) {
+	claimed := m.pending
+	m.pending = nil
+	return claimed, nil
+}
+
+func (m *memStore) MarkPublished(ctx context.Context, id uuid.UUID, at time.Time) error {
+	m.published = append(m.published, id)
+	return nil
+}
+
+func (m *memStore) MarkFailed(ctx context.Context, id uuid.UUID, reason string, retryAt time.Time) error {
+	m.failed[id] = retryAt
+	return nil
+}
+
+type sinkFunc func(e Event) error
+
+func (f sinkFunc) Name() string                               { return "test" }
+func (f sinkFunc) Publish(ctx context.Context, e Event) error { return f(e) }
+
+func TestRelayOnce(t *testing.T) {
+	ok := Event{ID: uuid.New(), Type: "chirp.created"}
+	broken := Event{ID: uuid.New(), Type: "chirp.deleted", Attempts: 2}
+	store := &memStore{pending: []Event{ok, broken}, failed: map[uuid.UUID]time.Time{}}
+
+	bus := NewBus()
+	received, unsubscribe := bus.Subscribe(10)
+	defer unsubscribe()
+
+	relay := &Relay{
+		Store: store,
+		Sinks: []Sink{bus, sinkFunc(func(e Event) error {
+			if e.ID == broken.ID {
+				return errors.New("broker unavailable")
+			}
+			return nil
+		})},
+		BatchSize: 10,
+		Lease:     time.Minute,
+		BaseDelay: time.Second,
+		MaxDelay:  time.Minute,
+	}
+
+	n, err := relay.RelayOnce(context.Background(), time.Now())
+	if err != nil || n != 2 {
+		t.Fatalf("RelayOnce() = %d, %v", n, err)
+	}
+	if len(store.published) != 1 || store.published[0] != ok.ID {
+		t.Errorf("expected only the first event published, got %v", store.published)
+	}
+	retryAt, failed := store.failed[broken.ID]
+	if !failed {
+		t.Fatal("failed event was not marked for retry")
+	}
+	//third attempt waits 4 * BaseDelay
+	if wait := time.Until(retryAt); wait < 3*time.Second || wait > 4*time.Second {
+		t.Errorf("expected retry in about 4s, got %v", wait)
+	}
+
+	//the bus still receives both, the failing sink does not hold it up
+	for _, want := range []uuid.UUID{ok.ID, broken.ID} {
+		select {
+		case e := <-received:
+			if e.ID != want {
+				t.Errorf("bus received %v, want %v", e.ID, want)
+			}
+		default:
+			t.Fatalf("bus did not receive %v", want)
+		}
+	}
+}
+
+func TestBusCutsOffSlowSubscriber(t *testing.T) {
+	bus := NewBus()
+	slow, unsubscribeSlow := bus.Subscribe(1)
+	fast, unsubscribeFast := bus.Subscribe(10)
+	defer unsubscribeFast()
+
+	bus.Publish(context.Background(), Event{ID: uuid.New()})
+	bus.Publish(context.Background(), Event{ID: uuid.New()})
+	if len(fast) != 2 {
+		t.Errorf("expected 2 buffered events, got %d", len(fast))
+	}
+
+	//the buffered event is still delivered, then the channel is closed
+	<-slow
+	if _, open := <-slow; open {
+		t.Error("channel of a subscriber that fell behind should be closed")
+	}
+	unsubscribeSlow()
+	unsubscribeSlow()
+	bus.Publish(context.Background(), Event{ID: uuid.New()})
+	if len(fast) != 3 {
+		t.Errorf("expected the other subscriber to keep receiving, got %d events", len(fast))
+	}
+}
@@ -0,0 +1,124 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/webhooks"
+	"github.com/google/uuid"
+)
+
+// Record adds an event to the outbox. q must be bound to the transaction
+// making the change, so the event is stored exactly when the change commits.
+// The event is not published before availableAt.
+func Record(ctx context.Context, q *database.Queries, userID uuid.UUID, eventType string, data any, availableAt time.Time) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return q.CreateOutboxEvent(ctx, database.CreateOutboxEventParams{
+		ID:          uuid.New(),
+		UserID:      userID,
+		EventType:   eventType,
+		Payload:     payload,
+		AvailableAt: availableAt,
+		CreatedAt:   time.Now(),
+	})
+}
+
+// ReplacePending changes the data of eventType events about id that are not
+// published yet, e.g. a scheduled chirp edited before it is announced. The
+// events are matched by the "id" field of their data.
+func ReplacePending(ctx context.Context, q *database.Queries, eventType string, id uuid.UUID, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return q.UpdatePendingOutboxEvents(ctx, database.UpdatePendingOutboxEventsParams{
+		Payload:   payload,
+		EventType: eventType,
+		SubjectID: id.String(),
+	})
+}
+
+// DiscardPending removes eventType events about id that are not published
+// yet, matched like ReplacePending.
+func DiscardPending(ctx context.Context, q *database.Queries, eventType string, id uuid.UUID) error {
+	return q.DeletePendingOutboxEvents(ctx, database.DeletePendingOutboxEventsParams{
+		EventType: eventType,
+		SubjectID: id.String(),
+	})
+}
+
+// PostgresStore relays the outbox_events table.
+type PostgresStore struct {
+	Db *database.Queries
+}
+
+func (p *PostgresStore) Claim(ctx context.Context, now, leaseUntil time.Time, limit int32) ([]Event, error) {
+	rows, err := p.Db.ClaimOutboxEvents(ctx, database.ClaimOutboxEventsParams{
+		LeaseUntil: leaseUntil,
+		Now:        now,
+		Limit:      limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	events := []Event{}
+	for _, row := range rows {
+		events = append(events, Event{
+			ID:        row.ID,
+			Type:      row.EventType,
+			UserID:    row.UserID,
+			Data:      row.Payload,
+			Attempts:  row.Attempts,
+			CreatedAt: row.CreatedAt,
+		})
+	}
+	return events, nil
+}
+
+func (p *PostgresStore) MarkPublished(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return p.Db.MarkOutboxEventPublished(ctx, database.MarkOutboxEventPublishedParams{
+		PublishedAt: sql.NullTime{Time: at, Valid: true},
+		ID:          id,
+	})
+}
+
+func (p *PostgresStore) MarkFailed(ctx context.Context, id uuid.UUID, reason string, retryAt time.Time) error {
+	return p.Db.MarkOutboxEventFailed(ctx, database.MarkOutboxEventFailedParams{
+		AvailableAt: retryAt,
+		LastError:   sql.NullString{String: reason, Valid: true},
+		ID:          id,
+	})
+}
+
+// WebhookSink queues the event for the user's webhook subscriptions and the
+// all_users ones. Redelivering an event queues nothing new.
+type WebhookSink struct {
+	Db *database.Queries
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhooks"
+}
+
+func (s *WebhookSink) Publish(ctx context.Context, e Event) error {
+	body, err := webhooks.NewEnvelope(e.ID, e.Type, e.Data, e.CreatedAt)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	_, err = s.Db.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+		EventID:       e.ID,
+		EventType:     e.Type,
+		Payload:       body,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UserID:        e.UserID,
+	})
+	return err
+}
@@ -0,0 +1,100 @@
+// Package realtime is the channel model of the WebSocket API: which channels
+// a user may subscribe to, which channels an event is pushed to, and how
+// many connections a user may hold.
+package realtime
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/Walther-Knight/chirpy/internal/models"
+	"github.com/Walther-Knight/chirpy/internal/outbox"
+	"github.com/Walther-Knight/chirpy/internal/webhooks"
+	"github.com/google/uuid"
+)
+
+// Channels. user: and chirp: are followed by a UUID.
+const (
+	ChannelChirps        = "chirps"
+	ChannelNotifications = "notifications"
+	prefixUser           = "user:"
+	prefixChirp          = "chirp:"
+)
+
+var ErrUnknownChannel = errors.New("unknown channel")
+
+func notificationsKey(userID uuid.UUID) string {
+	return ChannelNotifications + ":" + userID.String()
+}
+
+// Key resolves a channel named by userID's client to the key events are
+// routed by. notifications is always the caller's own.
+func Key(channel string, userID uuid.UUID) (string, error) {
+	switch {
+	case channel == ChannelChirps:
+		return channel, nil
+	case channel == ChannelNotifications:
+		return notificationsKey(userID), nil
+	}
+	for _, prefix := range []string{prefixUser, prefixChirp} {
+		if rest, ok := strings.CutPrefix(channel, prefix); ok {
+			id, err := uuid.Parse(rest)
+			if err != nil {
+				return "", ErrUnknownChannel
+			}
+			return prefix + id.String(), nil
+		}
+	}
+	return "", ErrUnknownChannel
+}
+
+// Route returns the keys of the channels e is pushed to: a chirp event goes
+// to chirps, its author's timeline and the chirp's own channel, the user's
+// own events to their notifications.
+func Route(e outbox.Event) []string {
+	switch e.Type {
+	case webhooks.EventChirpCreated, webhooks.EventChirpDeleted:
+		var chirp models.Chirp
+		if json.Unmarshal(e.Data, &chirp) != nil {
+			return nil
+		}
+		return []string{ChannelChirps, prefixUser + chirp.UserID, prefixChirp + chirp.ID}
+	case webhooks.EventUserUpgraded:
+		return []string{notificationsKey(e.UserID)}
+	}
+	return nil
+}
+
+// ConnLimiter counts the open connections of every user on this server.
+type ConnLimiter struct {
+	Max int
+
+	mu   sync.Mutex
+	open map[uuid.UUID]int
+}
+
+func NewConnLimiter(max int) *ConnLimiter {
+	return &ConnLimiter{Max: max, open: map[uuid.UUID]int{}}
+}
+
+// Acquire counts a new connection of userID, unless the user is at Max.
+func (l *ConnLimiter) Acquire(userID uuid.UUID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.open[userID] >= l.Max {
+		return false
+	}
+	l.open[userID]++
+	return true
+}
+
+func (l *ConnLimiter) Release(userID uuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.open[userID]--
+	if l.open[userID] <= 0 {
+		delete(l.open, userID)
+	}
+}
@@ -0,0 +1,60 @@
+package realtime
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/Walther-Knight/chirpy/internal/models"
+	"github.com/Walther-Knight/chirpy/internal/outbox"
+	"github.com/Walther-Knight/chirpy/internal/webhooks"
+	"github.com/google/uuid"
+)
+
+func TestKeyAndRoute(t *testing.T) {
+	author, reader := uuid.New(), uuid.New()
+	chirpID := uuid.New()
+	data, _ := json.Marshal(models.Chirp{ID: chirpID.String(), UserID: author.String()})
+	created := outbox.Event{Type: webhooks.EventChirpCreated, UserID: author, Data: data}
+
+	for _, channel := range []string{"chirps", "user:" + author.String(), "chirp:" + chirpID.String()} {
+		key, err := Key(channel, reader)
+		if err != nil {
+			t.Fatalf("Key(%q) error: %v", channel, err)
+		}
+		if !slices.Contains(Route(created), key) {
+			t.Errorf("chirp.created not routed to %s", channel)
+		}
+	}
+
+	upgraded := outbox.Event{Type: webhooks.EventUserUpgraded, UserID: author}
+	own, _ := Key("notifications", author)
+	other, _ := Key("notifications", reader)
+	if !slices.Contains(Route(upgraded), own) || slices.Contains(Route(upgraded), other) {
+		t.Errorf("notifications must only reach their user, routed to %v", Route(upgraded))
+	}
+
+	for _, channel := range []string{"", "likes", "user:", "user:walt", "notifications:" + author.String()} {
+		if _, err := Key(channel, reader); err != ErrUnknownChannel {
+			t.Errorf("Key(%q) error = %v, want ErrUnknownChannel", channel, err)
+		}
+	}
+}
+
+func TestConnLimiter(t *testing.T) {
+	l := NewConnLimiter(2)
+	user := uuid.New()
+	if !l.Acquire(user) || !l.Acquire(user) {
+		t.Fatal("expected two connections allowed")
+	}
+	if l.Acquire(user) {
+		t.Error("third connection should be refused")
+	}
+	if !l.Acquire(uuid.New()) {
+		t.Error("the limit is per user")
+	}
+	l.Release(user)
+	if !l.Acquire(user) {
+		t.Error("a released slot should be reusable")
+	}
+}
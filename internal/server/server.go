@@ -3,8 +3,10 @@ package server
 import (
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/Walther-Knight/chirpy/internal/api"
+	"github.com/Walther-Knight/chirpy/internal/auth"
 	"github.com/Walther-Knight/chirpy/internal/middleware"
 )
 
@@ -15,23 +17,77 @@ func Start(cfg *middleware.ApiConfig) error {
 		Addr:    ":8080",
 	}
 	log.Println("Starting handlers...")
-	//admin functions
+	//admin functions, every /admin route requires the admin role
 	newMux.HandleFunc("GET /api/healthz", api.Health)
-	newMux.HandleFunc("GET /admin/metrics", cfg.HitTotal)
-	newMux.HandleFunc("POST /admin/reset", cfg.Reset)
-	//application functions
+	newMux.Handle("GET /admin/metrics", cfg.Require(middleware.RequireAdmin, cfg.HitTotal))
+	if cfg.Platform == "dev" {
+		newMux.Handle("POST /admin/reset", cfg.Require(middleware.RequireAdmin, cfg.Reset))
+	}
+	newMux.Handle("GET /admin/login-attempts", cfg.Require(middleware.RequireAdmin, func(w http.ResponseWriter, r *http.Request) { api.ListLoginAttempts(cfg, w, r) }))
+	newMux.Handle("PUT /admin/users/{userID}/role", cfg.Require(middleware.RequireAdmin, func(w http.ResponseWriter, r *http.Request) { api.SetUserRole(cfg, w, r) }))
+	newMux.Handle("POST /admin/users/{userID}/lock", cfg.Require(middleware.RequireAdmin, func(w http.ResponseWriter, r *http.Request) { api.LockUser(cfg, w, r) }))
+	newMux.Handle("POST /admin/users/{userID}/unlock", cfg.Require(middleware.RequireAdmin, func(w http.ResponseWriter, r *http.Request) { api.UnlockUser(cfg, w, r) }))
+	newMux.Handle("GET /admin/webhooks", cfg.Require(middleware.RequireAdmin, func(w http.ResponseWriter, r *http.Request) { api.ListWebhookEvents(cfg, w, r) }))
+	newMux.Handle("POST /admin/webhooks/{id}/replay", cfg.Require(middleware.RequireAdmin, func(w http.ResponseWriter, r *http.Request) { api.ReplayWebhookEvent(cfg, w, r) }))
+	newMux.Handle("GET /admin/jobs", cfg.Require(middleware.RequireAdmin, func(w http.ResponseWriter, r *http.Request) { api.ListJobs(cfg, w, r) }))
+	newMux.Handle("POST /admin/jobs/{jobID}/retry", cfg.Require(middleware.RequireAdmin, func(w http.ResponseWriter, r *http.Request) { api.RetryJob(cfg, w, r) }))
+	//application functions, routes wrapped in cfg.Require get the caller from auth.PrincipalFrom
 	newMux.HandleFunc("POST /api/login", func(w http.ResponseWriter, r *http.Request) { api.UserLogin(cfg, w, r) })
+	newMux.HandleFunc("GET /api/oidc/login", func(w http.ResponseWriter, r *http.Request) { api.OIDCLogin(cfg, w, r) })
+	newMux.HandleFunc("GET /api/oidc/callback", func(w http.ResponseWriter, r *http.Request) { api.OIDCCallback(cfg, w, r) })
+	newMux.HandleFunc("POST /api/login/mfa", func(w http.ResponseWriter, r *http.Request) { api.LoginMFA(cfg, w, r) })
+	newMux.Handle("POST /api/mfa/totp/enroll", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.EnrollTOTP(cfg, w, r) }))
+	newMux.Handle("POST /api/mfa/totp/confirm", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.ConfirmTOTP(cfg, w, r) }))
+	newMux.Handle("POST /api/mfa/totp/disable", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.DisableTOTP(cfg, w, r) }))
 	newMux.HandleFunc("POST /api/refresh", func(w http.ResponseWriter, r *http.Request) { api.UpdateAccessToken(cfg, w, r) })
 	newMux.HandleFunc("POST /api/revoke", func(w http.ResponseWriter, r *http.Request) { api.RevokeRefreshToken(cfg, w, r) })
+	newMux.Handle("POST /api/revoke/all", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.RevokeAllSessions(cfg, w, r) }))
 	newMux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) { api.GetChirp(cfg, w, r) })
-	newMux.HandleFunc("DELETE /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) { api.DeleteChirp(cfg, w, r) })
-	newMux.HandleFunc("POST /api/chirps", func(w http.ResponseWriter, r *http.Request) { api.NewChirp(cfg, w, r) })
+	newMux.Handle("DELETE /api/chirps/{chirpID}", cfg.Require(middleware.RequireScopes(auth.ScopeChirpsWrite), func(w http.ResponseWriter, r *http.Request) { api.DeleteChirp(cfg, w, r) }))
+	newMux.Handle("PUT /api/chirps/{chirpID}", cfg.Require(middleware.RequireScopes(auth.ScopeChirpsWrite), func(w http.ResponseWriter, r *http.Request) { api.UpdateChirp(cfg, w, r) }))
+	newMux.Handle("GET /api/chirps/scheduled", cfg.Require(middleware.RequireScopes(auth.ScopeChirpsRead), func(w http.ResponseWriter, r *http.Request) { api.ListScheduledChirps(cfg, w, r) }))
+	newMux.Handle("POST /api/chirps", cfg.Require(middleware.RequireScopes(auth.ScopeChirpsWrite), func(w http.ResponseWriter, r *http.Request) { api.NewChirp(cfg, w, r) }))
 	newMux.HandleFunc("GET /api/chirps", func(w http.ResponseWriter, r *http.Request) { api.GetAllChirps(cfg, w, r) })
+	newMux.HandleFunc("GET /api/stream/chirps", func(w http.ResponseWriter, r *http.Request) { api.StreamChirps(cfg, w, r) })
+	newMux.Handle("GET /api/realtime", cfg.Require(middleware.RequireScopes(auth.ScopeChirpsRead), func(w http.ResponseWriter, r *http.Request) { api.Realtime(cfg, w, r) }))
 	newMux.HandleFunc("POST /api/users", func(w http.ResponseWriter, r *http.Request) { api.NewUser(cfg, w, r) })
-	newMux.HandleFunc("PUT /api/users", func(w http.ResponseWriter, r *http.Request) { api.UpdateUser(cfg, w, r) })
-	newMux.HandleFunc("POST /api/polka/webhooks", func(w http.ResponseWriter, r *http.Request) { api.UpdateChirpyRed(cfg, w, r) })
+	newMux.Handle("PUT /api/users", cfg.Require(middleware.RequireScopes(auth.ScopeProfileWrite), func(w http.ResponseWriter, r *http.Request) { api.UpdateUser(cfg, w, r) }))
+	newMux.Handle("GET /api/users/me", cfg.Require(middleware.Requirement{AllowPendingDeletion: true}, func(w http.ResponseWriter, r *http.Request) { api.GetCurrentUser(cfg, w, r) }))
+	newMux.Handle("DELETE /api/users/me", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.DeleteAccount(cfg, w, r) }))
+	newMux.Handle("POST /api/users/me/restore", cfg.Require(middleware.RequireAccountSession, func(w http.ResponseWriter, r *http.Request) { api.RestoreAccount(cfg, w, r) }))
+	newMux.Handle("GET /api/users/me/export", cfg.Require(middleware.RequireAccountSession, func(w http.ResponseWriter, r *http.Request) { api.ExportAccount(cfg, w, r) }))
+	newMux.Handle("GET /api/users/me/exports/{exportID}", cfg.Require(middleware.RequireAccountSession, func(w http.ResponseWriter, r *http.Request) { api.GetDataExport(cfg, w, r) }))
+	newMux.Handle("POST /api/tokens", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.CreatePersonalAccessToken(cfg, w, r) }))
+	newMux.Handle("GET /api/tokens", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.ListPersonalAccessTokens(cfg, w, r) }))
+	newMux.Handle("DELETE /api/tokens/{tokenID}", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.RevokePersonalAccessToken(cfg, w, r) }))
+	newMux.Handle("POST /api/webhooks", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.CreateWebhookSubscription(cfg, w, r) }))
+	newMux.Handle("GET /api/webhooks", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.ListWebhookSubscriptions(cfg, w, r) }))
+	newMux.Handle("DELETE /api/webhooks/{webhookID}", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.DeleteWebhookSubscription(cfg, w, r) }))
+	newMux.Handle("POST /api/webhooks/{webhookID}/disable", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.DisableWebhookSubscription(cfg, w, r) }))
+	newMux.Handle("POST /api/webhooks/{webhookID}/enable", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.EnableWebhookSubscription(cfg, w, r) }))
+	newMux.Handle("POST /api/webhooks/{webhookID}/test", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.TestWebhookSubscription(cfg, w, r) }))
+	newMux.Handle("GET /api/webhooks/{webhookID}/deliveries", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.ListWebhookDeliveries(cfg, w, r) }))
+	newMux.Handle("POST /api/oauth/clients", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.CreateOAuthClient(cfg, w, r) }))
+	newMux.Handle("GET /api/oauth/clients", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.ListOAuthClients(cfg, w, r) }))
+	newMux.Handle("DELETE /api/oauth/clients/{clientID}", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.DeleteOAuthClient(cfg, w, r) }))
+	newMux.Handle("GET /api/oauth/authorize", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.GetOAuthConsent(cfg, w, r) }))
+	newMux.Handle("POST /api/oauth/authorize", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.AuthorizeOAuthClient(cfg, w, r) }))
+	newMux.HandleFunc("POST /api/oauth/token", func(w http.ResponseWriter, r *http.Request) { api.OAuthToken(cfg, w, r) })
+	newMux.HandleFunc("POST /api/email/verify", func(w http.ResponseWriter, r *http.Request) { api.VerifyEmail(cfg, w, r) })
+	newMux.Handle("POST /api/email/verify/resend", cfg.Require(middleware.RequireScopes(auth.ScopeProfileWrite), func(w http.ResponseWriter, r *http.Request) { api.ResendEmailVerification(cfg, w, r) }))
+	newMux.HandleFunc("POST /api/password/forgot", func(w http.ResponseWriter, r *http.Request) { api.ForgotPassword(cfg, w, r) })
+	newMux.HandleFunc("POST /api/password/reset", func(w http.ResponseWriter, r *http.Request) { api.ResetPassword(cfg, w, r) })
+	newMux.Handle("POST /api/billing/checkout", cfg.Require(middleware.RequireSession, func(w http.ResponseWriter, r *http.Request) { api.StartCheckout(cfg, w, r) }))
+	for name, provider := range cfg.Billing {
+		newMux.HandleFunc("POST /api/"+name+"/webhooks", func(w http.ResponseWriter, r *http.Request) { api.BillingWebhook(cfg, provider, w, r) })
+	}
 	newMux.Handle("/app/", cfg.MiddlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir("./static")))))
 
+	go api.RunJobs(cfg)
+	go api.RunOutboxRelay(cfg, time.Second)
+	go api.RunEventListener(cfg)
+	go api.RunWebhookDispatcher(cfg, 5*time.Second)
+
 	log.Printf("Starting http server on %s\n", httpSrv.Addr)
 	return httpSrv.ListenAndServe()
 }
@@ -0,0 +1,92 @@
+// Package signature signs and verifies webhook payloads with HMAC-SHA256.
+//
+// The signature header has the form "t=<unix seconds>,v1=<hex digest>" where
+// the digest covers "<t>.<body>". A header may carry several v1 values so a
+// sender can sign with an old and a new secret while the secret is rotated.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMissing           = errors.New("signature header is missing")
+	ErrMalformed         = errors.New("signature header is malformed")
+	ErrTimestampExpired  = errors.New("signature timestamp is outside the tolerance window")
+	ErrSignatureMismatch = errors.New("no signature matches a configured secret")
+)
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>".
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Header builds a signature header for body, signed with every secret.
+func Header(secrets []string, now time.Time, body []byte) string {
+	timestamp := now.Unix()
+	parts := []string{"t=" + strconv.FormatInt(timestamp, 10)}
+	for _, secret := range secrets {
+		parts = append(parts, "v1="+Sign(secret, timestamp, body))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Verify checks header against body. It succeeds when the timestamp is
+// within tolerance of now and any v1 signature matches any of the secrets.
+func Verify(header string, body []byte, secrets []string, tolerance time.Duration, now time.Time) error {
+	if header == "" {
+		return ErrMissing
+	}
+
+	timestamp := int64(-1)
+	signatures := [][]byte{}
+	for _, part := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			return ErrMalformed
+		}
+		switch key {
+		case "t":
+			t, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || t < 0 {
+				return ErrMalformed
+			}
+			timestamp = t
+		case "v1":
+			sig, err := hex.DecodeString(value)
+			if err != nil {
+				return ErrMalformed
+			}
+			signatures = append(signatures, sig)
+		}
+		//unknown schemes are ignored so the sender can add new ones
+	}
+	if timestamp < 0 || len(signatures) == 0 {
+		return ErrMalformed
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrTimestampExpired
+	}
+
+	for _, secret := range secrets {
+		expected, _ := hex.DecodeString(Sign(secret, timestamp, body))
+		for _, sig := range signatures {
+			if hmac.Equal(expected, sig) {
+				return nil
+			}
+		}
+	}
+	return ErrSignatureMismatch
+}
@@ -0,0 +1,49 @@
+package signature
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"event":"user.upgraded"}`)
+	header := Header([]string{"new-secret"}, now, body)
+
+	tests := []struct {
+		name    string
+		header  string
+		body    []byte
+		secrets []string
+		now     time.Time
+		want    error
+	}{
+		{"valid", header, body, []string{"new-secret"}, now, nil},
+		{"rotated secret", header, body, []string{"old-secret", "new-secret"}, now, nil},
+		{"within tolerance", header, body, []string{"new-secret"}, now.Add(4 * time.Minute), nil},
+		{"expired", header, body, []string{"new-secret"}, now.Add(6 * time.Minute), ErrTimestampExpired},
+		{"from the future", header, body, []string{"new-secret"}, now.Add(-6 * time.Minute), ErrTimestampExpired},
+		{"wrong secret", header, body, []string{"old-secret"}, now, ErrSignatureMismatch},
+		{"tampered body", header, []byte(`{"event":"user.downgraded"}`), []string{"new-secret"}, now, ErrSignatureMismatch},
+		{"missing", "", body, []string{"new-secret"}, now, ErrMissing},
+		{"no timestamp", "v1=abcd", body, []string{"new-secret"}, now, ErrMalformed},
+		{"no signature", "t=1700000000", body, []string{"new-secret"}, now, ErrMalformed},
+		{"bad hex", "t=1700000000,v1=zz", body, []string{"new-secret"}, now, ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Verify(tt.header, tt.body, tt.secrets, 5*time.Minute, tt.now)
+			if got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeaderSignsWithEverySecret(t *testing.T) {
+	header := Header([]string{"a", "b"}, time.Unix(1, 0), []byte("x"))
+	if !strings.HasPrefix(header, "t=1,") || strings.Count(header, "v1=") != 2 {
+		t.Errorf("unexpected header %q", header)
+	}
+}
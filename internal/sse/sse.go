@@ -0,0 +1,71 @@
+// Package sse writes Server-Sent Events streams.
+package sse
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Writer sends events on one response. Every write must reach the client
+// within WriteTimeout, so a client that stops reading is disconnected
+// instead of blocking its handler.
+type Writer struct {
+	w            http.ResponseWriter
+	rc           *http.ResponseController
+	WriteTimeout time.Duration
+}
+
+// NewWriter writes the stream headers and flushes them. It fails if the
+// response cannot be flushed, before anything is written.
+func NewWriter(w http.ResponseWriter, retry time.Duration) (*Writer, error) {
+	rc := http.NewResponseController(w)
+	sw := &Writer{w: w, rc: rc, WriteTimeout: 10 * time.Second}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	//stops nginx and similar proxies from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	err := sw.write(func() {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "retry: %d\n\n", retry.Milliseconds())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+func (sw *Writer) write(fn func()) error {
+	//not every ResponseWriter supports deadlines, the flush below still has to work
+	sw.rc.SetWriteDeadline(time.Now().Add(sw.WriteTimeout))
+	fn()
+	return sw.rc.Flush()
+}
+
+// Event sends one event. Clients resume after id with the Last-Event-ID
+// header. data may span lines.
+func (sw *Writer) Event(id, name string, data []byte) error {
+	return sw.write(func() {
+		if id != "" {
+			fmt.Fprintf(sw.w, "id: %s\n", id)
+		}
+		if name != "" {
+			fmt.Fprintf(sw.w, "event: %s\n", name)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			fmt.Fprintf(sw.w, "data: %s\n", line)
+		}
+		fmt.Fprint(sw.w, "\n")
+	})
+}
+
+// Comment sends a line clients ignore, used as a heartbeat that keeps
+// proxies from closing an idle stream.
+func (sw *Writer) Comment(text string) error {
+	return sw.write(func() {
+		fmt.Fprintf(sw.w, ": %s\n\n", text)
+	})
+}
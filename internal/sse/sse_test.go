@@ -0,0 +1,30 @@
+package sse
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	sw, err := NewWriter(rec, 3*time.Second)
+	if err != nil {
+		t.Fatalf("NewWriter() error: %v", err)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	sw.Event("42", "chirp.created", []byte("{\"a\":1}\n{\"b\":2}"))
+	sw.Comment("heartbeat")
+
+	want := "retry: 3000\n\n" +
+		"id: 42\nevent: chirp.created\ndata: {\"a\":1}\ndata: {\"b\":2}\n\n" +
+		": heartbeat\n\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("stream = %q, want %q", got, want)
+	}
+	if !rec.Flushed {
+		t.Error("expected the stream to be flushed")
+	}
+}
@@ -0,0 +1,133 @@
+// Package subscription models the Chirpy Red subscription lifecycle. Apply
+// is a pure state transition so payment provider events can be replayed and
+// tested without a database.
+package subscription
+
+import (
+	"errors"
+	"time"
+)
+
+const PlanRed = "red"
+
+const (
+	StatusActive = "active"
+	// StatusPastDue keeps the features until the period ends while the
+	// provider retries the payment
+	StatusPastDue = "past_due"
+	// StatusCancelled keeps the features until the paid period ends
+	StatusCancelled = "cancelled"
+	StatusExpired   = "expired"
+)
+
+const (
+	EventUpgraded      = "user.upgraded"
+	EventDowngraded    = "user.downgraded"
+	EventRenewed       = "subscription.renewed"
+	EventCancelled     = "subscription.cancelled"
+	EventPaymentFailed = "payment.failed"
+)
+
+var (
+	ErrUnknownEvent   = errors.New("unknown subscription event")
+	ErrNoSubscription = errors.New("user has no subscription")
+)
+
+// LegacyPeriodEnd is the period end of members upgraded before
+// subscriptions existed. They keep Chirpy Red until the provider cancels or
+// downgrades them.
+var LegacyPeriodEnd = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+type Subscription struct {
+	Plan             string
+	Status           string
+	CurrentPeriodEnd time.Time
+	CancelledAt      *time.Time
+}
+
+// Entitled reports whether the subscriber gets the plan's features at now.
+func (s Subscription) Entitled(now time.Time) bool {
+	return s.Status != StatusExpired && now.Before(s.CurrentPeriodEnd)
+}
+
+// Legacy reports whether s was created for a member upgraded before
+// subscriptions existed and has no paid period.
+func (s Subscription) Legacy() bool {
+	return s.CurrentPeriodEnd.Equal(LegacyPeriodEnd)
+}
+
+// Event is a provider event. Plan and PeriodEnd are optional, the zero
+// values mean the plan is unchanged and the period is extended by the
+// default length.
+type Event struct {
+	Type      string
+	Plan      string
+	PeriodEnd time.Time
+}
+
+// Apply returns the subscription after e. current is nil for a user who
+// never subscribed.
+func Apply(current *Subscription, e Event, now time.Time, period time.Duration) (Subscription, error) {
+	switch e.Type {
+	case EventUpgraded, EventRenewed:
+		next := Subscription{
+			Plan:             PlanRed,
+			Status:           StatusActive,
+			CurrentPeriodEnd: now.Add(period),
+		}
+		if current != nil {
+			next.Plan = current.Plan
+			switch {
+			case !current.Entitled(now):
+			case e.Type == EventUpgraded:
+				//upgrading a subscriber who has the features buys no time, so a
+				//redelivered upgrade changes nothing
+				next.CurrentPeriodEnd = current.CurrentPeriodEnd
+			case !current.Legacy():
+				//a renewal extends the paid period instead of restarting it
+				next.CurrentPeriodEnd = current.CurrentPeriodEnd.Add(period)
+			}
+		}
+		if e.Plan != "" {
+			next.Plan = e.Plan
+		}
+		if !e.PeriodEnd.IsZero() {
+			next.CurrentPeriodEnd = e.PeriodEnd
+		}
+		return next, nil
+	case EventCancelled, EventPaymentFailed, EventDowngraded:
+	default:
+		return Subscription{}, ErrUnknownEvent
+	}
+
+	if current == nil {
+		return Subscription{}, ErrNoSubscription
+	}
+	next := *current
+	//a legacy member has no paid period to keep, they get one from now
+	if next.Legacy() && e.Type != EventDowngraded {
+		next.CurrentPeriodEnd = now.Add(period)
+	}
+	switch e.Type {
+	case EventCancelled:
+		if next.Status != StatusExpired {
+			next.Status = StatusCancelled
+		}
+		if next.CancelledAt == nil {
+			next.CancelledAt = &now
+		}
+	case EventPaymentFailed:
+		if next.Status == StatusActive {
+			next.Status = StatusPastDue
+		}
+	case EventDowngraded:
+		next.Status = StatusExpired
+		if next.CurrentPeriodEnd.After(now) {
+			next.CurrentPeriodEnd = now
+		}
+	}
+	if !e.PeriodEnd.IsZero() && e.Type != EventDowngraded {
+		next.CurrentPeriodEnd = e.PeriodEnd
+	}
+	return next, nil
+}
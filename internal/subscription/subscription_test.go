@@ -0,0 +1,76 @@
+package subscription
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApply(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	period := 30 * 24 * time.Hour
+	active := &Subscription{Plan: PlanRed, Status: StatusActive, CurrentPeriodEnd: now.Add(10 * 24 * time.Hour)}
+	expired := &Subscription{Plan: PlanRed, Status: StatusExpired, CurrentPeriodEnd: now.Add(-time.Hour)}
+	legacy := &Subscription{Plan: PlanRed, Status: StatusActive, CurrentPeriodEnd: LegacyPeriodEnd}
+
+	tests := []struct {
+		name       string
+		current    *Subscription
+		event      Event
+		wantStatus string
+		wantEnd    time.Time
+		wantErr    error
+	}{
+		{"first upgrade", nil, Event{Type: EventUpgraded}, StatusActive, now.Add(period), nil},
+		{"upgrade with period from provider", nil, Event{Type: EventUpgraded, PeriodEnd: now.Add(time.Hour)}, StatusActive, now.Add(time.Hour), nil},
+		{"upgrade of an active subscriber keeps the period", active, Event{Type: EventUpgraded}, StatusActive, active.CurrentPeriodEnd, nil},
+		{"upgrade after expiry starts a period", expired, Event{Type: EventUpgraded}, StatusActive, now.Add(period), nil},
+		{"renewal extends period", active, Event{Type: EventRenewed}, StatusActive, active.CurrentPeriodEnd.Add(period), nil},
+		{"renewal after expiry restarts", expired, Event{Type: EventRenewed}, StatusActive, now.Add(period), nil},
+		{"cancel keeps period", active, Event{Type: EventCancelled}, StatusCancelled, active.CurrentPeriodEnd, nil},
+		{"payment failed", active, Event{Type: EventPaymentFailed}, StatusPastDue, active.CurrentPeriodEnd, nil},
+		{"downgrade ends now", active, Event{Type: EventDowngraded}, StatusExpired, now, nil},
+		{"legacy member upgrade changes nothing", legacy, Event{Type: EventUpgraded}, StatusActive, LegacyPeriodEnd, nil},
+		{"legacy member renewal starts a period", legacy, Event{Type: EventRenewed}, StatusActive, now.Add(period), nil},
+		{"legacy member cancel keeps one period", legacy, Event{Type: EventCancelled}, StatusCancelled, now.Add(period), nil},
+		{"legacy member payment failed", legacy, Event{Type: EventPaymentFailed}, StatusPastDue, now.Add(period), nil},
+		{"legacy member downgrade ends now", legacy, Event{Type: EventDowngraded}, StatusExpired, now, nil},
+		{"cancel without subscription", nil, Event{Type: EventCancelled}, "", time.Time{}, ErrNoSubscription},
+		{"unknown event", active, Event{Type: "user.deleted"}, "", time.Time{}, ErrUnknownEvent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(tt.current, tt.event, now, period)
+			if err != tt.wantErr {
+				t.Fatalf("Apply() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Status != tt.wantStatus || !got.CurrentPeriodEnd.Equal(tt.wantEnd) {
+				t.Errorf("Apply() = %s until %v, want %s until %v", got.Status, got.CurrentPeriodEnd, tt.wantStatus, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestCancelledStaysEntitledUntilPeriodEnd(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := Subscription{Plan: PlanRed, Status: StatusActive, CurrentPeriodEnd: now.Add(time.Hour)}
+	s, err := Apply(&s, Event{Type: EventCancelled}, now, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Entitled(now) || s.Entitled(now.Add(time.Hour)) {
+		t.Errorf("cancelled subscription should be entitled until %v only", s.CurrentPeriodEnd)
+	}
+	if s.CancelledAt == nil || !s.CancelledAt.Equal(now) {
+		t.Errorf("CancelledAt = %v, want %v", s.CancelledAt, now)
+	}
+}
+
+func TestLegacyNeverExpires(t *testing.T) {
+	s := Subscription{Plan: PlanRed, Status: StatusActive, CurrentPeriodEnd: LegacyPeriodEnd}
+	if !s.Legacy() || !s.Entitled(time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("legacy subscription should stay entitled")
+	}
+}
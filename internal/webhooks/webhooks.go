@@ -0,0 +1,275 @@
+// Package webhooks delivers Chirpy events to URLs registered by users.
+// Deliveries are queued in the database by the outbox relay and sent here,
+// signed with the subscription's secret in the same format as signed Polka
+// webhooks (see the signature package).
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Walther-Knight/chirpy/internal/signature"
+	"github.com/google/uuid"
+)
+
+// Events a subscription can ask for.
+const (
+	EventChirpCreated = "chirp.created"
+	EventChirpDeleted = "chirp.deleted"
+	EventUserUpgraded = "user.upgraded"
+	// EventTest is only sent by POST /api/webhooks/{id}/test
+	EventTest = "webhook.test"
+)
+
+var AllEvents = []string{EventChirpCreated, EventChirpDeleted, EventUserUpgraded}
+
+const (
+	SignatureHeader = "Chirpy-Signature"
+	EventHeader     = "Chirpy-Event"
+	DeliveryHeader  = "Chirpy-Delivery"
+)
+
+// ParseEvents validates requested events and returns them de-duplicated in
+// canonical order.
+func ParseEvents(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, errors.New("at least one event is required")
+	}
+	for _, event := range requested {
+		if !slices.Contains(AllEvents, event) {
+			return nil, fmt.Errorf("unknown event %q", event)
+		}
+	}
+	events := []string{}
+	for _, event := range AllEvents {
+		if slices.Contains(requested, event) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// JoinEvents and SplitEvents convert to and from the space separated form
+// stored in the database.
+func JoinEvents(events []string) string {
+	return strings.Join(events, " ")
+}
+
+func SplitEvents(events string) []string {
+	return strings.Fields(events)
+}
+
+// ValidateURL accepts absolute https URLs whose host resolves to public
+// addresses. Plain http and local or private addresses are only accepted when
+// allowLocal is set, since the server itself makes the request.
+func ValidateURL(ctx context.Context, raw string, allowLocal bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return errors.New("webhook URL must be an absolute URL")
+	}
+	if u.User != nil {
+		return errors.New("webhook URL must not contain credentials")
+	}
+	if u.Scheme != "https" && (u.Scheme != "http" || !allowLocal) {
+		return errors.New("webhook URL must use https")
+	}
+	if allowLocal {
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return errors.New("webhook URL host does not resolve")
+	}
+	for _, addr := range addrs {
+		if err := CheckAddress(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blockedPrefixes are special purpose ranges the netip predicates miss.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT, includes Alibaba Cloud's metadata service
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, includes broadcast
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+}
+
+var (
+	nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFour   = netip.MustParsePrefix("2002::/16")
+)
+
+// CheckAddress rejects addresses a webhook must not reach: loopback,
+// private, shared (carrier-grade NAT), link-local, multicast, unspecified and
+// reserved ones, which covers cloud metadata services. NAT64 and 6to4
+// addresses are checked against the IPv4 address they reach.
+func CheckAddress(addr netip.Addr) error {
+	addr = addr.Unmap()
+	v4, embedded := embeddedIPv4(addr)
+	if !publicAddress(addr) || (embedded && !publicAddress(v4)) {
+		return fmt.Errorf("webhook URL must not point to the local or private address %s", addr)
+	}
+	return nil
+}
+
+func publicAddress(addr netip.Addr) bool {
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsMulticast() || addr.IsUnspecified() || !addr.IsValid() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+func embeddedIPv4(addr netip.Addr) (netip.Addr, bool) {
+	b := addr.As16()
+	switch {
+	case nat64Prefix.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[12:16])), true
+	case sixToFour.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[2:6])), true
+	}
+	return netip.Addr{}, false
+}
+
+// dialControl refuses connections to addresses CheckAddress rejects. It runs
+// after DNS resolution, so a host that pointed to a public address when its
+// URL was validated and to a private one now is still refused.
+func dialControl(network, address string, c syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	return CheckAddress(addrPort.Addr())
+}
+
+// NewClient returns the client deliveries are sent with. It does not follow
+// redirects and, unless allowLocal is set, does not connect to local or
+// private addresses.
+func NewClient(timeout time.Duration, allowLocal bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowLocal {
+		dialer.Control = dialControl
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout},
+		//a redirect counts as a failed delivery instead of being followed
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// defaultClient sends deliveries of a Sender without a Client.
+var defaultClient = NewClient(10*time.Second, false)
+
+// Envelope is the body of every delivery. ID is the same for all
+// subscriptions receiving the event, so receivers can deduplicate.
+type Envelope struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewEnvelope encodes the body of a delivery. data may already be encoded
+// JSON (json.RawMessage).
+func NewEnvelope(id uuid.UUID, eventType string, data any, createdAt time.Time) ([]byte, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Envelope{
+		ID:        id,
+		Type:      eventType,
+		CreatedAt: createdAt.UTC(),
+		Data:      raw,
+	})
+}
+
+// Sender posts deliveries and decides when a failed one is retried.
+type Sender struct {
+	// Client defaults to NewClient(10*time.Second, false)
+	Client *http.Client
+	// MaxAttempts is the number of tries before a delivery is marked failed
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Delivery is one event on its way to one subscription.
+type Delivery struct {
+	ID        uuid.UUID
+	EventType string
+	URL       string
+	Secret    string
+	Body      []byte
+}
+
+// Send posts the delivery and returns the response status. Any status
+// outside 2xx is an error.
+func (s *Sender) Send(ctx context.Context, d Delivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1")
+	req.Header.Set(EventHeader, d.EventType)
+	req.Header.Set(DeliveryHeader, d.ID.String())
+	req.Header.Set(SignatureHeader, signature.Header([]string{d.Secret}, now, d.Body))
+
+	client := s.Client
+	if client == nil {
+		client = defaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("receiver returned %s", res.Status)
+	}
+	return res.StatusCode, nil
+}
+
+// NextAttempt returns when a delivery that has failed attempts times is
+// retried, doubling the delay each time up to MaxDelay. ok is false once
+// MaxAttempts is reached.
+func (s *Sender) NextAttempt(attempts int, now time.Time) (next time.Time, ok bool) {
+	if attempts >= s.MaxAttempts {
+		return time.Time{}, false
+	}
+	delay := s.BaseDelay
+	for i := 1; i < attempts && delay < s.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > s.MaxDelay {
+		delay = s.MaxDelay
+	}
+	return now.Add(delay), true
+}
@@ -1,13 +1,27 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Walther-Knight/chirpy/internal/auth"
+	"github.com/Walther-Knight/chirpy/internal/billing"
 	"github.com/Walther-Knight/chirpy/internal/database"
+	"github.com/Walther-Knight/chirpy/internal/entitlements"
+	"github.com/Walther-Knight/chirpy/internal/jobs"
+	"github.com/Walther-Knight/chirpy/internal/limiter"
+	"github.com/Walther-Knight/chirpy/internal/mailer"
 	"github.com/Walther-Knight/chirpy/internal/middleware"
+	"github.com/Walther-Knight/chirpy/internal/oidc"
+	"github.com/Walther-Knight/chirpy/internal/outbox"
+	"github.com/Walther-Knight/chirpy/internal/realtime"
 	"github.com/Walther-Knight/chirpy/internal/server"
+	"github.com/Walther-Knight/chirpy/internal/webhooks"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -20,15 +34,268 @@ func main() {
 		log.Printf("Error opening database: %v\n", errDB)
 	}
 	dbQueries := database.New(db)
+	bus := outbox.NewBus()
+	hasher, errHasher := auth.NewHasher(hashConfigFromEnv())
+	if errHasher != nil {
+		log.Fatalf("Error configuring password hashing: %v\n", errHasher)
+	}
+	accountLimiter, ipLimiter := loginLimitersFromEnv(dbQueries)
+	baseURL := envString("BASE_URL", "http://localhost:8080")
 	cfg := middleware.ApiConfig{
-		Db:          dbQueries,
-		Token:       os.Getenv("TOKEN_STRING"),
-		PolkaSecret: os.Getenv("POLKA_SECRET"),
+		Db:                   dbQueries,
+		Token:                os.Getenv("TOKEN_STRING"),
+		Billing:              billingFromEnv(),
+		CheckoutProvider:     envString("CHECKOUT_PROVIDER", "polka"),
+		TokenVersions:        auth.NewVersionCache(30*time.Second, dbQueries.GetUserTokenVersion),
+		Hasher:               hasher,
+		PasswordPolicy:       passwordPolicyFromEnv(),
+		Mailer:               mailerFromEnv(),
+		BaseURL:              baseURL,
+		PasswordResetTTL:     envDuration("PASSWORD_RESET_TTL", time.Hour),
+		EmailVerifyTTL:       envDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+		RequireVerifiedEmail: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
+		AccountLimiter:       accountLimiter,
+		IPLimiter:            ipLimiter,
+		TrustProxyHeaders:    os.Getenv("TRUST_PROXY_HEADERS") == "true",
+		Platform:             os.Getenv("PLATFORM"),
+		CookieSecure:         os.Getenv("COOKIE_SECURE") != "false",
+		OIDC:                 oidcFromEnv(baseURL),
+		DeletionGracePeriod:  envDuration("ACCOUNT_DELETION_GRACE", 30*24*time.Hour),
+		SubscriptionPeriod:   envDuration("SUBSCRIPTION_PERIOD", 30*24*time.Hour),
+		Entitlements:         entitlements.NewChecker(entitlementPlansFromEnv(), dbQueries.GetSubscription),
+		Webhooks:             webhookSenderFromEnv(),
+		Pool:                 db,
+		Outbox:               outboxRelayFromEnv(dbQueries),
+		Bus:                  bus,
+		Jobs:                 jobWorkerFromEnv(dbQueries),
+		Listener:             &outbox.Listener{URL: dbURL, Db: dbQueries, Bus: bus},
+		RealtimeConns:        realtime.NewConnLimiter(envInt("WS_MAX_CONNECTIONS_PER_USER", 5)),
+	}
+	if email := os.Getenv("BOOTSTRAP_ADMIN_EMAIL"); email != "" {
+		bootstrapAdmin(dbQueries, email)
 	}
 
 	errHttpStart := server.Start(&cfg)
 	if errHttpStart != nil {
 		log.Printf("Error starting server: %v\n", errHttpStart)
 	}
+}
+
+func envString(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid value for %s, using default %v: %v\n", name, fallback, err)
+		return fallback
+	}
+	return d
+}
+
+func envInt(name string, fallback int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Invalid value for %s, using default %d: %v\n", name, fallback, err)
+		return fallback
+	}
+	return n
+}
+
+func hashConfigFromEnv() auth.HashConfig {
+	cfg := auth.DefaultHashConfig
+	if algo := os.Getenv("PASSWORD_HASH_ALGORITHM"); algo != "" {
+		cfg.Algorithm = algo
+	}
+	cfg.BcryptCost = envInt("BCRYPT_COST", cfg.BcryptCost)
+	cfg.Argon2Memory = uint32(envInt("ARGON2_MEMORY_KIB", int(cfg.Argon2Memory)))
+	cfg.Argon2Time = uint32(envInt("ARGON2_TIME", int(cfg.Argon2Time)))
+	cfg.Argon2Threads = uint8(envInt("ARGON2_THREADS", int(cfg.Argon2Threads)))
+	return cfg
+}
+
+func passwordPolicyFromEnv() auth.PasswordPolicy {
+	policy := auth.DefaultPasswordPolicy
+	policy.MinLength = envInt("PASSWORD_MIN_LENGTH", policy.MinLength)
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		policy.Breached = &auth.BreachedPasswords{Dir: dir}
+	}
+	return policy
+}
+
+func mailerFromEnv() mailer.Mailer {
+	from := envString("MAIL_FROM", "chirpy@localhost")
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		return &mailer.SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     envInt("SMTP_PORT", 587),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	case "file":
+		return &mailer.FileMailer{Dir: envString("MAIL_DIR", "./mail"), From: from}
+	default:
+		return mailer.NewStdoutMailer(from)
+	}
+}
 
+// bootstrapAdmin promotes an existing account with a verified email to admin,
+// but only while no admin exists yet. Otherwise whoever signed up first with
+// the address would become admin. Further admins are appointed through PUT /admin/users/{userID}/role.
+func bootstrapAdmin(db *database.Queries, email string) {
+	rows, err := db.BootstrapAdmin(context.Background(), database.BootstrapAdminParams{
+		Email:     email,
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error bootstrapping admin: %v\n", err)
+		return
+	}
+	if rows == 0 {
+		userInfo, err := db.GetUserPassword(context.Background(), email)
+		if err == nil && !userInfo.EmailVerified {
+			log.Printf("BOOTSTRAP_ADMIN_EMAIL ignored: account %s exists but its email is not verified\n", email)
+			return
+		}
+		log.Printf("BOOTSTRAP_ADMIN_EMAIL ignored: an admin already exists or %s has not signed up\n", email)
+		return
+	}
+	log.Printf("User %s promoted to admin\n", email)
+}
+
+// polkaWebhookSecretsFromEnv reads up to two comma separated signing secrets,
+// the new one first, so Polka can rotate without dropping deliveries.
+func polkaWebhookSecretsFromEnv() []string {
+	secrets := []string{}
+	for _, secret := range strings.Split(os.Getenv("POLKA_WEBHOOK_SECRETS"), ",") {
+		secret = strings.TrimSpace(secret)
+		if secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	if len(secrets) > 2 {
+		log.Fatalf("POLKA_WEBHOOK_SECRETS accepts at most two secrets, got %d\n", len(secrets))
+	}
+	return secrets
+}
+
+// billingFromEnv registers the payment providers by name. Another provider is
+// added here and receives webhooks at /api/{name}/webhooks.
+func billingFromEnv() map[string]billing.Provider {
+	polka := &billing.Polka{
+		APIKey:         os.Getenv("POLKA_SECRET"),
+		WebhookSecrets: polkaWebhookSecretsFromEnv(),
+		Tolerance:      envDuration("POLKA_SIGNATURE_TOLERANCE", 5*time.Minute),
+		CheckoutURL:    os.Getenv("POLKA_CHECKOUT_URL"),
+	}
+	return map[string]billing.Provider{polka.Name(): polka}
+}
+
+func entitlementPlansFromEnv() entitlements.Plans {
+	v := os.Getenv("ENTITLEMENT_PLANS")
+	if v == "" {
+		return entitlements.DefaultPlans
+	}
+	plans, err := entitlements.ParsePlans(v)
+	if err != nil {
+		log.Fatalf("Error reading ENTITLEMENT_PLANS: %v\n", err)
+	}
+	return plans
+}
+
+func webhookSenderFromEnv() *webhooks.Sender {
+	return &webhooks.Sender{
+		//local receivers are only reachable while developing locally
+		Client:      webhooks.NewClient(envDuration("WEBHOOK_TIMEOUT", 10*time.Second), os.Getenv("PLATFORM") == "dev"),
+		MaxAttempts: envInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		BaseDelay:   envDuration("WEBHOOK_BACKOFF_BASE", 30*time.Second),
+		MaxDelay:    envDuration("WEBHOOK_BACKOFF_MAX", 6*time.Hour),
+	}
+}
+
+// outboxRelayFromEnv publishes to every server's bus through Postgres
+// NOTIFY and to webhook subscriptions, and to a NATS compatible broker when
+// NATS_URL is set.
+func outboxRelayFromEnv(db *database.Queries) *outbox.Relay {
+	sinks := []outbox.Sink{&outbox.NotifySink{Db: db}, &outbox.WebhookSink{Db: db}}
+	if natsURL := os.Getenv("NATS_URL"); natsURL != "" {
+		sinks = append(sinks, &outbox.NATSSink{
+			URL:           natsURL,
+			SubjectPrefix: envString("NATS_SUBJECT_PREFIX", "chirpy"),
+			Timeout:       envDuration("NATS_TIMEOUT", 5*time.Second),
+		})
+	}
+	return &outbox.Relay{
+		Store:     &outbox.PostgresStore{Db: db},
+		Sinks:     sinks,
+		BatchSize: 100,
+		Lease:     time.Minute,
+		BaseDelay: time.Second,
+		MaxDelay:  envDuration("OUTBOX_RETRY_MAX", 5*time.Minute),
+	}
+}
+
+func jobWorkerFromEnv(db *database.Queries) *jobs.Worker {
+	return &jobs.Worker{
+		Store:        &jobs.PostgresStore{Db: db},
+		Concurrency:  envInt("JOB_CONCURRENCY", 4),
+		PollInterval: envDuration("JOB_POLL_INTERVAL", time.Second),
+		BaseDelay:    envDuration("JOB_BACKOFF_BASE", 10*time.Second),
+		MaxDelay:     envDuration("JOB_BACKOFF_MAX", time.Hour),
+	}
+}
+
+// oidcFromEnv returns nil, disabling single sign-on, unless OIDC_ISSUER is set.
+func oidcFromEnv(baseURL string) *oidc.Provider {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil
+	}
+	return oidc.NewProvider(oidc.Config{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  envString("OIDC_REDIRECT_URL", baseURL+"/api/oidc/callback"),
+	})
+}
+
+func loginLimitersFromEnv(db *database.Queries) (*limiter.Limiter, *limiter.Limiter) {
+	var store limiter.Store = limiter.NewMemoryStore()
+	if os.Getenv("LOGIN_LIMITER_STORE") == "postgres" {
+		store = &limiter.PostgresStore{Db: db}
+	}
+	base := envDuration("LOGIN_BACKOFF_BASE", time.Second)
+	maxDelay := envDuration("LOGIN_LOCKOUT_MAX", 15*time.Minute)
+	window := envDuration("LOGIN_FAILURE_WINDOW", time.Hour)
+
+	accountLimiter := &limiter.Limiter{
+		Store:        store,
+		FreeAttempts: int32(envInt("LOGIN_ACCOUNT_FREE_ATTEMPTS", 5)),
+		BaseDelay:    base,
+		MaxDelay:     maxDelay,
+		Window:       window,
+	}
+	//many users can share an IP, so the IP limit is looser
+	ipLimiter := &limiter.Limiter{
+		Store:        store,
+		FreeAttempts: int32(envInt("LOGIN_IP_FREE_ATTEMPTS", 20)),
+		BaseDelay:    base,
+		MaxDelay:     maxDelay,
+		Window:       window,
+	}
+	return accountLimiter, ipLimiter
 }
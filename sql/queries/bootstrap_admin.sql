@@ -0,0 +1,4 @@
+-- name: BootstrapAdmin :execrows
+UPDATE users
+SET role = 'admin', updated_at = $2
+WHERE email = $1 AND email_verified AND NOT EXISTS (SELECT 1 FROM users WHERE role = 'admin');
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- name: CancelUserDeletion :execrows
+UPDATE users
+SET deletion_scheduled_at = NULL, updated_at = $1
+WHERE id = $2 AND deletion_scheduled_at IS NOT NULL;
\ No newline at end of file
@@ -0,0 +1,12 @@
+-- name: ClaimJobs :many
+UPDATE jobs
+SET status = 'running', attempts = attempts + 1, locked_until = sqlc.arg(locked_until), updated_at = sqlc.arg(now)
+WHERE id IN (
+    SELECT id FROM jobs
+    WHERE kind = sqlc.arg(kind)
+    AND ((status = 'pending' AND run_at <= sqlc.arg(now)) OR (status = 'running' AND locked_until < sqlc.arg(now) AND attempts < max_attempts))
+    ORDER BY run_at
+    LIMIT sqlc.arg('limit')
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
\ No newline at end of file
@@ -0,0 +1,11 @@
+-- name: ClaimOutboxEvents :many
+UPDATE outbox_events
+SET available_at = sqlc.arg(lease_until)
+WHERE id IN (
+    SELECT id FROM outbox_events
+    WHERE published_at IS NULL AND available_at <= sqlc.arg(now)
+    ORDER BY available_at, created_at
+    LIMIT sqlc.arg('limit')
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
\ No newline at end of file
@@ -0,0 +1,14 @@
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries d
+SET next_attempt_at = sqlc.arg(lease_until)
+FROM webhook_subscriptions s
+WHERE s.id = d.subscription_id
+AND d.id IN (
+    SELECT pending.id FROM webhook_deliveries pending
+    JOIN webhook_subscriptions sub ON sub.id = pending.subscription_id
+    WHERE pending.status = 'pending' AND pending.next_attempt_at <= sqlc.arg(now) AND sub.disabled_at IS NULL
+    ORDER BY pending.next_attempt_at
+    LIMIT sqlc.arg('limit')
+    FOR UPDATE OF pending SKIP LOCKED
+)
+RETURNING d.id, d.event_type, d.payload, d.attempts, s.url, s.secret;
\ No newline at end of file
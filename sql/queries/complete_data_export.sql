@@ -0,0 +1,4 @@
+-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = $1, archive = $2, completed_at = $3
+WHERE id = $4;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- name: CompleteJob :execrows
+UPDATE jobs
+SET status = 'succeeded', locked_until = NULL, last_error = NULL, updated_at = $1, finished_at = $1
+WHERE id = $2 AND status = 'running' AND attempts = $3;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- name: ConfirmUserEmail :one
+UPDATE users
+SET email = $1, email_verified = true, pending_email = NULL, updated_at = $2
+WHERE id = $3 AND (email = $1 OR pending_email = $1)
+RETURNING *;
@@ -0,0 +1,6 @@
+-- name: ConsumeAuthorizationCode :one
+UPDATE oauth_authorization_codes
+SET used_at = $1
+WHERE code_hash = $2 AND client_id = $3 AND redirect_uri = $4
+    AND used_at IS NULL AND expires_at > $1
+RETURNING *;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- name: ConsumeOIDCLoginState :one
+DELETE FROM oidc_login_states
+WHERE state_hash = $1 AND expires_at > $2
+RETURNING code_verifier, nonce;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- name: CountChirpsByAuthor :one
+SELECT COUNT(*)
+FROM chirps
+WHERE user_id = $1;
\ No newline at end of file
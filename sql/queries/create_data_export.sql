@@ -0,0 +1,9 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports(id, user_id, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
\ No newline at end of file
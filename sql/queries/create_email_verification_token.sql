@@ -0,0 +1,9 @@
+-- name: CreateEmailVerificationToken :exec
+INSERT INTO email_verification_tokens(token_hash, user_id, email, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+);
@@ -0,0 +1,13 @@
+-- name: CreateJob :execrows
+INSERT INTO jobs(id, kind, payload, max_attempts, run_at, unique_key, created_at, updated_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $7
+)
+ON CONFLICT (unique_key) WHERE status IN ('pending', 'running') DO NOTHING;
\ No newline at end of file
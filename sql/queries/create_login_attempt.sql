@@ -0,0 +1,11 @@
+-- name: CreateLoginAttempt :exec
+INSERT INTO login_attempts(id, email, user_id, ip_address, success, reason, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+);
\ No newline at end of file
@@ -0,0 +1,11 @@
+-- name: CreateOAuthRefreshToken :exec
+INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, client_id, scopes)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+);
\ No newline at end of file
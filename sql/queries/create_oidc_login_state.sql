@@ -0,0 +1,9 @@
+-- name: CreateOIDCLoginState :exec
+INSERT INTO oidc_login_states(state_hash, code_verifier, nonce, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+);
\ No newline at end of file
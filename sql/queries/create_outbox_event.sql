@@ -0,0 +1,10 @@
+-- name: CreateOutboxEvent :exec
+INSERT INTO outbox_events(id, user_id, event_type, payload, available_at, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+);
\ No newline at end of file
@@ -0,0 +1,7 @@
+-- name: CreateRecoveryCode :exec
+INSERT INTO totp_recovery_codes(user_id, code_hash, created_at)
+VALUES (
+    $1,
+    $2,
+    $3
+);
\ No newline at end of file
@@ -0,0 +1,9 @@
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities(issuer, subject, user_id, email, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+);
\ No newline at end of file
@@ -0,0 +1,12 @@
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries(id, subscription_id, event_id, event_type, payload, next_attempt_at, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $6
+)
+RETURNING *;
\ No newline at end of file
@@ -0,0 +1,12 @@
+-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events(id, provider, event_id, event_type, payload, received_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+ON CONFLICT (provider, event_id) DO NOTHING
+RETURNING id, provider, event_id, event_type, payload, status, error, attempts, received_at, processed_at;
\ No newline at end of file
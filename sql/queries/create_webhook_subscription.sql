@@ -0,0 +1,13 @@
+-- name: CreateWebhookSubscription :one
+INSERT INTO webhook_subscriptions(id, user_id, url, secret, events, all_users, created_at, updated_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $7
+)
+RETURNING *;
\ No newline at end of file
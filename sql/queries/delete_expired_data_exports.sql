@@ -0,0 +1,3 @@
+-- name: DeleteExpiredDataExports :exec
+DELETE FROM data_exports
+WHERE expires_at <= $1;
\ No newline at end of file
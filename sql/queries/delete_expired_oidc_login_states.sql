@@ -0,0 +1,3 @@
+-- name: DeleteExpiredOIDCLoginStates :exec
+DELETE FROM oidc_login_states
+WHERE expires_at <= $1;
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- name: DeleteFinishedJobs :execrows
+DELETE FROM jobs
+WHERE status = 'succeeded' AND finished_at < $1;
\ No newline at end of file
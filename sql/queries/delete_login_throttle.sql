@@ -0,0 +1,3 @@
+-- name: DeleteLoginThrottle :exec
+DELETE FROM login_throttle
+WHERE key = $1;
\ No newline at end of file
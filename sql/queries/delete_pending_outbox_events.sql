@@ -0,0 +1,3 @@
+-- name: DeletePendingOutboxEvents :exec
+DELETE FROM outbox_events
+WHERE event_type = sqlc.arg(event_type) AND payload->>'id' = sqlc.arg(subject_id)::text AND published_at IS NULL;
\ No newline at end of file
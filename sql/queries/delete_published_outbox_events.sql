@@ -0,0 +1,3 @@
+-- name: DeletePublishedOutboxEvents :execrows
+DELETE FROM outbox_events
+WHERE published_at < $1;
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM totp_recovery_codes
+WHERE user_id = $1;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- name: DisableTOTP :exec
+UPDATE users
+SET totp_enabled = false, totp_secret = NULL, totp_last_step = 0, updated_at = $1
+WHERE id = $2;
\ No newline at end of file
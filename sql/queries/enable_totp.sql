@@ -0,0 +1,4 @@
+-- name: EnableTOTP :exec
+UPDATE users
+SET totp_enabled = true, totp_last_step = $1, updated_at = $2
+WHERE id = $3;
\ No newline at end of file
@@ -0,0 +1,8 @@
+-- name: EnqueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries(id, subscription_id, event_id, event_type, payload, next_attempt_at, created_at)
+SELECT gen_random_uuid(), id, $1, $2, $3, $4, $5
+FROM webhook_subscriptions
+WHERE disabled_at IS NULL
+AND (user_id = $6 OR all_users)
+AND $2 = ANY(string_to_array(events, ' '))
+ON CONFLICT (subscription_id, event_id) DO NOTHING;
\ No newline at end of file
@@ -0,0 +1,10 @@
+-- name: ExpireSubscriptions :execrows
+WITH expired AS (
+    UPDATE subscriptions
+    SET status = 'expired', updated_at = $1
+    WHERE status <> 'expired' AND current_period_end <= $1
+    RETURNING user_id
+)
+UPDATE users
+SET is_chirpy_red = false, updated_at = $1
+WHERE id IN (SELECT user_id FROM expired);
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- name: FinishWebhookDelivery :execrows
+UPDATE webhook_deliveries
+SET status = $1, attempts = attempts + 1, next_attempt_at = $2, response_status = $3, last_error = $4, delivered_at = $5
+WHERE id = $6 AND status = 'pending' AND attempts = $7;
\ No newline at end of file
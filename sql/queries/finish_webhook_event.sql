@@ -0,0 +1,4 @@
+-- name: FinishWebhookEvent :exec
+UPDATE webhook_events
+SET status = $1, error = $2, attempts = attempts + 1, processed_at = $3
+WHERE id = $4 AND status IN ('received', 'failed');
\ No newline at end of file
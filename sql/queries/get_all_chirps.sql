@@ -1,3 +1,5 @@
 -- name: GetAllChirps :many
 SELECT * FROM chirps
-ORDER BY created_at;
\ No newline at end of file
+WHERE publish_at <= $1
+AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.deletion_scheduled_at IS NOT NULL)
+ORDER BY publish_at;
\ No newline at end of file
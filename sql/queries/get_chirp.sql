@@ -1,3 +1,4 @@
 -- name: GetChirp :one
 SELECT * FROM chirps
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1
+AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.deletion_scheduled_at IS NOT NULL);
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- name: GetJob :one
+SELECT * FROM jobs
+WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- name: GetLoginThrottle :one
+SELECT failures, last_failure_at
+FROM login_throttle
+WHERE key = $1;
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- name: GetOutboxEvent :one
+SELECT * FROM outbox_events
+WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- name: GetPersonalAccessTokenByHash :one
+SELECT * FROM personal_access_tokens
+WHERE token_hash = $1
+    AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = personal_access_tokens.user_id
+        AND (users.locked_at IS NOT NULL OR users.deletion_scheduled_at IS NOT NULL));
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- name: GetPublishedChirpsByAuthor :many
+SELECT * FROM chirps
+WHERE user_id = $1 AND publish_at <= $2
+AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.deletion_scheduled_at IS NOT NULL)
+ORDER BY publish_at;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- name: GetRecentWebhookEventByPayload :one
+SELECT * FROM webhook_events
+WHERE provider = $1 AND payload = $2 AND received_at > $3
+ORDER BY received_at DESC
+LIMIT 1;
\ No newline at end of file
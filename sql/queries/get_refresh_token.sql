@@ -1,4 +1,6 @@
 -- name: GetUserFromRefreshToken :one
-SELECT expires_at, user_id, revoked_at
+SELECT refresh_tokens.expires_at, refresh_tokens.user_id, refresh_tokens.revoked_at, refresh_tokens.client_id, refresh_tokens.scopes,
+    users.deletion_scheduled_at
 FROM refresh_tokens
+JOIN users ON users.id = refresh_tokens.user_id
 WHERE token = $1;
\ No newline at end of file
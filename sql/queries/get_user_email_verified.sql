@@ -0,0 +1,4 @@
+-- name: GetUserEmailVerified :one
+SELECT email_verified
+FROM users
+WHERE id = $1;
@@ -0,0 +1,4 @@
+-- name: GetUserIDByIdentity :one
+SELECT user_id
+FROM user_identities
+WHERE issuer = $1 AND subject = $2;
\ No newline at end of file
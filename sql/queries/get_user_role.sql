@@ -0,0 +1,4 @@
+-- name: GetUserRole :one
+SELECT role
+FROM users
+WHERE id = $1;
\ No newline at end of file
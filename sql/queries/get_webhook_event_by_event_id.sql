@@ -0,0 +1,3 @@
+-- name: GetWebhookEventByEventID :one
+SELECT * FROM webhook_events
+WHERE provider = $1 AND event_id = $2;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- name: GetWebhookEventForUpdate :one
+SELECT * FROM webhook_events
+WHERE id = $1
+FOR UPDATE;
\ No newline at end of file
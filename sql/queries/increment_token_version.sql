@@ -0,0 +1,5 @@
+-- name: IncrementTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1, updated_at = $1
+WHERE id = $2
+RETURNING token_version;
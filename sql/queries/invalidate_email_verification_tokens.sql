@@ -0,0 +1,4 @@
+-- name: InvalidateEmailVerificationTokens :exec
+UPDATE email_verification_tokens
+SET used_at = $1
+WHERE user_id = $2 AND used_at IS NULL;
@@ -0,0 +1,4 @@
+-- name: KillExpiredJobs :execrows
+UPDATE jobs
+SET status = 'dead', locked_until = NULL, last_error = 'the last attempt did not finish before its lock expired', updated_at = sqlc.arg(now), finished_at = sqlc.arg(now)
+WHERE kind = sqlc.arg(kind) AND status = 'running' AND locked_until < sqlc.arg(now) AND attempts >= max_attempts;
\ No newline at end of file
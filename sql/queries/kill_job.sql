@@ -0,0 +1,4 @@
+-- name: KillJob :execrows
+UPDATE jobs
+SET status = 'dead', locked_until = NULL, last_error = $1, updated_at = $2, finished_at = $2
+WHERE id = $3 AND status = 'running' AND attempts = $4;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- name: ListAllPersonalAccessTokens :many
+SELECT * FROM personal_access_tokens
+WHERE user_id = $1
+ORDER BY created_at;
\ No newline at end of file
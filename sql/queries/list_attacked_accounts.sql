@@ -0,0 +1,7 @@
+-- name: ListAttackedAccounts :many
+SELECT email, COUNT(*) AS failures, COUNT(DISTINCT ip_address) AS distinct_ips, MAX(created_at)::timestamp AS last_attempt_at
+FROM login_attempts
+WHERE success = false AND created_at > $1
+GROUP BY email
+ORDER BY failures DESC
+LIMIT $2;
\ No newline at end of file
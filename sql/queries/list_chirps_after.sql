@@ -0,0 +1,8 @@
+-- name: ListChirpsAfter :many
+SELECT * FROM chirps
+WHERE (publish_at, id) > (sqlc.arg(after_publish_at), sqlc.arg(after_id)::uuid)
+AND publish_at <= sqlc.arg(now)
+AND (sqlc.narg(author_id)::uuid IS NULL OR user_id = sqlc.narg(author_id))
+AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.deletion_scheduled_at IS NOT NULL)
+ORDER BY publish_at, id
+LIMIT sqlc.arg('limit');
\ No newline at end of file
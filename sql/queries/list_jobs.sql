@@ -0,0 +1,6 @@
+-- name: ListJobs :many
+SELECT * FROM jobs
+WHERE (sqlc.arg(status)::text = '' OR status = sqlc.arg(status))
+AND (sqlc.arg(kind)::text = '' OR kind = sqlc.arg(kind))
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit');
\ No newline at end of file
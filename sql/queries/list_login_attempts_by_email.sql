@@ -0,0 +1,5 @@
+-- name: ListLoginAttemptsByEmail :many
+SELECT * FROM login_attempts
+WHERE email = $1
+ORDER BY created_at DESC
+LIMIT $2;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- name: ListOAuthClients :many
+SELECT * FROM oauth_clients
+WHERE owner_id = $1
+ORDER BY created_at;
\ No newline at end of file
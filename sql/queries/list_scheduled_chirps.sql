@@ -0,0 +1,4 @@
+-- name: ListScheduledChirps :many
+SELECT * FROM chirps
+WHERE user_id = $1 AND publish_at > $2
+ORDER BY publish_at;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- name: ListUserIdentities :many
+SELECT * FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- name: ListUserRefreshTokens :many
+SELECT created_at, expires_at, revoked_at, client_id
+FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at;
\ No newline at end of file
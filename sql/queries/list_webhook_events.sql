@@ -0,0 +1,4 @@
+-- name: ListWebhookEvents :many
+SELECT * FROM webhook_events
+ORDER BY received_at DESC
+LIMIT $1;
\ No newline at end of file
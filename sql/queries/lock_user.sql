@@ -0,0 +1,4 @@
+-- name: LockUser :execrows
+UPDATE users
+SET locked_at = $1, updated_at = $2
+WHERE id = $3 AND locked_at IS NULL;
\ No newline at end of file
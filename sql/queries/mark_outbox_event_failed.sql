@@ -0,0 +1,4 @@
+-- name: MarkOutboxEventFailed :exec
+UPDATE outbox_events
+SET available_at = $1, attempts = attempts + 1, last_error = $2
+WHERE id = $3;
\ No newline at end of file
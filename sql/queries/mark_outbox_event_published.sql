@@ -0,0 +1,4 @@
+-- name: MarkOutboxEventPublished :exec
+UPDATE outbox_events
+SET published_at = $1, attempts = attempts + 1, last_error = NULL
+WHERE id = $2;
\ No newline at end of file
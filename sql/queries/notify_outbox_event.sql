@@ -0,0 +1,2 @@
+-- name: NotifyOutboxEvent :exec
+SELECT pg_notify(sqlc.arg(channel)::text, sqlc.arg(payload)::text);
\ No newline at end of file
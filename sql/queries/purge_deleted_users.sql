@@ -0,0 +1,3 @@
+-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deletion_scheduled_at <= $1;
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- name: PurgeDeletedUsersLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE user_id IN (SELECT id FROM users WHERE deletion_scheduled_at <= $1);
\ No newline at end of file
@@ -0,0 +1,7 @@
+-- name: RecordLoginFailure :one
+INSERT INTO login_throttle(key, failures, last_failure_at)
+VALUES (@key, 1, @failed_at)
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE WHEN login_throttle.last_failure_at < @window_start THEN 1 ELSE login_throttle.failures + 1 END,
+    last_failure_at = @failed_at
+RETURNING failures, last_failure_at;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- name: RequeueJob :one
+UPDATE jobs
+SET status = 'pending', attempts = 0, run_at = $1, updated_at = $1, finished_at = NULL
+WHERE id = $2 AND status IN ('pending', 'dead')
+RETURNING *;
\ No newline at end of file
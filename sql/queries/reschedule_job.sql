@@ -0,0 +1,4 @@
+-- name: RescheduleJob :execrows
+UPDATE jobs
+SET status = 'pending', run_at = $1, locked_until = NULL, last_error = $2, updated_at = $3
+WHERE id = $4 AND status = 'running' AND attempts = $5;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- name: RevokeAllPersonalAccessTokens :exec
+UPDATE personal_access_tokens
+SET revoked_at = $1
+WHERE user_id = $2 AND revoked_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_tokens
+SET revoked_at = $1
+WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,23 @@
+-- name: SaveSubscription :exec
+WITH saved AS (
+    INSERT INTO subscriptions(user_id, plan, status, current_period_end, cancelled_at, created_at, updated_at)
+    VALUES (
+        $1,
+        $2,
+        $3,
+        $4,
+        $5,
+        $6,
+        $6
+    )
+    ON CONFLICT (user_id) DO UPDATE
+    SET plan = EXCLUDED.plan,
+        status = EXCLUDED.status,
+        current_period_end = EXCLUDED.current_period_end,
+        cancelled_at = EXCLUDED.cancelled_at,
+        updated_at = EXCLUDED.updated_at
+    RETURNING user_id
+)
+UPDATE users
+SET is_chirpy_red = $7, updated_at = $6
+WHERE id = (SELECT user_id FROM saved);
\ No newline at end of file
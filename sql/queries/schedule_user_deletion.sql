@@ -0,0 +1,4 @@
+-- name: ScheduleUserDeletion :execrows
+UPDATE users
+SET deletion_scheduled_at = $1, updated_at = $2
+WHERE id = $3 AND deletion_scheduled_at IS NULL;
\ No newline at end of file
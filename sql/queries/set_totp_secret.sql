@@ -0,0 +1,4 @@
+-- name: SetTOTPSecret :exec
+UPDATE users
+SET totp_secret = $1, totp_enabled = false, updated_at = $2
+WHERE id = $3;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- name: SetUserPendingEmail :exec
+UPDATE users
+SET pending_email = $1, updated_at = $2
+WHERE id = $3;
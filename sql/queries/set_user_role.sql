@@ -0,0 +1,4 @@
+-- name: SetUserRole :execrows
+UPDATE users
+SET role = $1, updated_at = $2
+WHERE id = $3;
\ No newline at end of file
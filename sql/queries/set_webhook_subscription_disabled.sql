@@ -0,0 +1,5 @@
+-- name: SetWebhookSubscriptionDisabled :one
+UPDATE webhook_subscriptions
+SET disabled_at = $1, updated_at = $2
+WHERE id = $3 AND user_id = $4
+RETURNING *;
\ No newline at end of file
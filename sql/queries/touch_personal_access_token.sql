@@ -0,0 +1,4 @@
+-- name: TouchPersonalAccessToken :exec
+UPDATE personal_access_tokens
+SET last_used_at = $1
+WHERE id = $2;
\ No newline at end of file
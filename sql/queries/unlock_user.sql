@@ -0,0 +1,4 @@
+-- name: UnlockUser :execrows
+UPDATE users
+SET locked_at = NULL, updated_at = $1
+WHERE id = $2 AND locked_at IS NOT NULL;
\ No newline at end of file
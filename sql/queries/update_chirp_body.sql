@@ -0,0 +1,5 @@
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $1, updated_at = $2
+WHERE id = $3
+RETURNING *;
\ No newline at end of file
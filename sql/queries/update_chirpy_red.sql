@@ -1,4 +0,0 @@
--- name: UpdateChirpyRed :exec
-UPDATE users
-SET is_chirpy_red = true
-WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- name: UpdatePendingOutboxEvents :exec
+UPDATE outbox_events
+SET payload = sqlc.arg(payload)
+WHERE event_type = sqlc.arg(event_type) AND payload->>'id' = sqlc.arg(subject_id)::text AND published_at IS NULL;
\ No newline at end of file
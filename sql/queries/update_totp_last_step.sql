@@ -0,0 +1,4 @@
+-- name: UpdateTOTPLastStep :execrows
+UPDATE users
+SET totp_last_step = $1
+WHERE id = $2 AND totp_last_step < $1;
\ No newline at end of file
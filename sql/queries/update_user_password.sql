@@ -0,0 +1,4 @@
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = $2
+WHERE id = $3;
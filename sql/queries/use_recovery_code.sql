@@ -0,0 +1,4 @@
+-- name: UseRecoveryCode :execrows
+UPDATE totp_recovery_codes
+SET used_at = $1
+WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL;
\ No newline at end of file
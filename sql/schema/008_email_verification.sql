@@ -0,0 +1,24 @@
+-- +goose Up
+-- accounts created before email verification existed were never sent a
+-- token for their address, treat only those as verified
+ALTER TABLE users
+ADD email_verified BOOLEAN NOT NULL DEFAULT true,
+ADD pending_email TEXT;
+ALTER TABLE users
+ALTER COLUMN email_verified SET DEFAULT false;
+
+CREATE TABLE email_verification_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL,
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id)
+    ON DELETE CASCADE);
+
+-- +goose Down
+DROP TABLE email_verification_tokens;
+ALTER TABLE users
+DROP COLUMN email_verified,
+DROP COLUMN pending_email;
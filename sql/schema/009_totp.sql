@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE users
+ADD totp_secret TEXT,
+ADD totp_enabled BOOLEAN NOT NULL DEFAULT false,
+ADD totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE totp_recovery_codes (
+    user_id UUID NOT NULL,
+    code_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    PRIMARY KEY (user_id, code_hash),
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id)
+    ON DELETE CASCADE);
+
+-- +goose Down
+DROP TABLE totp_recovery_codes;
+ALTER TABLE users
+DROP COLUMN totp_secret,
+DROP COLUMN totp_enabled,
+DROP COLUMN totp_last_step;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE login_throttle (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL);
+
+CREATE TABLE login_attempts (
+    id UUID PRIMARY KEY,
+    email TEXT NOT NULL,
+    user_id UUID,
+    ip_address TEXT NOT NULL,
+    success BOOLEAN NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id)
+    ON DELETE SET NULL);
+
+CREATE INDEX login_attempts_email_created_at_idx ON login_attempts (email, created_at);
+CREATE INDEX login_attempts_created_at_idx ON login_attempts (created_at);
+
+-- +goose Down
+DROP TABLE login_attempts;
+DROP TABLE login_throttle;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin')),
+ADD COLUMN locked_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN locked_at,
+DROP COLUMN role;
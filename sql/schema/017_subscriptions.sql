@@ -0,0 +1,29 @@
+-- +goose Up
+UPDATE users SET is_chirpy_red = false WHERE is_chirpy_red IS NULL;
+ALTER TABLE users
+ALTER COLUMN is_chirpy_red SET NOT NULL;
+
+CREATE TABLE subscriptions (
+    user_id UUID PRIMARY KEY,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('active', 'past_due', 'cancelled', 'expired')),
+    current_period_end TIMESTAMP NOT NULL,
+    cancelled_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id)
+    ON DELETE CASCADE);
+
+CREATE INDEX subscriptions_current_period_end_idx ON subscriptions (current_period_end) WHERE status <> 'expired';
+
+-- members upgraded before subscriptions existed never expire, the next Polka event starts a normal period
+-- (subscription.LegacyPeriodEnd)
+INSERT INTO subscriptions(user_id, plan, status, current_period_end, created_at, updated_at)
+SELECT id, 'red', 'active', '9999-12-31 00:00:00', NOW(), NOW()
+FROM users
+WHERE is_chirpy_red;
+
+-- +goose Down
+DROP TABLE subscriptions;
+ALTER TABLE users
+ALTER COLUMN is_chirpy_red DROP NOT NULL;
@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN publish_at TIMESTAMP;
+UPDATE chirps SET publish_at = created_at;
+ALTER TABLE chirps
+ALTER COLUMN publish_at SET NOT NULL;
+
+CREATE INDEX chirps_publish_at_idx ON chirps (publish_at);
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN publish_at;
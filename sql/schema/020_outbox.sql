@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE outbox_events (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    available_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    published_at TIMESTAMP);
+
+CREATE INDEX outbox_events_pending_idx ON outbox_events (available_at) WHERE published_at IS NULL;
+CREATE INDEX outbox_events_published_at_idx ON outbox_events (published_at) WHERE published_at IS NOT NULL;
+
+-- the relay delivers at least once, a redelivered event must not queue a second webhook
+CREATE UNIQUE INDEX webhook_deliveries_subscription_event_idx ON webhook_deliveries (subscription_id, event_id);
+
+-- +goose Down
+DROP INDEX webhook_deliveries_subscription_event_idx;
+DROP TABLE outbox_events;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE jobs (
+    id UUID PRIMARY KEY,
+    kind TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'succeeded', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    run_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    last_error TEXT,
+    unique_key TEXT,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP);
+
+CREATE INDEX jobs_pending_idx ON jobs (kind, run_at) WHERE status = 'pending';
+CREATE INDEX jobs_running_idx ON jobs (kind, locked_until) WHERE status = 'running';
+CREATE INDEX jobs_status_created_at_idx ON jobs (status, created_at);
+-- at most one queued or running job per key, used by recurring jobs
+CREATE UNIQUE INDEX jobs_unique_key_idx ON jobs (unique_key) WHERE status IN ('pending', 'running');
+
+-- +goose Down
+DROP TABLE jobs;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- the chirp stream resumes after the last (publish_at, id) a client saw
+CREATE INDEX chirps_publish_at_id_idx ON chirps (publish_at, id);
+
+-- +goose Down
+DROP INDEX chirps_publish_at_id_idx;
@@ -0,0 +1,5 @@
+-- +goose Up
+CREATE INDEX webhook_events_provider_received_at_idx ON webhook_events (provider, received_at);
+
+-- +goose Down
+DROP INDEX webhook_events_provider_received_at_idx;